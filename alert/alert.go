@@ -0,0 +1,381 @@
+package alert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"pingood/monitor"
+)
+
+// 通知の再送のデフォルト値
+const (
+	DefaultAttempts      = 4               // 最初の送信を含む送信回数
+	DefaultRetryInterval = 5 * time.Second // 最初の再送までの間隔（再送ごとに2倍）
+)
+
+// queueSize は通知先ごとの送信待ちの通知の上限です
+const queueSize = 100
+
+// Config は状態の遷移を通知する設定（[alerts]）です
+type Config struct {
+	Webhooks []WebhookConfig `toml:"webhooks"` // [[alerts.webhooks]]
+	Email    []EmailConfig   `toml:"email"`    // [[alerts.email]]
+}
+
+// Validate は通知の設定を検証します
+func (c Config) Validate() error {
+	for i, w := range c.Webhooks {
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("%d番目のwebhook: %v", i+1, err)
+		}
+	}
+	for i, e := range c.Email {
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("%d番目のemail: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ErrorLog はターゲットのエラーログの最後のn行を返す関数です（Logger.TailErrors）
+type ErrorLog func(index, n int) ([]string, error)
+
+// RouteConfig は通知先に共通の、通知する遷移の条件と再送の設定です
+type RouteConfig struct {
+	Targets       []string `toml:"targets"`        // 通知するターゲットの名前（省略した場合はすべて）
+	States        []string `toml:"states"`         // 通知する遷移後の状態（省略した場合はすべて）
+	Attempts      int      `toml:"attempts"`       // 最初の送信を含む送信回数（省略した場合は4回）
+	RetryInterval string   `toml:"retry_interval"` // 最初の再送までの間隔（例: "5s"、再送ごとに2倍）
+	FlapWindow    string   `toml:"flap_window"`    // 同じ遷移を再び通知するまでの最短間隔（例: "10m"、省略した場合は抑制しない）
+}
+
+// validate は条件と再送の設定を検証します
+func (c RouteConfig) validate() error {
+	for _, s := range c.States {
+		switch monitor.State(s) {
+		case monitor.StateUp, monitor.StateDown, monitor.StateDegraded:
+		default:
+			return fmt.Errorf("statesにはUP、DOWNまたはDEGRADEDを指定してください: %s", s)
+		}
+	}
+	if c.Attempts < 0 {
+		return fmt.Errorf("attemptsには0以上の値を指定してください: %d", c.Attempts)
+	}
+	if c.RetryInterval != "" {
+		if d, err := time.ParseDuration(c.RetryInterval); err != nil || d <= 0 {
+			return fmt.Errorf("retry_intervalの形式が不正です（例: 5s、1m）: %s", c.RetryInterval)
+		}
+	}
+	if c.FlapWindow != "" {
+		if d, err := time.ParseDuration(c.FlapWindow); err != nil || d <= 0 {
+			return fmt.Errorf("flap_windowの形式が不正です（例: 10m、1h）: %s", c.FlapWindow)
+		}
+	}
+	return nil
+}
+
+// matches は遷移が通知の条件に一致するかを返します
+// 起動直後にUPと判定した遷移は通知しません
+func (c RouteConfig) matches(e Event) bool {
+	if e.OldState == monitor.StateUnknown && e.NewState == monitor.StateUp {
+		return false
+	}
+	if len(c.Targets) > 0 && !slices.Contains(c.Targets, e.Target) {
+		return false
+	}
+	if len(c.States) > 0 && !slices.Contains(c.States, string(e.NewState)) {
+		return false
+	}
+	return true
+}
+
+// Event は通知する状態の遷移です
+type Event struct {
+	ID       string        // 遷移ごとの識別子（再送しても変わらない）
+	Index    int           // ロガーのファイルインデックス
+	Target   string        // ターゲットの名前
+	OldState monitor.State // 遷移前の状態
+	NewState monitor.State // 遷移後の状態
+	Time     time.Time     // 遷移を判定した時刻
+	Since    time.Time     // 遷移の原因となった最初の検査の時刻
+	Duration time.Duration // DOWNから回復した場合は停止時間、それ以外は最初の検査から遷移までの時間
+	Error    string        // 最後に失敗した検査のエラー
+	Reason   string        // 遷移を判定した検査のエラーまたは警告
+}
+
+// NewEvent は状態の遷移から通知する内容を作成します
+func NewEvent(t monitor.Transition) Event {
+	duration := t.Outage
+	if t.From != monitor.StateDown {
+		duration = t.Time.Sub(t.Since)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s\n%s\n%s", t.Job.Index, t.Job.Target, t.To, t.Time.Format(time.RFC3339Nano))))
+	return Event{
+		ID:       hex.EncodeToString(sum[:8]),
+		Index:    t.Job.Index,
+		Target:   t.Job.Target,
+		OldState: t.From,
+		NewState: t.To,
+		Time:     t.Time,
+		Since:    t.Since,
+		Duration: duration,
+		Error:    t.LastError,
+		Reason:   t.Reason,
+	}
+}
+
+// Notifier は状態の遷移を通知する方法です
+type Notifier interface {
+	// Name はログに表示する通知先の名前を返します
+	Name() string
+	// Notify は遷移を1回通知します。再送しても成功しないエラーはPermanentで包んで返します
+	Notify(ctx context.Context, e Event) error
+}
+
+// permanentError は再送しても成功しないエラーです
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent はエラーを再送しないエラーとして包みます
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// route は通知先と、その送信待ちの通知です
+// sent、notified、pendingはDispatcher.muで保護します
+type route struct {
+	notifier      Notifier
+	config        RouteConfig
+	attempts      int
+	retryInterval time.Duration
+	flapWindow    time.Duration
+	queue         chan Event
+	sent          map[flapKey]time.Time // 遷移ごとに最後に通知した遷移の時刻
+	notified      map[int]monitor.State // ターゲットごとに最後に通知した遷移後の状態
+	pending       map[int]*held         // ターゲットごとにflap_windowで保留している通知
+}
+
+// flapKey はflap_windowで抑制する遷移です
+type flapKey struct {
+	index    int
+	from, to monitor.State
+}
+
+// held はflap_windowが過ぎるまで保留している通知です
+type held struct {
+	event Event
+	timer *time.Timer
+}
+
+// Dispatcher は状態の遷移を条件に一致する通知先に送信します
+// 通知先ごとにgoroutineで順番に送信するため、遅い通知先が検査や他の通知を遅らせることはありません
+type Dispatcher struct {
+	routes []*route
+	mu     sync.Mutex
+	last   map[int]monitor.State // ファイルインデックスごとに最後に受け取った遷移後の状態（通知しなかった遷移も含む）
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New は設定から通知先を作成し、送信を開始します（通知先がない場合も有効なDispatcherを返します）
+// errorLogはメールにエラーログの最後の行を含めるために使用します（nilの場合は含めません）
+func New(cfg Config, errorLog ErrorLog) (*Dispatcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	d := NewDispatcher()
+	for _, w := range cfg.Webhooks {
+		n, err := NewWebhook(w)
+		if err != nil {
+			d.Close(context.Background())
+			return nil, err
+		}
+		d.Add(n, w.RouteConfig)
+	}
+	for _, e := range cfg.Email {
+		n, err := NewEmail(e, errorLog)
+		if err != nil {
+			d.Close(context.Background())
+			return nil, err
+		}
+		d.Add(n, e.route())
+	}
+	return d, nil
+}
+
+// NewDispatcher は通知先のないDispatcherを作成します
+func NewDispatcher() *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{last: make(map[int]monitor.State), ctx: ctx, cancel: cancel}
+}
+
+// Add は通知先を追加し、送信を開始します
+func (d *Dispatcher) Add(n Notifier, cfg RouteConfig) {
+	r := &route{
+		notifier:      n,
+		config:        cfg,
+		attempts:      cfg.Attempts,
+		retryInterval: DefaultRetryInterval,
+		queue:         make(chan Event, queueSize),
+		sent:          make(map[flapKey]time.Time),
+		notified:      make(map[int]monitor.State),
+		pending:       make(map[int]*held),
+	}
+	if r.attempts <= 0 {
+		r.attempts = DefaultAttempts
+	}
+	if v, err := time.ParseDuration(cfg.RetryInterval); err == nil && v > 0 {
+		r.retryInterval = v
+	}
+	if v, err := time.ParseDuration(cfg.FlapWindow); err == nil && v > 0 {
+		r.flapWindow = v
+	}
+	d.routes = append(d.routes, r)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for e := range r.queue {
+			r.deliver(d.ctx, e)
+		}
+	}()
+}
+
+// Len は通知先の数を返します
+func (d *Dispatcher) Len() int {
+	return len(d.routes)
+}
+
+// Send は状態の遷移を条件に一致する通知先の送信待ちに加えます
+// 同じターゲット（ファイルインデックス）が同じ状態に続けて遷移した場合は通知しません
+// statesで除外した遷移も最後の状態として記録するため、DOWN→UP→DOWNの2回目のDOWNも通知します
+// flap_windowを設定した通知先では、同じ遷移を間隔内に繰り返した場合に通知を保留します
+// 送信待ちがいっぱいの場合は通知を破棄します
+func (d *Dispatcher) Send(t monitor.Transition) {
+	e := NewEvent(t)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed || d.last[e.Index] == e.NewState {
+		return
+	}
+	d.last[e.Index] = e.NewState
+
+	for _, r := range d.routes {
+		// 保留中の通知は、その後に遷移した時点で古くなる
+		if h, ok := r.pending[e.Index]; ok {
+			h.timer.Stop()
+			delete(r.pending, e.Index)
+		}
+		if !r.config.matches(e) || d.hold(r, e) {
+			continue
+		}
+		r.enqueue(e)
+	}
+}
+
+// hold は同じ遷移をflap_window以内に通知済みの場合に通知を保留し、保留した場合はtrueを返します
+// 保留した通知は、間隔が過ぎた時点でその後の遷移がなければ送信します
+// 最後に通知した状態に戻っただけの場合は、保留していた通知とともに破棄します（d.muを保持して呼び出します）
+func (d *Dispatcher) hold(r *route, e Event) bool {
+	if r.flapWindow <= 0 {
+		return false
+	}
+	last, ok := r.sent[flapKey{e.Index, e.OldState, e.NewState}]
+	if !ok || e.Time.Sub(last) >= r.flapWindow {
+		return false
+	}
+	if r.notified[e.Index] == e.NewState {
+		return true
+	}
+
+	h := &held{event: e}
+	h.timer = time.AfterFunc(last.Add(r.flapWindow).Sub(e.Time), func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.closed || r.pending[e.Index] != h {
+			return
+		}
+		delete(r.pending, e.Index)
+		r.enqueue(e)
+	})
+	r.pending[e.Index] = h
+	return true
+}
+
+// enqueue は通知を送信待ちに加え、通知した遷移として記録します（d.muを保持して呼び出します）
+func (r *route) enqueue(e Event) {
+	r.sent[flapKey{e.Index, e.OldState, e.NewState}] = e.Time
+	r.notified[e.Index] = e.NewState
+	select {
+	case r.queue <- e:
+	default:
+		fmt.Fprintf(os.Stderr, "送信待ちの通知が多すぎるため破棄しました %s: %s\n", r.notifier.Name(), e.Target)
+	}
+}
+
+// Close は保留中の通知と送信待ちの通知をすべて送信してから終了します
+// ctxがキャンセルされた場合は再送を打ち切り、残りの通知を破棄します
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	for _, r := range d.routes {
+		// 保留中の通知は終了時点の状態なので、間隔を待たずに送信する
+		for index, h := range r.pending {
+			h.timer.Stop()
+			delete(r.pending, index)
+			r.enqueue(h.event)
+		}
+		close(r.queue)
+	}
+	d.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return fmt.Errorf("送信できなかった通知があります: %v", ctx.Err())
+	}
+}
+
+// deliver は通知を送信し、失敗した場合は間隔を2倍にしながら再送します
+func (r *route) deliver(ctx context.Context, e Event) {
+	wait := r.retryInterval
+	for attempt := 1; ; attempt++ {
+		err := r.notifier.Notify(ctx, e)
+		if err == nil {
+			return
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= r.attempts || ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "通知の送信に失敗しました %s（%d回目）: %v\n", r.notifier.Name(), attempt, err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
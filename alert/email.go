@@ -0,0 +1,309 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pingood/monitor"
+)
+
+// SMTPサーバーとの通信の暗号化方式
+const (
+	EmailTLSStartTLS = "starttls" // 平文で接続してSTARTTLSで暗号化する（デフォルト、587番ポート）
+	EmailTLSImplicit = "tls"      // 接続時からTLSで暗号化する（465番ポート）
+	EmailTLSNone     = "none"     // 暗号化しない（社内のリレーサーバーなど）
+)
+
+// メール通知のデフォルト値
+const (
+	DefaultEmailPort       = 587
+	DefaultEmailErrorLines = 10
+	DefaultEmailTimeout    = 30 * time.Second
+)
+
+// EmailConfig は状態の遷移をメールで通知するSMTPサーバー（[[alerts.email]]）の設定です
+type EmailConfig struct {
+	Name       string   `toml:"name"`        // ログに表示する名前（省略した場合はhost）
+	Host       string   `toml:"host"`        // SMTPサーバーのホスト名
+	Port       int      `toml:"port"`        // SMTPサーバーのポート（デフォルト: 587、tlsの場合は465）
+	TLS        string   `toml:"tls"`         // "starttls"（デフォルト）、"tls" または "none"
+	Username   string   `toml:"username"`    // SMTP認証のユーザー名（省略した場合は認証しない）
+	Password   string   `toml:"password"`    // SMTP認証のパスワード
+	From       string   `toml:"from"`        // 送信元のアドレス
+	To         []string `toml:"to"`          // 送信先のアドレス
+	ErrorLines int      `toml:"error_lines"` // 本文に含めるエラーログの最後の行数（デフォルト: 10、-1の場合は含めない）
+	Timeout    string   `toml:"timeout"`     // 1回の送信のタイムアウト（デフォルト: 30s）
+	RouteConfig
+}
+
+// validate はメールの設定を検証します
+func (c EmailConfig) validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("hostを指定してください")
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("portが不正です: %d", c.Port)
+	}
+	switch c.TLS {
+	case "", EmailTLSStartTLS, EmailTLSImplicit, EmailTLSNone:
+	default:
+		return fmt.Errorf("tlsにはstarttls、tlsまたはnoneを指定してください: %s", c.TLS)
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("fromのアドレスが不正です: %s", c.From)
+	}
+	if len(c.To) == 0 {
+		return fmt.Errorf("toを指定してください")
+	}
+	for _, to := range c.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("toのアドレスが不正です: %s", to)
+		}
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("timeoutの形式が不正です（例: 30s）: %s", c.Timeout)
+		}
+	}
+	return c.RouteConfig.validate()
+}
+
+// route は通知する遷移の条件を返します
+// statesを省略した場合は、DOWNになったときと回復したとき（UP）のみ通知します
+func (c EmailConfig) route() RouteConfig {
+	r := c.RouteConfig
+	if len(r.States) == 0 {
+		r.States = []string{string(monitor.StateDown), string(monitor.StateUp)}
+	}
+	return r
+}
+
+// Email は状態の遷移をSMTPでメール送信します
+type Email struct {
+	config    EmailConfig
+	errorLog  ErrorLog
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	downMails map[string]downMail // ターゲットごとのDOWNを通知したメール（回復のメールをスレッドにまとめる）
+}
+
+// downMail はDOWNを通知したメールです
+type downMail struct {
+	messageID string
+	since     time.Time // 停止の原因となった最初の検査の時刻
+}
+
+// NewEmail は設定からEmailを作成します
+// errorLogがnilの場合は本文にエラーログを含めません
+func NewEmail(cfg EmailConfig, errorLog ErrorLog) (*Email, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = EmailTLSStartTLS
+	}
+	if cfg.Port == 0 {
+		cfg.Port = DefaultEmailPort
+		if cfg.TLS == EmailTLSImplicit {
+			cfg.Port = 465
+		}
+	}
+	if cfg.ErrorLines == 0 {
+		cfg.ErrorLines = DefaultEmailErrorLines
+	}
+	timeout := DefaultEmailTimeout
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &Email{
+		config:    cfg,
+		errorLog:  errorLog,
+		tlsConfig: &tls.Config{ServerName: cfg.Host},
+		timeout:   timeout,
+		downMails: make(map[string]downMail),
+	}, nil
+}
+
+// Name はログに表示する通知先の名前を返します
+func (m *Email) Name() string {
+	if m.config.Name != "" {
+		return "email " + m.config.Name
+	}
+	return "email " + m.config.Host
+}
+
+// Notify は遷移をメールで送信します
+// 5xxの応答（認証の失敗や宛先の拒否など）は再送しません
+func (m *Email) Notify(ctx context.Context, e Event) error {
+	msg, messageID := m.message(e, time.Now())
+	if err := m.send(ctx, msg); err != nil {
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	if e.NewState == monitor.StateDown {
+		m.downMails[e.Target] = downMail{messageID: messageID, since: e.Since}
+	} else {
+		delete(m.downMails, e.Target)
+	}
+	return nil
+}
+
+// send はSMTPサーバーに接続してメールを1通送信します
+func (m *Email) send(ctx context.Context, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if m.config.TLS == EmailTLSImplicit {
+		conn = tls.Client(conn, m.tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.config.TLS == EmailTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return Permanent(fmt.Errorf("SMTPサーバーがSTARTTLSに対応していません（暗号化しない場合はtls = \"none\"を指定してください）"))
+		}
+		if err := c.StartTLS(m.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	from, _ := mail.ParseAddress(m.config.From)
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range m.config.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := c.Rcpt(addr.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// outage はDOWNから回復した遷移の場合に停止時間を返します
+// statesで除外したDEGRADEDを経由してUPになった場合は、DOWNのメールの開始からUPまでを停止時間とします
+func (m *Email) outage(e Event) (time.Duration, bool) {
+	if e.OldState == monitor.StateDown {
+		return e.Duration, true
+	}
+	if down, ok := m.downMails[e.Target]; ok && e.NewState == monitor.StateUp {
+		return e.Time.Sub(down.since), true
+	}
+	return 0, false
+}
+
+// subject はメールの件名を返します
+func (m *Email) subject(e Event) string {
+	if outage, ok := m.outage(e); ok {
+		return fmt.Sprintf("[pingood] %s: %sに回復しました（停止時間: %v）", e.Target, e.NewState, outage.Round(time.Second))
+	}
+	return fmt.Sprintf("[pingood] %s: %s", e.Target, e.NewState)
+}
+
+// body はメールの本文を返します
+func (m *Email) body(e Event) string {
+	var b strings.Builder
+	const layout = "2006-01-02 15:04:05 MST"
+	fmt.Fprintf(&b, "ターゲット: %s\n", e.Target)
+	fmt.Fprintf(&b, "状態: %s → %s\n", e.OldState, e.NewState)
+	fmt.Fprintf(&b, "時刻: %s\n", e.Time.Format(layout))
+	if outage, ok := m.outage(e); ok {
+		fmt.Fprintf(&b, "停止時間: %v（%sから）\n", outage.Round(time.Second), e.Time.Add(-outage).Format(layout))
+	} else {
+		fmt.Fprintf(&b, "開始: %s（%v前）\n", e.Since.Format(layout), e.Duration.Round(time.Second))
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "最後のエラー: %s\n", e.Error)
+	}
+	if e.Reason != "" && e.Reason != e.Error {
+		fmt.Fprintf(&b, "理由: %s\n", e.Reason)
+	}
+
+	if m.errorLog != nil && m.config.ErrorLines > 0 {
+		lines, err := m.errorLog(e.Index, m.config.ErrorLines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラーログの読み込みに失敗しました %s: %v\n", e.Target, err)
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "\nエラーログの最後の%d行:\n", len(lines))
+			for _, line := range lines {
+				b.WriteString(line + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// message はヘッダーを含むメールの内容とMessage-IDを返します
+// 回復のメールはDOWNのメールへの返信としてスレッドにまとめます
+func (m *Email) message(e Event, now time.Time) ([]byte, string) {
+	from, _ := mail.ParseAddress(m.config.From)
+	messageID := fmt.Sprintf("<%s.%d@pingood>", e.ID, now.UnixNano())
+
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from.String())
+	header("To", strings.Join(m.config.To, ", "))
+	header("Subject", mime.QEncoding.Encode("UTF-8", m.subject(e)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	if parent, ok := m.downMails[e.Target]; ok && e.NewState != monitor.StateDown {
+		header("In-Reply-To", parent.messageID)
+		header("References", parent.messageID)
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=UTF-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(m.body(e), "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes(), messageID
+}
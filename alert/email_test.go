@@ -0,0 +1,367 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pingood/monitor"
+)
+
+// smtpMessage はテスト用のSMTPサーバーが受信したメールです
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+	user string // 認証したユーザー
+	tls  bool   // STARTTLSで暗号化していたか
+}
+
+// fakeSMTP はテスト用の最小限のSMTPサーバーです
+type fakeSMTP struct {
+	ln       net.Listener
+	tls      *tls.Config // nilの場合はSTARTTLSに対応しない
+	password string      // 空の場合は認証を要求しない
+	mu       sync.Mutex
+	sessions int
+	messages []smtpMessage
+}
+
+func newFakeSMTP(t *testing.T, tlsConfig *tls.Config, password string) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("SMTPサーバーの起動に失敗しました: %v", err)
+	}
+	s := &fakeSMTP{ln: ln, tls: tlsConfig, password: password}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// config はサーバーに接続するメールの設定を返します
+func (s *fakeSMTP) config(tlsMode string) EmailConfig {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	cfg := EmailConfig{
+		Host: host,
+		TLS:  tlsMode,
+		From: "pingood <pingood@example.com>",
+		To:   []string{"ops@example.com", "oncall@example.com"},
+	}
+	cfg.Port, _ = strconv.Atoi(port)
+	cfg.RetryInterval = "1ms"
+	return cfg
+}
+
+func (s *fakeSMTP) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.sessions++
+	s.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	var msg smtpMessage
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			ext := []string{"250-localhost", "250-8BITMIME"}
+			if s.tls != nil && !msg.tls {
+				ext = append(ext, "250-STARTTLS")
+			}
+			ext = append(ext, "250 AUTH PLAIN")
+			tp.PrintfLine("%s", strings.Join(ext, "\r\n"))
+		case "STARTTLS":
+			tp.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, msg.tls = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			_, resp, _ := strings.Cut(arg, " ")
+			b, _ := base64.StdEncoding.DecodeString(resp)
+			parts := strings.Split(string(b), "\x00")
+			if len(parts) != 3 || parts[2] != s.password {
+				tp.PrintfLine("535 5.7.8 Authentication failed")
+				continue
+			}
+			msg.user = parts[1]
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			if s.password != "" && msg.user == "" {
+				tp.PrintfLine("530 5.7.0 Authentication required")
+				continue
+			}
+			msg.from = smtpPath(arg, "FROM:")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, smtpPath(arg, "TO:"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// smtpPath はMAILとRCPTの引数からアドレスを取り出します（BODY=8BITMIMEなどのパラメーターは無視する）
+func smtpPath(arg, prefix string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(arg, prefix), " ")
+	return strings.Trim(path, "<>")
+}
+
+// testCertificate はテスト用に127.0.0.1の自己署名証明書を生成します
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("鍵の生成に失敗しました: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("証明書の生成に失敗しました: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// parseMail は受信したメールの件名と本文を返します
+func parseMail(t *testing.T, data string) (*mail.Message, string, string) {
+	t.Helper()
+	m, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatalf("メールの解析に失敗しました: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("件名の解析に失敗しました: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatalf("本文の解析に失敗しました: %v", err)
+	}
+	return m, subject, string(body)
+}
+
+// sendEmail はメールの通知先に遷移を送信し、送信が完了するまで待ちます
+func sendEmail(t *testing.T, m *Email, transitions ...monitor.Transition) {
+	t.Helper()
+	d := NewDispatcher()
+	d.Add(m, m.config.route())
+	for _, tr := range transitions {
+		d.Send(tr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("Closeに失敗しました: %v", err)
+	}
+}
+
+func TestEmailDownAndRecovery(t *testing.T) {
+	s := newFakeSMTP(t, nil, "secret")
+	cfg := s.config(EmailTLSNone)
+	cfg.Username, cfg.Password = "pingood", "secret"
+	cfg.ErrorLines = 2
+
+	var requested int
+	errorLog := func(index, n int) ([]string, error) {
+		requested = n
+		return []string{
+			"[2025-02-19 18:19:40] ERROR - Target: web, Error: request timed out",
+			"[2025-02-19 18:19:50] ERROR - Target: web, Error: request timed out",
+		}, nil
+	}
+	m, err := NewEmail(cfg, errorLog)
+	if err != nil {
+		t.Fatalf("NewEmailに失敗しました: %v", err)
+	}
+	sendEmail(t, m,
+		transition("web", monitor.StateUp, monitor.StateDown),
+		transition("web", monitor.StateDown, monitor.StateUp),
+		transition("web", monitor.StateUp, monitor.StateDown),
+		transition("web", monitor.StateDown, monitor.StateDegraded),
+		transition("web", monitor.StateDegraded, monitor.StateUp),
+	)
+
+	// statesを省略した場合はDOWNと回復のみ通知する
+	messages := s.received()
+	if len(messages) != 4 {
+		t.Fatalf("受信したメール = %d通, want 4", len(messages))
+	}
+	if messages[0].user != "pingood" || messages[0].from != "pingood@example.com" || strings.Join(messages[0].to, ",") != "ops@example.com,oncall@example.com" {
+		t.Errorf("エンベロープ = %+v", messages[0])
+	}
+	if requested != 2 {
+		t.Errorf("エラーログの行数 = %d, want 2", requested)
+	}
+
+	_, subject, body := parseMail(t, messages[0].data)
+	if subject != "[pingood] web: DOWN" {
+		t.Errorf("DOWNの件名 = %q", subject)
+	}
+	for _, want := range []string{"状態: UP → DOWN", "最後のエラー: request timed out", "エラーログの最後の2行:", "18:19:50] ERROR - Target: web"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("DOWNの本文に%qが含まれていません: %q", want, body)
+		}
+	}
+
+	recoveries := []struct {
+		down, up int
+		outage   string
+	}{
+		{0, 1, "5m30s"},
+		// DEGRADEDを経由した場合はDOWNの開始からUPまでを停止時間とする
+		{2, 3, "30s"},
+	}
+	for _, r := range recoveries {
+		down, _, _ := parseMail(t, messages[r.down].data)
+		up, subject, body := parseMail(t, messages[r.up].data)
+		if want := "[pingood] web: UPに回復しました（停止時間: " + r.outage + "）"; subject != want {
+			t.Errorf("回復の件名 = %q, want %q", subject, want)
+		}
+		if !strings.Contains(body, "停止時間: "+r.outage) {
+			t.Errorf("回復の本文に停止時間が含まれていません: %q", body)
+		}
+		// 回復のメールは直前のDOWNのメールへの返信にする
+		if got := up.Header.Get("In-Reply-To"); got == "" || got != down.Header.Get("Message-ID") {
+			t.Errorf("In-Reply-To = %q, want %q", got, down.Header.Get("Message-ID"))
+		}
+	}
+}
+
+func TestEmailStartTLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	s := newFakeSMTP(t, &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+
+	m, err := NewEmail(s.config(EmailTLSStartTLS), nil)
+	if err != nil {
+		t.Fatalf("NewEmailに失敗しました: %v", err)
+	}
+	m.tlsConfig.RootCAs = pool
+	sendEmail(t, m, transition("web", monitor.StateUp, monitor.StateDown))
+
+	messages := s.received()
+	if len(messages) != 1 || !messages[0].tls {
+		t.Errorf("STARTTLSで送信されていません: %+v", messages)
+	}
+}
+
+func TestEmailPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		tls      *tls.Config
+		password string
+		tlsMode  string
+	}{
+		// STARTTLSに対応していないサーバーに平文で送信しない
+		{"NoStartTLS", nil, "", EmailTLSStartTLS},
+		{"AuthFailed", nil, "secret", EmailTLSNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSMTP(t, tt.tls, tt.password)
+			cfg := s.config(tt.tlsMode)
+			cfg.Username, cfg.Password = "pingood", "wrong"
+			m, err := NewEmail(cfg, nil)
+			if err != nil {
+				t.Fatalf("NewEmailに失敗しました: %v", err)
+			}
+			sendEmail(t, m, transition("web", monitor.StateUp, monitor.StateDown))
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if len(s.messages) != 0 || s.sessions != 1 {
+				t.Errorf("メール = %d通, 接続 = %d回, want 0通, 1回（再送しない）", len(s.messages), s.sessions)
+			}
+		})
+	}
+}
+
+func TestEmailConfigValidate(t *testing.T) {
+	valid := EmailConfig{Host: "smtp.example.com", From: "pingood@example.com", To: []string{"ops@example.com"}}
+	tests := []struct {
+		name    string
+		modify  func(c *EmailConfig)
+		wantErr bool
+	}{
+		{"Valid", func(c *EmailConfig) {}, false},
+		{"MissingHost", func(c *EmailConfig) { c.Host = "" }, true},
+		{"InvalidTLS", func(c *EmailConfig) { c.TLS = "ssl" }, true},
+		{"InvalidFrom", func(c *EmailConfig) { c.From = "pingood" }, true},
+		{"MissingTo", func(c *EmailConfig) { c.To = nil }, true},
+		{"InvalidTo", func(c *EmailConfig) { c.To = []string{"ops@example.com", "oncall"} }, true},
+		{"InvalidPort", func(c *EmailConfig) { c.Port = 70000 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			if err := (Config{Email: []EmailConfig{c}}).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// DefaultWebhookTimeout は1回の送信のタイムアウトのデフォルト値です
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookConfig は状態の遷移をPOSTするWebhook（[[alerts.webhooks]]）の設定です
+type WebhookConfig struct {
+	Name        string            `toml:"name"`         // ログに表示する名前（省略した場合はURLのホスト）
+	URL         string            `toml:"url"`          // 送信先のURL
+	Template    string            `toml:"template"`     // 本文のtext/template（省略した場合はJSONのペイロード）
+	ContentType string            `toml:"content_type"` // Content-Type（デフォルト: application/json）
+	Headers     map[string]string `toml:"headers"`      // 追加するヘッダー（認証トークンなど）
+	Timeout     string            `toml:"timeout"`      // 1回の送信のタイムアウト（デフォルト: 10s）
+	RouteConfig
+}
+
+// validate はWebhookの設定を検証します
+func (c WebhookConfig) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("urlにはhttp://またはhttps://のURLを指定してください: %s", c.URL)
+	}
+	if _, err := parseTemplate(c.Template); err != nil {
+		return err
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("timeoutの形式が不正です（例: 10s）: %s", c.Timeout)
+		}
+	}
+	return c.RouteConfig.validate()
+}
+
+// webhookPayload はテンプレートを指定しない場合に送信するJSONのペイロードです
+type webhookPayload struct {
+	ID              string  `json:"id"`
+	Target          string  `json:"target"`
+	OldState        string  `json:"old_state"`
+	NewState        string  `json:"new_state"`
+	Time            string  `json:"time"`
+	Since           string  `json:"since"`
+	Duration        string  `json:"duration"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+}
+
+// templateFuncs はテンプレートで使用できる関数です
+var templateFuncs = template.FuncMap{
+	// json は値をJSONとしてエンコードします（JSONの本文に文字列を埋め込む場合に使用）
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseTemplate は本文のテンプレートを解析します（空の場合はnil）
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New("webhook").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("templateの解析に失敗しました: %v", err)
+	}
+	return t, nil
+}
+
+// Webhook は状態の遷移をHTTPのPOSTで通知します
+type Webhook struct {
+	config   WebhookConfig
+	name     string
+	template *template.Template
+	client   *http.Client
+}
+
+// NewWebhook は設定からWebhookを作成します
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	tmpl, _ := parseTemplate(cfg.Template)
+	timeout := DefaultWebhookTimeout
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	name := cfg.Name
+	if name == "" {
+		u, _ := url.Parse(cfg.URL)
+		name = u.Host
+	}
+	return &Webhook{
+		config:   cfg,
+		name:     name,
+		template: tmpl,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Name はログに表示する通知先の名前を返します
+func (w *Webhook) Name() string {
+	return "webhook " + w.name
+}
+
+// body は送信する本文を作成します
+func (w *Webhook) body(e Event) ([]byte, error) {
+	if w.template != nil {
+		var buf bytes.Buffer
+		if err := w.template.Execute(&buf, e); err != nil {
+			return nil, fmt.Errorf("templateの実行に失敗しました: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(webhookPayload{
+		ID:              e.ID,
+		Target:          e.Target,
+		OldState:        string(e.OldState),
+		NewState:        string(e.NewState),
+		Time:            e.Time.Format(time.RFC3339),
+		Since:           e.Since.Format(time.RFC3339),
+		Duration:        e.Duration.Round(time.Second).String(),
+		DurationSeconds: e.Duration.Seconds(),
+		Error:           e.Error,
+		Reason:          e.Reason,
+	})
+}
+
+// Notify は遷移をPOSTします
+// 5xxと429の応答、通信エラーは再送し、それ以外の4xxの応答は再送しません
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := w.body(e)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	contentType := w.config.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "pingood")
+	// 受信側で再送による重複を取り除けるよう、遷移ごとの識別子を付ける
+	req.Header.Set("X-Pingood-Event-Id", e.ID)
+	for k, v := range w.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return Permanent(err)
+}
@@ -0,0 +1,366 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"pingood/monitor"
+)
+
+// webhookServer はテスト用に受信したリクエストを記録するWebhookの送信先です
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	statuses []int // 受信した順に返すステータス（足りない場合は200）
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	t.Helper()
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status := http.StatusOK
+		if n := len(s.requests); n < len(s.statuses) {
+			status = s.statuses[n]
+		}
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+// testIndexes はテスト用のターゲットのファイルインデックスです
+var testIndexes = map[string]int{"web": 0, "db": 1}
+
+// transition はテスト用の状態の遷移を返します
+func transition(target string, from, to monitor.State) monitor.Transition {
+	now := time.Date(2025, 2, 19, 18, 20, 0, 0, time.UTC)
+	t := monitor.Transition{
+		Job:  monitor.Job{Index: testIndexes[target], Target: target},
+		From: from,
+		To:   to,
+		Time: now,
+	}
+	switch to {
+	case monitor.StateDown:
+		t.Since = now.Add(-30 * time.Second)
+		t.Reason, t.LastError = "request timed out", "request timed out"
+	case monitor.StateUp:
+		t.Since = now.Add(-10 * time.Second)
+		t.Outage = 330 * time.Second
+		t.LastError = "request timed out"
+	}
+	return t
+}
+
+// after は遷移の時刻をdだけ後にずらします
+func after(t monitor.Transition, d time.Duration) monitor.Transition {
+	t.Time = t.Time.Add(d)
+	t.Since = t.Since.Add(d)
+	return t
+}
+
+// dispatch はWebhookに遷移を送信し、送信が完了するまで待ちます
+func dispatch(t *testing.T, cfg WebhookConfig, transitions ...monitor.Transition) {
+	t.Helper()
+	d, err := New(Config{Webhooks: []WebhookConfig{cfg}}, nil)
+	if err != nil {
+		t.Fatalf("Newに失敗しました: %v", err)
+	}
+	for _, tr := range transitions {
+		d.Send(tr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("Closeに失敗しました: %v", err)
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	s := newWebhookServer(t)
+	dispatch(t, WebhookConfig{URL: s.URL, Headers: map[string]string{"Authorization": "Bearer token"}},
+		transition("web", monitor.StateUp, monitor.StateDown),
+		transition("web", monitor.StateDown, monitor.StateUp),
+	)
+
+	bodies := s.received()
+	if len(bodies) != 2 {
+		t.Fatalf("受信した通知 = %d件, want 2", len(bodies))
+	}
+	var down, up map[string]interface{}
+	json.Unmarshal([]byte(bodies[0]), &down)
+	json.Unmarshal([]byte(bodies[1]), &up)
+
+	for k, want := range map[string]interface{}{
+		"target":           "web",
+		"old_state":        "UP",
+		"new_state":        "DOWN",
+		"error":            "request timed out",
+		"duration":         "30s",
+		"duration_seconds": float64(30),
+		"since":            "2025-02-19T18:19:30Z",
+	} {
+		if down[k] != want {
+			t.Errorf("DOWN %s = %v, want %v", k, down[k], want)
+		}
+	}
+	// 回復した場合は停止時間と停止の原因を送信する
+	if up["new_state"] != "UP" || up["duration"] != "5m30s" || up["error"] != "request timed out" {
+		t.Errorf("UP = %v", up)
+	}
+
+	r := s.requests[0]
+	if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("ヘッダー = %v", r.Header)
+	}
+	if r.Header.Get("X-Pingood-Event-Id") != down["id"] || down["id"] == up["id"] {
+		t.Errorf("X-Pingood-Event-Id = %q, id = %v, %v", r.Header.Get("X-Pingood-Event-Id"), down["id"], up["id"])
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	s := newWebhookServer(t)
+	dispatch(t, WebhookConfig{
+		URL:      s.URL,
+		Template: `{"text": {{json (printf "%s is %s (%v): %s" .Target .NewState .Duration .Error)}}}`,
+	}, transition("web \"prod\"", monitor.StateUp, monitor.StateDown))
+
+	bodies := s.received()
+	want := `{"text": "web \"prod\" is DOWN (30s): request timed out"}`
+	if len(bodies) != 1 || bodies[0] != want {
+		t.Errorf("本文 = %q, want %q", bodies, want)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int // 送信回数
+	}{
+		{"Success", nil, 1},
+		{"RetryServerError", []int{500, 503}, 3},
+		{"RetryTooManyRequests", []int{429}, 2},
+		{"NoRetryClientError", []int{400}, 1},
+		{"GiveUp", []int{500, 500, 500, 500}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, tt.statuses...)
+			cfg := WebhookConfig{URL: s.URL}
+			cfg.Attempts, cfg.RetryInterval = 3, "1ms"
+			dispatch(t, cfg, transition("web", monitor.StateUp, monitor.StateDown))
+
+			if got := len(s.received()); got != tt.want {
+				t.Errorf("送信回数 = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookFilterAndDedup(t *testing.T) {
+	tests := []struct {
+		name        string
+		route       RouteConfig
+		transitions []monitor.Transition
+		want        int
+	}{
+		{"StartupUpSkipped", RouteConfig{}, []monitor.Transition{
+			transition("web", monitor.StateUnknown, monitor.StateUp),
+			transition("web", monitor.StateUnknown, monitor.StateDown),
+		}, 1},
+		{"TargetFilter", RouteConfig{Targets: []string{"db"}}, []monitor.Transition{
+			transition("web", monitor.StateUp, monitor.StateDown),
+			transition("db", monitor.StateUp, monitor.StateDown),
+		}, 1},
+		{"StateFilter", RouteConfig{States: []string{"DOWN", "UP"}}, []monitor.Transition{
+			transition("web", monitor.StateUp, monitor.StateDegraded),
+			transition("web", monitor.StateDegraded, monitor.StateDown),
+		}, 1},
+		{"Dedup", RouteConfig{States: []string{"DOWN", "UP"}}, []monitor.Transition{
+			transition("web", monitor.StateUp, monitor.StateDown),
+			transition("web", monitor.StateDown, monitor.StateDown),
+			transition("web", monitor.StateDown, monitor.StateUp),
+			// DEGRADEDを除外していても、DEGRADEDからの回復は通知する
+			transition("web", monitor.StateUp, monitor.StateDegraded),
+			transition("web", monitor.StateDegraded, monitor.StateUp),
+			transition("db", monitor.StateDegraded, monitor.StateUp),
+		}, 4},
+		// 除外したUPへの遷移を挟んだ2回目の障害も通知する
+		{"RepeatedOutage", RouteConfig{States: []string{"DOWN"}}, []monitor.Transition{
+			transition("web", monitor.StateUp, monitor.StateDown),
+			transition("web", monitor.StateDown, monitor.StateUp),
+			transition("web", monitor.StateUp, monitor.StateDown),
+		}, 2},
+		// 名前が同じでもファイルインデックスが異なるターゲットの障害はそれぞれ通知する
+		{"SameName", RouteConfig{}, []monitor.Transition{
+			transition("web", monitor.StateUp, monitor.StateDown),
+			func() monitor.Transition {
+				t := transition("web", monitor.StateUp, monitor.StateDown)
+				t.Job.Index = 2
+				return t
+			}(),
+		}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t)
+			dispatch(t, WebhookConfig{URL: s.URL, RouteConfig: tt.route}, tt.transitions...)
+			if got := len(s.received()); got != tt.want {
+				t.Errorf("通知 = %d件, want %d: %v", got, tt.want, s.received())
+			}
+		})
+	}
+}
+
+func TestWebhookFlapWindow(t *testing.T) {
+	down := transition("web", monitor.StateUp, monitor.StateDown)
+	up := transition("web", monitor.StateDown, monitor.StateUp)
+	tests := []struct {
+		name        string
+		flapWindow  string
+		transitions []monitor.Transition
+		want        []monitor.State
+	}{
+		{"NoWindow", "", []monitor.Transition{
+			down, after(up, time.Minute), after(down, 2*time.Minute), after(up, 3*time.Minute),
+		}, []monitor.State{monitor.StateDown, monitor.StateUp, monitor.StateDown, monitor.StateUp}},
+		// 間隔内に最後に通知した状態へ戻った場合は、繰り返した遷移を通知しない
+		{"Flapping", "10m", []monitor.Transition{
+			down, after(up, time.Minute), after(down, 2*time.Minute), after(up, 3*time.Minute),
+		}, []monitor.State{monitor.StateDown, monitor.StateUp}},
+		// 保留した障害が続いている場合は、終了時（または間隔が過ぎた時点）に通知する
+		{"HeldOutage", "10m", []monitor.Transition{
+			down, after(up, time.Minute), after(down, 2*time.Minute),
+		}, []monitor.State{monitor.StateDown, monitor.StateUp, monitor.StateDown}},
+		{"AfterWindow", "10m", []monitor.Transition{
+			down, after(up, time.Minute), after(down, 11*time.Minute),
+		}, []monitor.State{monitor.StateDown, monitor.StateUp, monitor.StateDown}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t)
+			cfg := WebhookConfig{URL: s.URL}
+			cfg.FlapWindow = tt.flapWindow
+			dispatch(t, cfg, tt.transitions...)
+
+			var got []monitor.State
+			for _, body := range s.received() {
+				var p struct {
+					NewState monitor.State `json:"new_state"`
+				}
+				if err := json.Unmarshal([]byte(body), &p); err != nil {
+					t.Fatalf("通知の本文を読み込めません: %v", err)
+				}
+				got = append(got, p.NewState)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("通知した状態 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloseGivesUpAfterTimeout(t *testing.T) {
+	s := newWebhookServer(t, 500, 500, 500)
+	cfg := WebhookConfig{URL: s.URL}
+	cfg.RetryInterval = "1h"
+	d, err := New(Config{Webhooks: []WebhookConfig{cfg}}, nil)
+	if err != nil {
+		t.Fatalf("Newに失敗しました: %v", err)
+	}
+	d.Send(transition("web", monitor.StateUp, monitor.StateDown))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := d.Close(ctx); err == nil {
+		t.Error("Close() error = nil, want timeout")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Closeに%vかかりました", time.Since(start))
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		toml    string
+		wantErr bool
+	}{
+		{"Valid", `
+[[webhooks]]
+url = "https://hooks.example.com/x"
+targets = ["web"]
+states = ["DOWN", "UP"]
+attempts = 5
+retry_interval = "10s"
+flap_window = "10m"
+template = '{"text": {{json .Target}}}'
+`, false},
+		{"InvalidURL", `
+[[webhooks]]
+url = "hooks.example.com"
+`, true},
+		{"InvalidState", `
+[[webhooks]]
+url = "https://hooks.example.com/x"
+states = ["down"]
+`, true},
+		{"InvalidTemplate", `
+[[webhooks]]
+url = "https://hooks.example.com/x"
+template = "{{.Target"
+`, true},
+		{"InvalidRetryInterval", `
+[[webhooks]]
+url = "https://hooks.example.com/x"
+retry_interval = "5"
+`, true},
+		{"InvalidFlapWindow", `
+[[webhooks]]
+url = "https://hooks.example.com/x"
+flap_window = "-1m"
+`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			if _, err := toml.Decode(tt.toml, &cfg); err != nil {
+				t.Fatalf("TOMLの解析に失敗しました: %v", err)
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.name == "Valid" && (cfg.Webhooks[0].Attempts != 5 || len(cfg.Webhooks[0].States) != 2) {
+				t.Errorf("埋め込みの設定が読み込まれていません: %+v", cfg.Webhooks[0])
+			}
+		})
+	}
+}
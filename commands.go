@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pingood/logger"
+)
+
+// subcommands は監視以外の処理を行うサブコマンドの一覧です
+var subcommands = map[string]func(args []string) error{
+	"reassemble":       runReassemble,
+	"verify":           runVerify,
+	"keygen":           runKeygen,
+	"verify-signature": runVerifySignature,
+	"verify-manifest":  runVerifyManifest,
+}
+
+// runReassemble はupload_mode = "incremental"でアップロードしたパートを連結し、1つのログファイルに復元します
+func runReassemble(args []string) error {
+	fs := flag.NewFlagSet("reassemble", flag.ExitOnError)
+	configPath := fs.String("config", "config.toml", "Path to config.toml with S3 settings")
+	name := fs.String("log", "", "Log file path to reassemble, as given when uploading (e.g. example.com.log or logs/web/example.com.error.log)")
+	out := fs.String("o", "", "Output file path (default: stdout)")
+	fs.Parse(args)
+
+	if *name == "" {
+		fs.Usage()
+		return fmt.Errorf("-log is required")
+	}
+
+	config, err := logger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if err := config.S3.Validate(); err != nil {
+		return err
+	}
+	uploader, err := logger.NewS3Uploader(config.S3)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("出力ファイルの作成に失敗しました: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := uploader.Reassemble(context.Background(), *name, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d個のパートを連結しました\n", n)
+	return nil
+}
+
+// runVerify はhash_chain = trueで記録したログファイルのハッシュチェーンを検証し、行の編集、削除、並べ替えを検出します
+// 複数のファイルやディレクトリを指定した場合は、ローテーション済みのファイルのつながりも検証します
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	prev := fs.String("prev", "", "Hash of the line before the first line (default: the CHAIN line of a rotated file, or the genesis hash)")
+	head := fs.String("head", "", "Expected hash of the last line (e.g. the chain-head metadata of the uploaded object)")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("log file or directory is required")
+	}
+	paths, err := chainFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(paths) == 1 {
+		return verifyChainFile(paths[0], *prev, *head)
+	}
+	if *prev != "" || *head != "" {
+		return fmt.Errorf("-prev and -head can be used with a single log file only")
+	}
+
+	chains, failed := logger.VerifyChainFiles(paths)
+	for _, f := range failed {
+		fmt.Printf("NG %s: %v\n", f.Path, f.Err)
+	}
+	for i, chain := range chains {
+		fmt.Printf("チェーン%d:", i+1)
+		if chain[0].Prev != logger.ChainGenesis {
+			fmt.Printf(" 直前のファイル（chain-head %s）は指定されていません", chain[0].Prev)
+		}
+		fmt.Println()
+		for _, f := range chain {
+			fmt.Printf("OK %s: %d行, chain-head %s\n", f.Path, f.Lines, f.Head)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d個のファイルの検証に失敗しました", len(failed))
+	}
+	return nil
+}
+
+// verifyChainFile は1つのログファイルのハッシュチェーンを検証し、結果を表示します
+func verifyChainFile(path, prev, head string) error {
+	lines, last, err := logger.VerifyChainFile(path, prev)
+	if err == nil && head != "" && last != head {
+		err = fmt.Errorf("最後の行のハッシュが一致しません（末尾の行が削除された可能性があります）: expected %s, got %s", head, last)
+	}
+	if err != nil {
+		fmt.Printf("NG %s: %v\n", path, err)
+		return fmt.Errorf("1個のファイルの検証に失敗しました")
+	}
+	fmt.Printf("OK %s: %d行, chain-head %s\n", path, lines, last)
+	return nil
+}
+
+// chainFiles は検証するファイルの一覧を返します
+// ディレクトリはその中のファイル（隠しファイルと署名ファイル、マニフェストを除く）に展開します
+func chainFiles(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".sig") || strings.HasPrefix(name, "manifest_") {
+				continue
+			}
+			paths = append(paths, filepath.Join(arg, name))
+		}
+	}
+	return paths, nil
+}
+
+// runKeygen はアップロードするオブジェクトに署名するEd25519の鍵ペアを生成します
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("o", "pingood.key", "Path to write the private key (the public key is written to <path>.pub)")
+	fs.Parse(args)
+
+	pubPath, err := logger.GenerateSigningKey(*out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("秘密鍵を%sに保存しました（config.tomlのsigning_keyに指定してください）\n", *out)
+	fmt.Printf("公開鍵を%sに保存しました（検証する相手に渡してください）\n", pubPath)
+	return nil
+}
+
+// runVerifySignature はダウンロードしたログファイルを署名ファイル（.sig）と公開鍵で検証します
+func runVerifySignature(args []string) error {
+	fs := flag.NewFlagSet("verify-signature", flag.ExitOnError)
+	pubPath := fs.String("pubkey", "pingood.key.pub", "Path to the public key generated by pingood keygen")
+	sigPath := fs.String("sig", "", "Path to the detached signature (default: <log file>.sig)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("exactly one log file is required")
+	}
+	path := fs.Arg(0)
+	if *sigPath == "" {
+		*sigPath = path + ".sig"
+	}
+
+	pub, err := logger.LoadVerifyKey(*pubPath)
+	if err != nil {
+		return err
+	}
+	statement, err := logger.VerifySignatureFile(pub, path, *sigPath)
+	if err != nil {
+		fmt.Printf("NG %s: %v\n", path, err)
+		return fmt.Errorf("署名の検証に失敗しました")
+	}
+	fmt.Printf("OK %s: 署名を確認しました, key %s, uploaded %s\n", path, statement.Key, statement.Uploaded.Local().Format(time.RFC3339))
+	if statement.ChainHead != "" {
+		fmt.Printf("  chain-head %s\n", statement.ChainHead)
+	}
+	return nil
+}
+
+// runVerifyManifest はアップロードごとのマニフェストを公開鍵で検証し、ダウンロードしたログファイルと照合します
+// ログファイルを指定した場合は、マニフェストに記載されたすべてのオブジェクトのファイルがあることも確認します
+func runVerifyManifest(args []string) error {
+	fs := flag.NewFlagSet("verify-manifest", flag.ExitOnError)
+	pubPath := fs.String("pubkey", "pingood.key.pub", "Path to the public key generated by pingood keygen")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("manifest file is required")
+	}
+
+	pub, err := logger.LoadVerifyKey(*pubPath)
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(0)
+	m, err := logger.VerifyManifestFile(pub, path, fs.Args()[1:])
+	if err != nil {
+		fmt.Printf("NG %s: %v\n", path, err)
+		return fmt.Errorf("マニフェストの検証に失敗しました")
+	}
+	fmt.Printf("OK %s: 署名を確認しました, %d個のオブジェクト, uploaded %s\n", path, len(m.Entries), m.Uploaded.Local().Format(time.RFC3339))
+	for _, e := range m.Entries {
+		fmt.Printf("  %s sha256 %s\n", e.Key, e.SHA256)
+		if e.ChainHead != "" {
+			fmt.Printf("    chain-head %s\n", e.ChainHead)
+		}
+	}
+	return nil
+}
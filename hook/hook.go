@@ -0,0 +1,247 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"pingood/monitor"
+)
+
+// DefaultTimeout は1回の実行のタイムアウトのデフォルト値です
+const DefaultTimeout = 30 * time.Second
+
+// maxOutput はログに記録するコマンドの出力の上限です
+const maxOutput = 16 << 10
+
+// フックの名前
+const (
+	OnDown = "on_down" // DOWNになったとき
+	OnUp   = "on_up"   // UPになったとき
+)
+
+// Config は状態の遷移で実行するコマンド（[hooks]）の設定です
+type Config struct {
+	OnDown  string `toml:"on_down"` // DOWNになったときに実行するコマンド
+	OnUp    string `toml:"on_up"`   // DOWNからUPに回復したときに実行するコマンド（DEGRADEDを経由した場合も含む）
+	Timeout string `toml:"timeout"` // 1回の実行のタイムアウト（デフォルト: 30s）
+}
+
+// Validate はフックの設定を検証します
+func (c Config) Validate() error {
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("timeoutの形式が不正です（例: 30s、1m）: %s", c.Timeout)
+		}
+	}
+	return nil
+}
+
+// TimeoutDuration は1回の実行のタイムアウトを返します
+func (c Config) TimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(c.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTimeout
+}
+
+// Command は遷移で実行するフックの名前とコマンドを返します（実行しない場合は空文字列）
+// recoveringはDOWNになってからUPに戻っていないかで、on_upはDOWNから回復した場合のみ実行します
+// （起動直後のUPや、DOWNにならずにDEGRADEDからUPに戻った場合は実行しません）
+func (c Config) Command(t monitor.Transition, recovering bool) (name, command string) {
+	switch {
+	case t.To == monitor.StateDown && c.OnDown != "":
+		return OnDown, c.OnDown
+	case t.To == monitor.StateUp && recovering && c.OnUp != "":
+		return OnUp, c.OnUp
+	}
+	return "", ""
+}
+
+// Env はフックに渡す環境変数を返します
+func Env(name string, t monitor.Transition) []string {
+	env := []string{
+		"PINGOOD_HOOK=" + name,
+		"PINGOOD_TARGET=" + t.Job.Target,
+		"PINGOOD_ADDRESS=" + t.Job.Address,
+		"PINGOOD_STATE=" + string(t.To),
+		"PINGOOD_PREVIOUS_STATE=" + string(t.From),
+		"PINGOOD_TIME=" + t.Time.Format(time.RFC3339),
+		"PINGOOD_SINCE=" + t.Since.Format(time.RFC3339),
+		"PINGOOD_ERROR=" + t.LastError,
+		"PINGOOD_REASON=" + t.Reason,
+	}
+	if t.Outage > 0 {
+		env = append(env, fmt.Sprintf("PINGOOD_OUTAGE=%d", int64(t.Outage.Seconds())))
+	}
+	return env
+}
+
+// Result はフックの実行結果です
+type Result struct {
+	Job       monitor.Job
+	Name      string        // フックの名前（on_downまたはon_up）
+	Command   string        // 実行したコマンド
+	Time      time.Time     // 実行を開始した時刻
+	Duration  time.Duration // 実行にかかった時間
+	ExitCode  int           // 終了コード（終了しなかった場合は-1）
+	Output    string        // 標準出力と標準エラー出力（maxOutputを超えた部分は含めない）
+	Truncated bool          // 出力がmaxOutputを超えたか
+	Err       error         // 終了コードが0以外の場合、タイムアウトした場合、実行できなかった場合のエラー
+}
+
+// Runner は状態の遷移でフックを実行します
+// フックはgoroutineで実行するため、時間のかかるコマンドが検査を遅らせることはありません
+type Runner struct {
+	configs []Config // ジョブのインデックスごとの設定
+	log     func(Result)
+	mu      sync.Mutex
+	outages map[int]time.Duration // DOWNになってからUPに戻っていないジョブと、DOWNから抜けた時点の停止時間
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewRunner はジョブのインデックスごとの設定からRunnerを作成します
+// logは実行が終わるたびに結果を受け取ります（複数のgoroutineから呼び出されます）
+func NewRunner(configs []Config, log func(Result)) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{configs: configs, log: log, outages: make(map[int]time.Duration), ctx: ctx, cancel: cancel}
+}
+
+// Len はフックを設定したターゲットの数を返します
+func (r *Runner) Len() int {
+	n := 0
+	for _, c := range r.configs {
+		if c.OnDown != "" || c.OnUp != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Run は遷移に対応するフックがあれば実行を開始します
+func (r *Runner) Run(t monitor.Transition) {
+	if t.Job.Index < 0 || t.Job.Index >= len(r.configs) {
+		return
+	}
+	r.mu.Lock()
+	outage, recovering := r.outages[t.Job.Index]
+	switch {
+	case t.To == monitor.StateDown:
+		r.outages[t.Job.Index] = 0
+	case t.To == monitor.StateUp:
+		delete(r.outages, t.Job.Index)
+	case recovering && t.From == monitor.StateDown:
+		r.outages[t.Job.Index] = t.Outage
+	}
+	r.mu.Unlock()
+	// DEGRADEDを経由して回復した場合は、DOWNから抜けた時点の停止時間を渡す
+	if t.To == monitor.StateUp && recovering && t.From != monitor.StateDown {
+		t.Outage = outage
+	}
+
+	c := r.configs[t.Job.Index]
+	name, command := c.Command(t, recovering)
+	if command == "" {
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.log(run(r.ctx, c.TimeoutDuration(), name, command, t))
+	}()
+}
+
+// Close は実行中のフックの終了を待ちます
+// ctxがキャンセルされた場合は実行中のフックを強制終了します
+func (r *Runner) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+		return fmt.Errorf("実行中のフックを強制終了しました: %v", ctx.Err())
+	}
+}
+
+// run はコマンドをシェルで実行し、出力を記録します
+func run(ctx context.Context, timeout time.Duration, name, command string, t monitor.Transition) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	setProcessGroup(cmd)
+	cmd.Env = append(os.Environ(), Env(name, t)...)
+	var out limitedBuffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// コマンドが起動したプロセスが出力を開いたままでも待ち続けない
+	cmd.WaitDelay = time.Second
+
+	res := Result{Job: t.Job, Name: name, Command: command, Time: time.Now(), ExitCode: -1}
+	err := cmd.Run()
+	res.Duration = time.Since(res.Time)
+	res.Output = strings.TrimRight(out.String(), "\r\n")
+	res.Truncated = out.truncated
+	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		res.Err = fmt.Errorf("timed out after %v", timeout)
+	case err != nil:
+		res.Err = err
+	}
+	return res
+}
+
+// shellCommand はOSに応じたシェルでコマンドを実行するexec.Cmdを返します
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
+
+// limitedBuffer はmaxOutputまでの出力を保持し、残りは破棄します
+// 書き込みのエラーでコマンドが停止しないよう、破棄した場合も成功を返します
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       strings.Builder
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if rest := maxOutput - b.buf.Len(); len(p) > rest {
+		b.buf.Write(p[:rest])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
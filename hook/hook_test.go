@@ -0,0 +1,220 @@
+package hook
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/monitor"
+)
+
+// transition はテスト用の状態の遷移を返します
+func transition(from, to monitor.State) monitor.Transition {
+	now := time.Date(2025, 2, 19, 18, 20, 0, 0, time.UTC)
+	return monitor.Transition{
+		Job:       monitor.Job{Index: 0, Target: "web", Address: "example.com"},
+		From:      from,
+		To:        to,
+		Time:      now,
+		Since:     now.Add(-30 * time.Second),
+		Reason:    "request timed out",
+		LastError: "request timed out",
+	}
+}
+
+// runHook は遷移を順にRunnerに渡してフックを実行し、結果を返します
+func runHook(t *testing.T, cfg Config, transitions ...monitor.Transition) []Result {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("/bin/shが必要です")
+	}
+	results := make(chan Result, len(transitions))
+	r := NewRunner([]Config{cfg}, func(res Result) { results <- res })
+	for _, tr := range transitions {
+		r.Run(tr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Closeに失敗しました: %v", err)
+	}
+	close(results)
+	var got []Result
+	for res := range results {
+		got = append(got, res)
+	}
+	return got
+}
+
+func TestConfigCommand(t *testing.T) {
+	cfg := Config{OnDown: "down.sh", OnUp: "up.sh"}
+	tests := []struct {
+		name       string
+		from, to   monitor.State
+		recovering bool
+		want       string
+	}{
+		{"Down", monitor.StateUp, monitor.StateDown, false, OnDown},
+		{"DownAtStartup", monitor.StateUnknown, monitor.StateDown, false, OnDown},
+		{"Up", monitor.StateDown, monitor.StateUp, true, OnUp},
+		{"UpFromDegradedAfterDown", monitor.StateDegraded, monitor.StateUp, true, OnUp},
+		// DOWNにならなかった場合は実行しない
+		{"UpFromDegraded", monitor.StateDegraded, monitor.StateUp, false, ""},
+		// 起動直後にUPと判定した場合は実行しない
+		{"UpAtStartup", monitor.StateUnknown, monitor.StateUp, false, ""},
+		{"Degraded", monitor.StateDown, monitor.StateDegraded, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name, _ := cfg.Command(transition(tt.from, tt.to), tt.recovering); name != tt.want {
+				t.Errorf("Command() = %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnerEnvAndOutput(t *testing.T) {
+	results := runHook(t, Config{
+		OnDown: `echo "$PINGOOD_HOOK $PINGOOD_TARGET $PINGOOD_ADDRESS $PINGOOD_STATE $PINGOOD_PREVIOUS_STATE $PINGOOD_SINCE"; echo "$PINGOOD_ERROR" >&2; exit 3`,
+	}, transition(monitor.StateUp, monitor.StateDown))
+
+	if len(results) != 1 {
+		t.Fatalf("実行結果 = %d件, want 1", len(results))
+	}
+	res := results[0]
+	want := "on_down web example.com DOWN UP 2025-02-19T18:19:30Z\nrequest timed out"
+	if res.Output != want {
+		t.Errorf("Output = %q, want %q", res.Output, want)
+	}
+	// 0以外の終了コードはエラーとして記録する
+	if res.ExitCode != 3 || res.Err == nil || res.Name != OnDown || res.Job.Target != "web" {
+		t.Errorf("Result = %+v", res)
+	}
+}
+
+func TestRunnerOnUpAfterDown(t *testing.T) {
+	cfg := Config{OnDown: "echo down", OnUp: `echo "up $PINGOOD_PREVIOUS_STATE $PINGOOD_OUTAGE"`}
+	recovered := transition(monitor.StateDown, monitor.StateDegraded)
+	recovered.Outage = 330 * time.Second
+	tests := []struct {
+		name        string
+		transitions []monitor.Transition
+		want        []string
+	}{
+		// DOWNにならずにDEGRADEDからUPに戻った場合は実行しない
+		{"DegradedOnly", []monitor.Transition{
+			transition(monitor.StateUp, monitor.StateDegraded),
+			transition(monitor.StateDegraded, monitor.StateUp),
+		}, nil},
+		{"StartupDegraded", []monitor.Transition{
+			transition(monitor.StateUnknown, monitor.StateDegraded),
+			transition(monitor.StateDegraded, monitor.StateUp),
+		}, nil},
+		// DEGRADEDを経由した回復では、DOWNから抜けた時点の停止時間を渡す
+		{"RecoveredThroughDegraded", []monitor.Transition{
+			transition(monitor.StateUp, monitor.StateDown),
+			recovered,
+			transition(monitor.StateDegraded, monitor.StateUp),
+		}, []string{"down", "up DEGRADED 330"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, res := range runHook(t, cfg, tt.transitions...) {
+				got = append(got, res.Output)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("実行したフックの出力 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnerSkipsUnconfigured(t *testing.T) {
+	results := runHook(t, Config{OnDown: "true"}, transition(monitor.StateDown, monitor.StateUp))
+	if len(results) != 0 {
+		t.Errorf("実行結果 = %+v, want none", results)
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	start := time.Now()
+	results := runHook(t, Config{OnDown: "echo started; sleep 30", Timeout: "200ms"}, transition(monitor.StateUp, monitor.StateDown))
+
+	if len(results) != 1 {
+		t.Fatalf("実行結果 = %d件, want 1", len(results))
+	}
+	res := results[0]
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "timed out") || res.ExitCode != -1 {
+		t.Errorf("Result = %+v, want timeout", res)
+	}
+	// タイムアウトまでの出力は記録する
+	if res.Output != "started" {
+		t.Errorf("Output = %q, want %q", res.Output, "started")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("タイムアウトまでに%vかかりました", elapsed)
+	}
+}
+
+func TestRunnerTruncatesOutput(t *testing.T) {
+	results := runHook(t, Config{OnDown: "head -c 20000 /dev/zero | tr '\\0' a"}, transition(monitor.StateUp, monitor.StateDown))
+
+	if len(results) != 1 {
+		t.Fatalf("実行結果 = %d件, want 1", len(results))
+	}
+	if res := results[0]; len(res.Output) != maxOutput || !res.Truncated || res.Err != nil {
+		t.Errorf("Output = %d bytes, Truncated = %v, Err = %v", len(res.Output), res.Truncated, res.Err)
+	}
+}
+
+func TestCloseKillsRunningHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("/bin/shが必要です")
+	}
+	results := make(chan Result, 1)
+	r := NewRunner([]Config{{OnDown: "sleep 30", Timeout: "1m"}}, func(res Result) { results <- res })
+	r.Run(transition(monitor.StateUp, monitor.StateDown))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := r.Close(ctx); err == nil {
+		t.Error("Close() error = nil, want timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Closeに%vかかりました", elapsed)
+	}
+	// 強制終了した場合も実行結果を記録する
+	if res := <-results; res.Err == nil {
+		t.Errorf("Result = %+v, want error", res)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"Valid", Config{OnDown: "true", Timeout: "10s"}, false},
+		{"DefaultTimeout", Config{OnUp: "true"}, false},
+		{"InvalidTimeout", Config{Timeout: "10"}, true},
+		{"NegativeTimeout", Config{Timeout: "-1s"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package hook
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup はコマンドを新しいプロセスグループで実行し、タイムアウトした場合はグループ全体を強制終了します
+// シェルを終了してもコマンドが起動したプロセス（tcpdumpなど）が残らないようにします
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
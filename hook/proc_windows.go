@@ -0,0 +1,8 @@
+//go:build windows
+
+package hook
+
+import "os/exec"
+
+// setProcessGroup はWindowsでは何もしません（タイムアウトした場合はcmdのみを強制終了します）
+func setProcessGroup(cmd *exec.Cmd) {}
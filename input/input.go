@@ -1,6 +1,16 @@
 package input
 
-import "strings"
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// EnvPrefix はフラグの値を指定する環境変数の接頭辞です
+const EnvPrefix = "PINGOOD_"
 
 // ParseYesNoResponse は入力文字列をYes/Noの真偽値に変換します
 func ParseYesNoResponse(input string, defaultValue bool) bool {
@@ -15,3 +25,36 @@ func FormatYesNoPrompt(prompt string, defaultYes bool) string {
 	yesNo := map[bool]string{true: "Y/n", false: "y/N"}[defaultYes]
 	return prompt + " [" + yesNo + "]: "
 }
+
+// IsTerminal はファイルが端末（TTY）かを返します
+// systemdやコンテナで標準入力がパイプや/dev/nullの場合はfalseになります
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// EnvName はフラグ名に対応する環境変数の名前を返します（例: expect-status → PINGOOD_EXPECT_STATUS）
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv はコマンドラインで指定されていないフラグに、対応する環境変数の値を設定します
+// コマンドラインの値が環境変数より優先されます。環境変数の値が不正な場合はエラーを返します
+func ApplyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		value, ok := lookup(EnvName(f.Name))
+		if !ok {
+			return
+		}
+		if e := fs.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("環境変数%sの値が不正です: %v", EnvName(f.Name), e)
+		}
+	})
+	return err
+}
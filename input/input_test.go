@@ -1,6 +1,10 @@
 package input
 
-import "testing"
+import (
+	"flag"
+	"os"
+	"testing"
+)
 
 func TestParseYesNoResponse(t *testing.T) {
 	tests := []struct {
@@ -71,3 +75,76 @@ func TestFormatYesNoPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		flagName string
+		want     string
+	}{
+		{"target", "PINGOOD_TARGET"},
+		{"expect-status", "PINGOOD_EXPECT_STATUS"},
+		{"non-interactive", "PINGOOD_NON_INTERACTIVE"},
+	}
+
+	for _, tt := range tests {
+		if got := EnvName(tt.flagName); got != tt.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.flagName, got, tt.want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		env          map[string]string
+		wantTarget   string
+		wantInterval int
+		wantUpload   bool
+		wantErr      bool
+	}{
+		{"NoEnv", nil, nil, "", 5, false, false},
+		{"EnvOnly", nil, map[string]string{"PINGOOD_TARGET": "example.com", "PINGOOD_INTERVAL": "10", "PINGOOD_UPLOAD": "true"}, "example.com", 10, true, false},
+		{"FlagWins", []string{"-target", "flag.example.com"}, map[string]string{"PINGOOD_TARGET": "env.example.com"}, "flag.example.com", 5, false, false},
+		{"InvalidValue", nil, map[string]string{"PINGOOD_INTERVAL": "ten"}, "", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			target := fs.String("target", "", "")
+			interval := fs.Int("interval", 5, "")
+			upload := fs.Bool("upload", false, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			err := ApplyEnv(fs, func(key string) (string, bool) {
+				v, ok := tt.env[key]
+				return v, ok
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *target != tt.wantTarget || *interval != tt.wantInterval || *upload != tt.wantUpload {
+				t.Errorf("ApplyEnv() target=%q interval=%d upload=%v, want %q %d %v",
+					*target, *interval, *upload, tt.wantTarget, tt.wantInterval, tt.wantUpload)
+			}
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if IsTerminal(r) {
+		t.Error("IsTerminal(pipe) = true, want false")
+	}
+}
@@ -0,0 +1,391 @@
+package logger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChainGenesis はファイルの最初の行の直前のハッシュとして使用する値です
+const ChainGenesis = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// chainMetadataKey はアップロードしたオブジェクトのメタデータにチェーンの先頭（最後の行のハッシュ）を記録するキーです
+const chainMetadataKey = "chain-head"
+
+// ハッシュチェーンを付加する位置の目印（形式ごと）
+const (
+	chainTextSep  = ", Chain: "  // テキスト形式の行末に付加
+	chainJSONLSep = `,"chain":"` // JSON Lines形式のオブジェクトの最後のフィールドとして付加
+	chainCSVSep   = ","          // CSV形式の最後の列として付加
+)
+
+// chainHash は直前の行のハッシュと行の内容（ハッシュと改行を除く）からその行のハッシュを計算します
+func chainHash(prev, content string) string {
+	sum := sha256.Sum256([]byte(prev + "\n" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// sealLine はログ1行にハッシュを付加します
+// 形式は行の先頭の文字で判別します（テキスト形式は"["、JSON Lines形式は"{"、それ以外はCSV形式）
+func sealLine(line, hash string) string {
+	content := strings.TrimSuffix(line, "\n")
+	switch {
+	case strings.HasPrefix(content, "{") && strings.HasSuffix(content, "}"):
+		return content[:len(content)-1] + chainJSONLSep + hash + "\"}\n"
+	case strings.HasPrefix(content, "["):
+		return content + chainTextSep + hash + "\n"
+	default:
+		return content + chainCSVSep + hash + "\n"
+	}
+}
+
+// splitLine はハッシュを付加した行（改行を除く）を元の内容とハッシュに分けます
+func splitLine(line string) (content, hash string, ok bool) {
+	switch {
+	case strings.HasPrefix(line, "{"):
+		i := strings.LastIndex(line, chainJSONLSep)
+		if i < 0 || !strings.HasSuffix(line, "\"}") {
+			return "", "", false
+		}
+		content, hash = line[:i]+"}", line[i+len(chainJSONLSep):len(line)-2]
+	case strings.HasPrefix(line, "["):
+		i := strings.LastIndex(line, chainTextSep)
+		if i < 0 {
+			return "", "", false
+		}
+		content, hash = line[:i], line[i+len(chainTextSep):]
+	default:
+		i := strings.LastIndex(line, chainCSVSep)
+		if i < 0 {
+			return "", "", false
+		}
+		content, hash = line[:i], line[i+len(chainCSVSep):]
+	}
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+		return "", "", false
+	}
+	return content, hash, true
+}
+
+// chainSeed はCHAINの行（ハッシュを除く内容）から、直前のファイルの最後の行のハッシュを返します
+// 形式は行の先頭の文字で判別します（テキスト形式は"["、JSON Lines形式は"{"、それ以外はCSV形式）
+func chainSeed(content string) (string, bool) {
+	switch {
+	case strings.HasPrefix(content, "{"):
+		var r struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal([]byte(content), &r) != nil || r.Status != StatusChain {
+			return "", false
+		}
+		return r.Message, true
+	case strings.HasPrefix(content, "["):
+		_, prev, ok := strings.Cut(content, "] "+StatusChain+" - Prev: ")
+		return prev, ok
+	default:
+		fields, err := csv.NewReader(strings.NewReader(content)).Read()
+		if err != nil || len(fields) < len(csvHeader) || fields[2] != StatusChain {
+			return "", false
+		}
+		return fields[4], true
+	}
+}
+
+// maxSeedSize はヘッダーとCHAINの行のみのファイルとみなす最大のサイズです
+const maxSeedSize = 1 << 10
+
+// hasRecords はファイルにヘッダーとCHAINの行以外の行があるかを返します
+// ローテーション後に何も記録していないファイルは、CHAINの行があっても空のファイルとして扱います
+func hasRecords(path, header string, size int64) bool {
+	if size <= int64(len(header)) {
+		return false
+	}
+	if size > maxSeedSize {
+		return true
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return true
+	}
+	for _, line := range strings.Split(strings.TrimPrefix(string(data), header), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		content, _, ok := splitLine(line)
+		if !ok {
+			return true
+		}
+		if _, ok := chainSeed(content); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isHeaderLine はCSV形式のヘッダー行かを返します
+func isHeaderLine(line string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(line, utf8BOM), csvHeader[0]+",")
+}
+
+// lastChainHash はログの最後の行のハッシュを返します（ハッシュを付加した行がない場合はChainGenesis）
+func lastChainHash(r io.Reader) (string, error) {
+	head := ChainGenesis
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if _, hash, ok := splitLine(strings.TrimRight(line, "\r\n")); ok {
+			head = hash
+		}
+		if err == io.EOF {
+			return head, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// fileChainHead はファイルの最後の行のハッシュを返します（ファイルがない場合はChainGenesis）
+// 圧縮されたファイルは拡張子に応じて展開して読み込みます
+func fileChainHead(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ChainGenesis, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r, err := decompressReader(path, f)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	return lastChainHash(r)
+}
+
+// ChainError はハッシュチェーンの検証で見つかった不整合です
+type ChainError struct {
+	Line   int // 1から始まる行番号
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%d行目: %s", e.Line, e.Reason)
+}
+
+// VerifyChain はログのハッシュチェーンを先頭から検証し、検証した行数と最後の行のハッシュを返します
+// prevには最初の行の直前のハッシュを指定します
+// 空の場合は、最初の行がCHAINの行（ローテーション後のファイル）であればその行に記録された直前のファイルのハッシュ、なければChainGenesisを使用します
+// 行の編集、削除、並べ替え、CHAINの行とprevの不一致（直前のファイルと連続していない）は*ChainErrorを返します
+func VerifyChain(r io.Reader, prev string) (int, string, error) {
+	_, lines, head, err := verifyChain(r, prev)
+	return lines, head, err
+}
+
+// verifyChain はVerifyChainと同じ検証を行い、最初の行の直前のハッシュも返します
+func verifyChain(r io.Reader, prev string) (string, int, string, error) {
+	br := bufio.NewReader(r)
+	lines := 0
+	start := prev
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return start, lines, prev, err
+		}
+		text := strings.TrimRight(line, "\r\n")
+		switch {
+		case text == "":
+			// 空行と末尾は検証しない
+		case n == 1 && isHeaderLine(text):
+			// CSV形式のヘッダー行はチェーンに含まれない
+		default:
+			content, hash, ok := splitLine(text)
+			if !ok {
+				return start, lines, prev, &ChainError{Line: n, Reason: "ハッシュがありません"}
+			}
+			if lines == 0 {
+				seed, isSeed := chainSeed(content)
+				switch {
+				case isSeed && prev == "":
+					prev = seed
+				case isSeed && seed != prev:
+					return start, lines, prev, &ChainError{Line: n, Reason: fmt.Sprintf("直前のファイルの最後の行と連続していません: expected %s, got %s", prev, seed)}
+				case prev == "":
+					prev = ChainGenesis
+				}
+				start = prev
+			}
+			if want := chainHash(prev, content); hash != want {
+				return start, lines, prev, &ChainError{Line: n, Reason: fmt.Sprintf("ハッシュが一致しません（行の編集、削除または並べ替え）: expected %s, got %s", want, hash)}
+			}
+			prev = hash
+			lines++
+		}
+		if err == io.EOF {
+			if start == "" {
+				start, prev = ChainGenesis, ChainGenesis
+			}
+			return start, lines, prev, nil
+		}
+	}
+}
+
+// VerifyChainFile はログファイルのハッシュチェーンを検証します
+// 圧縮されたファイル（.gz、.zst）は展開して検証します
+func VerifyChainFile(path, prev string) (int, string, error) {
+	_, lines, head, err := verifyChainFile(path, prev)
+	return lines, head, err
+}
+
+// verifyChainFile はVerifyChainFileと同じ検証を行い、最初の行の直前のハッシュも返します
+func verifyChainFile(path, prev string) (string, int, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer f.Close()
+
+	r, err := decompressReader(path, f)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("ファイルの展開に失敗しました %s: %v", path, err)
+	}
+	defer r.Close()
+	return verifyChain(r, prev)
+}
+
+// ChainFile はVerifyChainFilesで検証したファイルです
+type ChainFile struct {
+	Path  string
+	Prev  string // 最初の行の直前のハッシュ（CHAINの行に記録された直前のファイルのハッシュ、なければChainGenesis）
+	Head  string // 最後の行のハッシュ
+	Lines int
+	Err   error // 検証に失敗した場合のエラー
+}
+
+// VerifyChainFiles は複数のログファイルのハッシュチェーンを検証し、ファイルのつながりごとに古い順に並べて返します
+// ローテーション後のファイルはCHAINの行に直前のファイルの最後の行のハッシュを記録しているため、
+// ファイル名や更新時刻に関係なく、あるファイルのPrevが別のファイルのHeadと一致すればその次のファイルとしてつなげます
+// 途中のファイルが削除された場合や、別のログファイルのファイルは別のつながりになります
+// 検証に失敗したファイルと、同じファイルに続くファイルが複数ある（分岐した）ファイルはfailedに返します
+func VerifyChainFiles(paths []string) (chains [][]ChainFile, failed []ChainFile) {
+	var files []ChainFile
+	for _, path := range paths {
+		f := ChainFile{Path: path}
+		f.Prev, f.Lines, f.Head, f.Err = verifyChainFile(path, "")
+		if f.Err != nil {
+			failed = append(failed, f)
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	// 同じファイルに続くファイルが複数ある場合は、どれが正しいか判断できない
+	next := make(map[string][]int)
+	for i, f := range files {
+		next[f.Prev] = append(next[f.Prev], i)
+	}
+	for prev, indexes := range next {
+		if prev == ChainGenesis || len(indexes) < 2 {
+			continue
+		}
+		for _, i := range indexes {
+			files[i].Err = fmt.Errorf("直前のファイルに続くファイルが複数あります（複製または改ざんされた可能性があります）: prev %s", prev)
+		}
+	}
+
+	heads := make(map[string]bool)
+	for _, f := range files {
+		if f.Err != nil {
+			failed = append(failed, f)
+			continue
+		}
+		heads[f.Head] = true
+	}
+	for _, start := range files {
+		// ChainGenesisから始まるファイルと、直前のファイルが指定されていないファイルがつながりの最初になる
+		if start.Err != nil || (start.Prev != ChainGenesis && heads[start.Prev]) {
+			continue
+		}
+		chain := []ChainFile{start}
+		for {
+			candidates := next[chain[len(chain)-1].Head]
+			if len(candidates) != 1 || files[candidates[0]].Err != nil || files[candidates[0]].Prev == ChainGenesis {
+				break
+			}
+			chain = append(chain, files[candidates[0]])
+		}
+		chains = append(chains, chain)
+	}
+	return chains, failed
+}
+
+// write はログファイルに1行を書き込みます
+// ハッシュチェーンが有効な場合は、直前の行のハッシュと行の内容から計算したハッシュを付加します
+// 呼び出し側でl.muをロックしておく必要があります
+func (l *Logger) write(file *os.File, logLine string) error {
+	if l.chains == nil {
+		_, err := file.WriteString(logLine)
+		return err
+	}
+
+	// 再起動後やローテーション後はファイルの最後の行から続ける
+	path := file.Name()
+	prev, ok := l.chains[path]
+	if !ok {
+		var err error
+		if prev, err = fileChainHead(path); err != nil {
+			return fmt.Errorf("ハッシュチェーンの読み込みに失敗しました %s: %v", path, err)
+		}
+	}
+
+	hash := chainHash(prev, strings.TrimSuffix(logLine, "\n"))
+	if _, err := file.WriteString(sealLine(logLine, hash)); err != nil {
+		// 書き込めた内容が不明なため、次の書き込みでファイルから読み直す
+		delete(l.chains, path)
+		return err
+	}
+	l.chains[path] = hash
+	return nil
+}
+
+// resetChain は作り直したファイルのハッシュチェーンを破棄し、次の書き込みでファイルから読み直すようにします
+// 呼び出し側でl.muをロックしておく必要があります
+func (l *Logger) resetChain(path string) {
+	if l.chains != nil {
+		delete(l.chains, path)
+	}
+}
+
+// seedChain はローテーション後の新しいファイルの最初の行として、移動したファイルの最後の行のハッシュをCHAINの行に書き込みます
+// 新しいファイルのチェーンはその行から続くため、ローテーション済みのファイルをまたいで行の削除や並べ替えを検出できます
+// 呼び出し側でl.muをロックしておく必要があります
+func (l *Logger) seedChain(file *os.File, segment string) error {
+	path := file.Name()
+	prev, ok := l.chains[path]
+	if !ok {
+		var err error
+		if prev, err = fileChainHead(segment); err != nil {
+			l.resetChain(path)
+			return fmt.Errorf("ハッシュチェーンの読み込みに失敗しました %s: %v", segment, err)
+		}
+	}
+	if prev == ChainGenesis {
+		l.resetChain(path)
+		return nil
+	}
+	l.chains[path] = prev
+	return l.write(file, l.formatter().format(Record{Timestamp: time.Now(), Status: StatusChain, Message: prev}))
+}
@@ -0,0 +1,297 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+// newChainLogger はテスト用にハッシュチェーンを有効にしたLoggerを生成し、数行を書き込みます
+func newChainLogger(t *testing.T, path string, f formatter) *Logger {
+	t.Helper()
+	file, err := openLogFile(path, f)
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	errorFile, err := openLogFile(getErrorLogFilePath(path), f)
+	if err != nil {
+		t.Fatalf("エラーログファイルのオープンに失敗しました: %v", err)
+	}
+	l := &Logger{
+		files:      []*os.File{file},
+		errorFiles: map[string]*os.File{path: errorFile},
+		paths:      []string{path},
+		config:     &Config{},
+		format:     f,
+		chains:     make(map[string]string),
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// writeChainLines はテスト用に成功、エラー、停止の行を書き込みます
+func writeChainLines(t *testing.T, l *Logger) {
+	t.Helper()
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now(), Warning: "slow, \"really\""}
+	for i := 0; i < 3; i++ {
+		if err := l.LogSuccess(0, "example.com", result); err != nil {
+			t.Fatalf("LogSuccessに失敗しました: %v", err)
+		}
+		if err := l.LogError(0, "example.com", fmt.Errorf("request timed out, Chain: forged")); err != nil {
+			t.Fatalf("LogErrorに失敗しました: %v", err)
+		}
+	}
+	if err := l.LogStopped(); err != nil {
+		t.Fatalf("LogStoppedに失敗しました: %v", err)
+	}
+}
+
+func TestSealLine(t *testing.T) {
+	hash := chainHash(ChainGenesis, "x")
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"Text", "[2025-02-19 18:14:27] SUCCESS - Target: example.com, RTT: 1ms\n"},
+		{"TextWithSeparator", "[2025-02-19 18:14:27] ERROR - Target: example.com, Error: a, Chain: b\n"},
+		{"JSONL", `{"seq":1,"status":"ERROR","error":"a,\"chain\":\"b"}` + "\n"},
+		{"CSV", "2025-02-19 18:14:27,example.com,ERROR,,\"a,b\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed := sealLine(tt.line, hash)
+			content, got, ok := splitLine(strings.TrimSuffix(sealed, "\n"))
+			if !ok {
+				t.Fatalf("splitLine(%q) ok = false", sealed)
+			}
+			if content != strings.TrimSuffix(tt.line, "\n") || got != hash {
+				t.Errorf("splitLine(%q) = %q, %q", sealed, content, got)
+			}
+		})
+	}
+}
+
+func TestHashChainDetectsTampering(t *testing.T) {
+	formats := map[string]formatter{
+		FormatText:  textFormatter{},
+		FormatJSONL: jsonlFormatter{},
+		FormatCSV:   csvFormatter{bom: true, chain: true},
+	}
+	tests := []struct {
+		name     string
+		tamper   func(lines []string) []string
+		wantLine int // 不整合が検出される行（本文の行番号、0の場合は検出されない）
+	}{
+		{"Intact", func(lines []string) []string { return lines }, 0},
+		{"Edited", func(lines []string) []string {
+			lines[2] = strings.Replace(lines[2], "example.com", "example.net", 1)
+			return lines
+		}, 3},
+		{"Removed", func(lines []string) []string { return append(lines[:1], lines[2:]...) }, 2},
+		{"Reordered", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 2},
+		{"FirstRemoved", func(lines []string) []string { return lines[1:] }, 1},
+	}
+
+	for format, f := range formats {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "example.com.log")
+				l := newChainLogger(t, path, f)
+				writeChainLines(t, l)
+
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("ログファイルの読み込みに失敗しました: %v", err)
+				}
+				header := f.header()
+				lines := strings.SplitAfter(strings.TrimPrefix(string(content), header), "\n")
+				lines = lines[:len(lines)-1]
+				if len(lines) != 7 {
+					t.Fatalf("行数 = %d, want 7", len(lines))
+				}
+				tampered := header + strings.Join(tt.tamper(lines), "")
+
+				n, _, err := VerifyChain(strings.NewReader(tampered), ChainGenesis)
+				if tt.wantLine == 0 {
+					if err != nil {
+						t.Fatalf("VerifyChain() error = %v", err)
+					}
+					if n != 7 {
+						t.Errorf("VerifyChain() = %d行, want 7", n)
+					}
+					return
+				}
+				wantLine := tt.wantLine
+				if header != "" {
+					wantLine++
+				}
+				var chainErr *ChainError
+				if !errors.As(err, &chainErr) || chainErr.Line != wantLine {
+					t.Errorf("VerifyChain() error = %v, want error at line %d", err, wantLine)
+				}
+			})
+		}
+	}
+}
+
+func TestHashChainMultilineError(t *testing.T) {
+	formats := map[string]formatter{
+		FormatText:  textFormatter{},
+		FormatJSONL: jsonlFormatter{},
+		FormatCSV:   csvFormatter{chain: true},
+	}
+	for format, f := range formats {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "example.com.log")
+			l := newChainLogger(t, path, f)
+			// 改行を含むエラーで1件の記録が複数行に分かれると、改ざんとして検出されてしまう
+			if err := l.LogError(0, "example.com", fmt.Errorf("unexpected response:\r\n<html>\n</html>")); err != nil {
+				t.Fatalf("LogErrorに失敗しました: %v", err)
+			}
+			writeChainLines(t, l)
+
+			n, _, err := VerifyChainFile(path, ChainGenesis)
+			if err != nil {
+				t.Fatalf("VerifyChainFile() error = %v", err)
+			}
+			if n != 8 {
+				t.Errorf("VerifyChainFile() = %d行, want 8", n)
+			}
+		})
+	}
+}
+
+func TestHashChainContinuesAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.com.log")
+	l := newChainLogger(t, path, textFormatter{})
+	writeChainLines(t, l)
+	l.Close()
+
+	// 再起動後は既存のファイルの最後の行から続ける
+	l = newChainLogger(t, path, textFormatter{})
+	writeChainLines(t, l)
+
+	for _, p := range []string{path, getErrorLogFilePath(path)} {
+		n, head, err := VerifyChainFile(p, ChainGenesis)
+		if err != nil {
+			t.Fatalf("VerifyChainFile(%s) error = %v", p, err)
+		}
+		if n == 0 || head != l.chains[p] {
+			t.Errorf("VerifyChainFile(%s) = %d行, %s, want head %s", p, n, head, l.chains[p])
+		}
+	}
+}
+
+func TestHashChainUploadMetadata(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, false)
+	l.chains = make(map[string]string)
+
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+	l.LogSuccess(0, "example.com", result)
+	head := l.chains[path]
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+
+	keys := fake.keys()
+	if len(keys) != 1 {
+		t.Fatalf("アップロードされたオブジェクト = %v, want 1", keys)
+	}
+	if got := fake.headers[keys[0]].Get("X-Amz-Meta-Chain-Head"); got != head {
+		t.Errorf("chain-headメタデータ = %q, want %q", got, head)
+	}
+}
+
+func TestHashChainContinuesAcrossRotation(t *testing.T) {
+	for _, f := range []formatter{textFormatter{}, jsonlFormatter{}, csvFormatter{chain: true}} {
+		t.Run(fmt.Sprintf("%T", f), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "example.com.log")
+			l := newChainLogger(t, path, f)
+			cut := func(stamp string) {
+				t.Helper()
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				if err := l.cut(0, stamp); err != nil {
+					t.Fatalf("cutに失敗しました: %v", err)
+				}
+			}
+			writeChainLines(t, l)
+			cut("2025-02-20")
+			writeChainLines(t, l)
+			cut("2025-02-21")
+			// 何も記録していないファイル（CHAINの行のみ）は切り替えない
+			cut("2025-02-22")
+			writeChainLines(t, l)
+
+			dir := filepath.Dir(path)
+			first := filepath.Join(dir, "example.com.2025-02-20.log")
+			second := filepath.Join(dir, "example.com.2025-02-21.log")
+			if fileExists(filepath.Join(dir, "example.com.2025-02-22.log")) {
+				t.Error("CHAINの行のみのファイルが切り替えられました")
+			}
+
+			// ローテーション後のファイルは単独でも、CHAINの行から検証できる
+			_, firstHead, err := VerifyChainFile(first, "")
+			if err != nil {
+				t.Fatalf("VerifyChainFile(%s) error = %v", first, err)
+			}
+			if _, _, err := VerifyChainFile(second, firstHead); err != nil {
+				t.Errorf("VerifyChainFile(%s) error = %v", second, err)
+			}
+			if _, _, err := VerifyChainFile(path, firstHead); err == nil {
+				t.Error("直前でないファイルのハッシュから検証できました")
+			}
+
+			// ファイル名の順序に関係なく、つながりの順に並べる
+			errorPath := getErrorLogFilePath(path)
+			chains, failed := VerifyChainFiles([]string{path, errorPath, second, getErrorLogFilePath(first), first, getErrorLogFilePath(second)})
+			if len(failed) > 0 {
+				t.Fatalf("VerifyChainFiles() failed = %+v", failed)
+			}
+			var got [][]string
+			for _, chain := range chains {
+				var paths []string
+				for _, f := range chain {
+					paths = append(paths, filepath.Base(f.Path))
+				}
+				got = append(got, paths)
+			}
+			want := [][]string{
+				{"example.com.2025-02-20.error.log", "example.com.2025-02-21.error.log", "example.com.error.log"},
+				{"example.com.2025-02-20.log", "example.com.2025-02-21.log", "example.com.log"},
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("VerifyChainFiles() = %v, want %v", got, want)
+			}
+
+			// 途中のファイルが削除された場合は、つながりが分かれる
+			chains, _ = VerifyChainFiles([]string{first, path})
+			if len(chains) != 2 || chains[1][0].Path != path || chains[1][0].Prev == ChainGenesis {
+				t.Errorf("VerifyChainFiles() = %+v, want 2 chains", chains)
+			}
+
+			// CHAINの行を削除した場合は検出する
+			data, _ := os.ReadFile(path)
+			lines := strings.SplitAfter(string(data), "\n")
+			start := 0
+			if f.header() != "" {
+				start = 1
+			}
+			tampered := filepath.Join(t.TempDir(), "example.com.log")
+			os.WriteFile(tampered, []byte(strings.Join(append(lines[:start:start], lines[start+1:]...), "")), 0644)
+			if _, _, err := VerifyChainFile(tampered, ""); err == nil {
+				t.Error("CHAINの行を削除したファイルの検証に成功しました")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+func TestUploadRecordsChecksum(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, false)
+
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+	l.LogSuccess(0, "example.com", result)
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+
+	segments, _ := listSegments(path, "")
+	if len(segments) != 1 {
+		t.Fatalf("ローテーション済みファイル = %v, want 1 file", segments)
+	}
+	content, err := os.ReadFile(segments[0])
+	if err != nil {
+		t.Fatalf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	sum := sha256.Sum256(content)
+
+	// チェックサムがS3に送信されている
+	keys := fake.keys()
+	if len(keys) != 1 {
+		t.Fatalf("アップロードされたオブジェクト = %v, want 1", keys)
+	}
+	if got := fake.headers[keys[0]].Get("X-Amz-Checksum-Sha256"); got == "" {
+		t.Errorf("チェックサムが送信されていません")
+	}
+
+	// アップロードの記録にハッシュが追記されている
+	f, err := os.Open(filepath.Join(filepath.Dir(path), ".pingood-spool", uploadLogName))
+	if err != nil {
+		t.Fatalf("アップロードの記録が存在しません: %v", err)
+	}
+	defer f.Close()
+	var records []uploadRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r uploadRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("アップロードの記録が不正です: %v", err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 1 {
+		t.Fatalf("アップロードの記録 = %d件, want 1", len(records))
+	}
+	r := records[0]
+	if r.Key != keys[0] || r.Source != segments[0] || r.Size != int64(len(content)) || r.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("アップロードの記録 = %+v", r)
+	}
+}
+
+func TestUploadVerifyFailureKeepsSegment(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, true)
+
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+	l.LogSuccess(0, "example.com", result)
+
+	// S3に保存された内容が送信した内容と異なる
+	fake.corrupt = true
+	if err := l.UploadNow(); err == nil {
+		t.Fatal("チェックサムの不一致がエラーになりません")
+	}
+	if got := l.Pending(); got != 1 {
+		t.Errorf("Pending() = %d, want 1", got)
+	}
+	// 確認できるまで元のファイルは削除しない
+	if segments, _ := listSegments(path, ""); len(segments) != 1 {
+		t.Errorf("確認できなかったファイルが残っていません: %v", segments)
+	}
+	if fileExists(filepath.Join(filepath.Dir(path), ".pingood-spool", uploadLogName)) {
+		t.Errorf("確認できなかったアップロードが記録されています")
+	}
+
+	fake.corrupt = false
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+	if segments, _ := listSegments(path, ""); len(segments) != 0 {
+		t.Errorf("再送後に残っているファイル = %v", segments)
+	}
+}
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// アップロード時の圧縮方式
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressionExt は圧縮方式に対応するキーの拡張子を返します
+func compressionExt(compression string) string {
+	switch compression {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// validateCompression は圧縮方式の設定値を検証します
+func validateCompression(compression string) error {
+	switch compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("不正な圧縮方式です（gzipまたはzstdを指定してください）: %s", compression)
+}
+
+// isCompressed はファイル名が圧縮済みのファイルを表すかを返します
+func isCompressed(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == compressionExt(CompressionGzip) || ext == compressionExt(CompressionZstd)
+}
+
+// compressPayload はrの内容を圧縮しながらdstに書き込みます
+// 内容をメモリ上に保持しないため、大きなファイルも圧縮できます
+func compressPayload(compression string, dst io.Writer, r io.Reader) error {
+	var w io.WriteCloser
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(dst)
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(dst)
+		if err != nil {
+			return err
+		}
+		w = zw
+	default:
+		return fmt.Errorf("不正な圧縮方式です: %s", compression)
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return fmt.Errorf("圧縮に失敗しました: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("圧縮に失敗しました: %v", err)
+	}
+	return nil
+}
+
+// decompressReader はキーの拡張子に応じて圧縮されたオブジェクトの内容を展開するReaderを返します
+func decompressReader(key string, r io.Reader) (io.ReadCloser, error) {
+	switch filepath.Ext(key) {
+	case compressionExt(CompressionGzip):
+		return gzip.NewReader(r)
+	case compressionExt(CompressionZstd):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// contentType はキーの拡張子からContent-Typeを返します
+// 圧縮したオブジェクトは、ダウンロード時に自動で展開されないようContent-Encodingを付けずに圧縮形式のContent-Typeとします
+func contentType(key string) string {
+	switch strings.ToLower(filepath.Ext(key)) {
+	case ".csv":
+		return "text/csv; charset=utf-8"
+	case ".jsonl", ".ndjson":
+		return "application/x-ndjson"
+	case ".json":
+		return "application/json"
+	case ".gz":
+		return "application/gzip"
+	case ".zst":
+		return "application/zstd"
+	}
+	return "text/plain; charset=utf-8"
+}
@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+func TestCompressPayload(t *testing.T) {
+	content := strings.Repeat("[2025-02-20 15:04:05] SUCCESS - Target: example.com, RTT: 12ms\n", 100)
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			var body bytes.Buffer
+			if err := compressPayload(compression, &body, strings.NewReader(content)); err != nil {
+				t.Fatalf("compressPayload() error = %v", err)
+			}
+			if body.Len() >= len(content)/10 {
+				t.Errorf("compressed size = %d, want much smaller than %d", body.Len(), len(content))
+			}
+
+			r, err := decompressReader("example.com.log"+compressionExt(compression), &body)
+			if err != nil {
+				t.Fatalf("decompressReader() error = %v", err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("failed to decompress: %v", err)
+			}
+			if string(got) != content {
+				t.Errorf("decompressed content does not match")
+			}
+		})
+	}
+
+	if err := compressPayload("lz4", io.Discard, strings.NewReader(content)); err == nil {
+		t.Error("compressPayload() with unsupported compression succeeded, want error")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"logs/example.com.log", "text/plain; charset=utf-8"},
+		{"logs/example.com.csv", "text/csv; charset=utf-8"},
+		{"logs/example.com.jsonl", "application/x-ndjson"},
+		{"logs/example.com.2025-02-20.log.gz", "application/gzip"},
+		{"logs/example.com.part-000001.log.zst", "application/zstd"},
+	}
+
+	for _, tt := range tests {
+		if got := contentType(tt.key); got != tt.want {
+			t.Errorf("contentType(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCompressedUpload(t *testing.T) {
+	tests := []struct {
+		compression string
+		mode        string
+		wantSuffix  string
+		wantType    string
+	}{
+		{CompressionGzip, UploadModeSegment, ".log.gz", "application/gzip"},
+		{CompressionZstd, UploadModeSegment, ".log.zst", "application/zstd"},
+		{CompressionGzip, UploadModeIncremental, ".part-000001.log.gz", "application/gzip"},
+		{CompressionZstd, UploadModeIncremental, ".part-000001.log.zst", "application/zstd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.compression+"/"+tt.mode, func(t *testing.T) {
+			l, fake, path := newUploadingLogger(t, false,
+				fmt.Sprintf("compression = %q", tt.compression),
+				fmt.Sprintf("upload_mode = %q", tt.mode))
+
+			result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+			for i := 0; i < 20; i++ {
+				l.LogSuccess(0, "example.com", result)
+			}
+			if err := l.UploadNow(); err != nil {
+				t.Fatalf("UploadNowに失敗しました: %v", err)
+			}
+
+			keys := fake.keys()
+			if len(keys) != 1 || !strings.HasSuffix(keys[0], tt.wantSuffix) {
+				t.Fatalf("アップロードされたキー = %v, want suffix %s", keys, tt.wantSuffix)
+			}
+			// ダウンロード時に自動で展開されないよう、Content-Encodingは付けない
+			header := fake.headers[keys[0]]
+			if got := header.Get("Content-Encoding"); strings.Contains(got, tt.compression) {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if got := header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			// 圧縮用の一時ファイルは残さない
+			if tmps, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*", ".pingood-compress-*")); len(tmps) > 0 {
+				t.Errorf("圧縮用の一時ファイルが残っています: %v", tmps)
+			}
+
+			r, err := decompressReader(keys[0], bytes.NewReader(fake.objects[keys[0]]))
+			if err != nil {
+				t.Fatalf("decompressReader() error = %v", err)
+			}
+			content, _ := io.ReadAll(r)
+			if n := strings.Count(string(content), "SUCCESS - Target: example.com"); n != 20 {
+				t.Errorf("展開した内容の行数 = %d, want 20", n)
+			}
+
+			if tt.mode == UploadModeIncremental {
+				var got strings.Builder
+				if _, err := l.uploader.Reassemble(context.Background(), path, &got); err != nil {
+					t.Fatalf("Reassembleに失敗しました: %v", err)
+				}
+				if got.String() != string(content) {
+					t.Errorf("Reassemble() = %q, want %q", got.String(), content)
+				}
+			}
+		})
+	}
+}
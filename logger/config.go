@@ -6,13 +6,23 @@ import (
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"pingood/alert"
+	"pingood/hook"
 )
 
 // Config はアプリケーション全体の設定を保持します
 type Config struct {
-	LogFiles     []string `toml:"log_files"`
-	S3           S3Config `toml:"s3"`
-	ErrorLogMode string   `toml:"error_log_mode"`
+	LogFiles     []string       `toml:"log_files"` // 非推奨（[[targets]]のlogを使用してください）
+	S3           S3Config       `toml:"s3"`
+	ErrorLogMode string         `toml:"error_log_mode"`
+	LogFormat    string         `toml:"log_format"` // "text"（デフォルト）、"jsonl" または "csv"
+	CSVBOM       bool           `toml:"csv_bom"`    // CSVの先頭にUTF-8のBOMを付ける（Excel向け）
+	Rotation     RotationConfig `toml:"rotation"`
+	HashChain    bool           `toml:"hash_chain"` // 各行に直前の行とのハッシュチェーンを付加する（改ざん検知用）
+	Targets      []TargetConfig `toml:"targets"`    // 監視対象（-targetを省略した場合に使用）
+	State        StateConfig    `toml:"state"`      // 状態の遷移を判定する連続回数
+	Alerts       alert.Config   `toml:"alerts"`     // 状態の遷移の通知先
+	Hooks        hook.Config    `toml:"hooks"`      // 状態の遷移で実行するコマンド（ターゲットごとに上書き可能）
 }
 
 // LoadConfig は指定されたパスから設定を読み込みます
@@ -48,33 +58,81 @@ func LoadConfig(path string) (*Config, error) {
 
 // validateConfig は設定内容を検証します
 func validateConfig(config *Config) error {
-	if len(config.LogFiles) == 0 {
-		return fmt.Errorf("少なくとも1つのログファイルパスを指定してください")
+	if err := validateTargets(config.Targets); err != nil {
+		return err
 	}
 
-	// scheduleまたはupload_timeのどちらかが設定されている場合のみS3の設定を検証
-	if config.S3.Schedule != "" || config.S3.UploadTime != "" {
-		if config.S3.Bucket == "" {
-			return fmt.Errorf("S3バケットを指定してください")
-		}
+	if err := config.Rotation.validate(); err != nil {
+		return err
+	}
 
-		if config.S3.Region == "" {
-			return fmt.Errorf("AWSリージョンを指定してください")
-		}
+	if err := config.State.validate(); err != nil {
+		return err
+	}
 
-		if config.S3.AccessKey == "" {
-			return fmt.Errorf("AWS Access Keyを指定してください")
-		}
+	if err := config.Alerts.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.Hooks.Validate(); err != nil {
+		return fmt.Errorf("[hooks]の%v", err)
+	}
+
+	// [s3]はアップロードが有効な場合のみ検証する（S3Config.Validate）
+	return nil
+}
 
-		if config.S3.SecretKey == "" {
-			return fmt.Errorf("AWS Secret Keyを指定してください")
+// Validate は[s3]の設定を検証します
+// アップロードを行わない場合は不完全な[s3]でも起動できるよう、LoadConfigでは検証しません
+// scheduleまたはupload_timeのどちらも設定されていない場合は検証しません
+func (c S3Config) Validate() error {
+	if c.Schedule == "" && c.UploadTime == "" {
+		return nil
+	}
+
+	if c.Bucket == "" {
+		return fmt.Errorf("S3バケットを指定してください")
+	}
+
+	if c.Region == "" {
+		return fmt.Errorf("AWSリージョンを指定してください")
+	}
+
+	if c.AccessKey == "" {
+		return fmt.Errorf("AWS Access Keyを指定してください")
+	}
+
+	if c.SecretKey == "" {
+		return fmt.Errorf("AWS Secret Keyを指定してください")
+	}
+
+	for _, d := range []struct{ name, value string }{
+		{"retry_initial", c.RetryInitial},
+		{"retry_max", c.RetryMax},
+		{"request_timeout", c.RequestTimeout},
+	} {
+		if d.value == "" {
+			continue
 		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return fmt.Errorf("%sの形式が不正です（例: 30s、5m）: %s", d.name, d.value)
+		}
+	}
+
+	switch c.UploadMode {
+	case "", UploadModeSegment, UploadModeIncremental:
+	default:
+		return fmt.Errorf("不正なアップロード方式です（segmentまたはincrementalを指定してください）: %s", c.UploadMode)
+	}
+
+	if err := validateCompression(c.Compression); err != nil {
+		return err
+	}
 
-		// scheduleが設定されていない場合のみupload_timeを検証
-		if config.S3.Schedule == "" && config.S3.UploadTime != "" {
-			if _, err := time.Parse("15:04", config.S3.UploadTime); err != nil {
-				return fmt.Errorf("アップロード時刻のフォーマットが不正です（HH:MM形式で指定してください）: %v", err)
-			}
+	// scheduleが設定されていない場合のみupload_timeを検証
+	if c.Schedule == "" && c.UploadTime != "" {
+		if _, err := time.Parse("15:04", c.UploadTime); err != nil {
+			return fmt.Errorf("アップロード時刻のフォーマットが不正です（HH:MM形式で指定してください）: %v", err)
 		}
 	}
 
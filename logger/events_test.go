@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/monitor"
+)
+
+// upTransition はテスト用のDOWNからUPへの遷移を返します
+func upTransition() monitor.Transition {
+	now := time.Now()
+	return monitor.Transition{
+		Job:    monitor.Job{Index: 0, Target: "example.com"},
+		From:   monitor.StateDown,
+		To:     monitor.StateUp,
+		Time:   now,
+		Since:  now.Add(-10 * time.Second),
+		Outage: 90 * time.Second,
+	}
+}
+
+func TestLogEventWritesEventLog(t *testing.T) {
+	l, _, path := newUploadingLogger(t, false)
+
+	if err := l.LogEvent(0, upTransition()); err != nil {
+		t.Fatalf("LogEventに失敗しました: %v", err)
+	}
+
+	for _, p := range []string{path, getEventLogFilePath(path)} {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("%sの読み込みに失敗しました: %v", p, err)
+		}
+		if !strings.Contains(string(content), "EVENT - Target: example.com, State: UP (from DOWN)") || !strings.Contains(string(content), "Outage: 1m30s") {
+			t.Errorf("%sの内容 = %q", p, content)
+		}
+	}
+	// 状態の遷移はエラーログには書き込まない
+	if content, _ := os.ReadFile(getErrorLogFilePath(path)); len(content) != 0 {
+		t.Errorf("エラーログの内容 = %q, want empty", content)
+	}
+}
+
+func TestEventLogUploadedWithErrorLog(t *testing.T) {
+	l, fake, _ := newUploadingLogger(t, true)
+
+	if err := l.LogEvent(0, upTransition()); err != nil {
+		t.Fatalf("LogEventに失敗しました: %v", err)
+	}
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+
+	var uploaded bool
+	for _, key := range fake.keys() {
+		if strings.Contains(key, ".events_") {
+			uploaded = true
+			if body := string(fake.objects[key]); !strings.Contains(body, "UP (from DOWN)") {
+				t.Errorf("%sの内容 = %q", key, body)
+			}
+		}
+	}
+	if !uploaded {
+		t.Errorf("イベントログがアップロードされていません: %v", fake.keys())
+	}
+}
@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 はPutObject、HeadObject、GetObject、ListObjectsV2のみに対応したテスト用のS3互換サーバーです
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte      // バケット名を除いたキーごとの内容
+	headers map[string]http.Header // キーごとのPutObjectのヘッダー
+	failPut bool                   // trueの場合はPutObjectを失敗させる
+	corrupt bool                   // trueの場合は受け取った内容を壊して保存する
+	stall   chan struct{}          // nil以外の場合はチャネルが閉じられるまでPutObjectに応答しない
+}
+
+// newFakeS3 はテスト用のS3互換サーバーを起動し、接続するための設定を返します
+func newFakeS3(t *testing.T) (*fakeS3, S3Config) {
+	t.Helper()
+	f := &fakeS3{objects: make(map[string][]byte), headers: make(map[string]http.Header)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	useTLS := false
+	return f, S3Config{
+		Region:         "ap-northeast-1",
+		Bucket:         "pingood",
+		KeyPrefix:      "logs",
+		AccessKey:      "test",
+		SecretKey:      "test",
+		Endpoint:       srv.URL,
+		ForcePathStyle: true,
+		TLS:            &useTLS,
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/pingood/")
+
+	if r.Method == http.MethodPut && f.stall != nil {
+		select {
+		case <-f.stall:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r.URL.Query().Get("prefix"))
+		return
+	case r.Method == http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if f.failPut {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		body, err := readS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// チェックサムが送られた場合は内容と一致することを確認する
+		sum := sha256.Sum256(body)
+		checksum := base64.StdEncoding.EncodeToString(sum[:])
+		if want := r.Header.Get("X-Amz-Checksum-Sha256"); want != "" && want != checksum {
+			http.Error(w, "<Error><Code>BadDigest</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		if f.corrupt {
+			body = append(body, "corrupted"...)
+		}
+		f.objects[key] = body
+		f.headers[key] = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if f.corrupt {
+			body = body[:len(body)-len("corrupted")]
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" {
+			sum := sha256.Sum256(f.objects[key])
+			w.Header().Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// list はプレフィックスに一致するオブジェクトの一覧を返します
+// 呼び出し側でf.muをロックしておく必要があります
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: "pingood", Prefix: prefix}
+	for key, body := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{key, len(body)})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// readS3Body はリクエストの本文を読み込みます（aws-chunked形式の場合はチャンクを連結します）
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return io.ReadAll(r.Body)
+	}
+
+	var body []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return body, nil
+		}
+		chunk := make([]byte, size+2) // チャンクの後のCRLFを含む
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk[:size]...)
+	}
+}
+
+// contents はアップロードされたすべてのオブジェクトの内容を返します
+func (f *fakeS3) contents() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var contents []string
+	for _, body := range f.objects {
+		contents = append(contents, string(body))
+	}
+	return contents
+}
+
+// keys はアップロードされたオブジェクトのキーを返します
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,305 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pingood/ping"
+)
+
+// ログの状態
+const (
+	StatusSuccess = "SUCCESS"
+	StatusWarn    = "WARN"
+	StatusError   = "ERROR"
+	StatusStopped = "STOPPED"
+	StatusEvent   = "EVENT" // 状態の遷移
+	StatusHook    = "HOOK"  // 状態の遷移で実行したフック
+	StatusChain   = "CHAIN" // ローテーション後のファイルの最初の行（直前のファイルの最後の行のハッシュ）
+)
+
+// ログの形式
+const (
+	FormatText  = "text"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// utf8BOM はExcelにUTF-8として認識させるためのバイトオーダーマークです
+const utf8BOM = "\ufeff"
+
+// Record はログ1行分の内容です
+type Record struct {
+	Seq        uint64 // ターゲットごとの通し番号
+	Timestamp  time.Time
+	Target     string
+	IP         string
+	Prober     string
+	Status     string
+	RTT        time.Duration
+	StatusCode int
+	Detail     string
+	Warning    string
+	Err        error
+	Message    string            // 停止マーカーなどのメッセージ（状態の遷移の場合は理由、CHAINの場合は直前のファイルの最後の行のハッシュ）
+	Labels     map[string]string // ターゲットのラベル（JSON Lines形式のみ記録）
+	State      string            // 遷移後の状態（EVENTのみ）
+	PrevState  string            // 遷移前の状態（EVENTのみ）
+	Since      time.Time         // 遷移の原因となった最初の検査の時刻（EVENTのみ）
+	Outage     time.Duration     // DOWNから回復した場合の停止時間（EVENTのみ）
+	Hook       string            // 実行したフックの名前（HOOKのみ）
+	ExitCode   int               // フックの終了コード（HOOKのみ、終了しなかった場合は-1）
+	Elapsed    time.Duration     // フックの実行時間（HOOKのみ）
+	Output     string            // フックの出力（HOOKのみ）
+}
+
+// eventSummary は状態の遷移を1行で表した文字列を返します
+// 例: "UP (from DOWN), Outage: 5m30s"
+func eventSummary(r Record) string {
+	s := fmt.Sprintf("%s (from %s), Since: %s", r.State, r.PrevState, r.Since.Format("2006-01-02 15:04:05"))
+	if r.Outage > 0 {
+		s += fmt.Sprintf(", Outage: %v", r.Outage.Round(time.Millisecond))
+	}
+	if r.Message != "" {
+		s += ", Reason: " + r.Message
+	}
+	return s
+}
+
+// hookSummary はフックの実行結果を1行で表した文字列を返します
+// 出力は改行を含むため、引用符で囲んでエスケープします
+// 例: "on_down, Exit: 0, Duration: 1.2s, Output: \"...\""
+func hookSummary(r Record) string {
+	s := r.Hook
+	if r.ExitCode >= 0 {
+		s += fmt.Sprintf(", Exit: %d", r.ExitCode)
+	}
+	s += fmt.Sprintf(", Duration: %v", r.Elapsed.Round(time.Millisecond))
+	if r.Err != nil {
+		s += fmt.Sprintf(", Error: %v", r.Err)
+	}
+	if r.Output != "" {
+		s += ", Output: " + strconv.Quote(r.Output)
+	}
+	return s
+}
+
+// newlineEscaper はテキスト形式とCSV形式の値の改行（CR、LF）を\rと\nの2文字にエスケープします
+// エラーメッセージなどに改行が含まれていても1件の記録が1行になり、ハッシュチェーンの行と一致します
+var newlineEscaper = strings.NewReplacer("\r", `\r`, "\n", `\n`)
+
+// formatter はRecordをログファイルに書き込む1行に変換します
+type formatter interface {
+	// header は新しいファイルの先頭に書き込む内容を返します（不要な場合は空文字列）
+	header() string
+	format(r Record) string
+}
+
+// newFormatter はlog_formatの設定値に応じたformatterを返します
+// chainがtrueの場合、CSV形式のヘッダーにハッシュチェーンの列を追加します
+func newFormatter(format string, csvBOM, chain bool) (formatter, error) {
+	switch format {
+	case "", FormatText:
+		return textFormatter{}, nil
+	case FormatJSONL:
+		return jsonlFormatter{}, nil
+	case FormatCSV:
+		return csvFormatter{bom: csvBOM, chain: chain}, nil
+	default:
+		return nil, fmt.Errorf("不正なログ形式です: %s", format)
+	}
+}
+
+// textFormatter は従来のテキスト形式でログを出力します
+type textFormatter struct{}
+
+func (textFormatter) header() string { return "" }
+
+func (textFormatter) format(r Record) string {
+	ts := r.Timestamp.Format("2006-01-02 15:04:05")
+	var line string
+	switch r.Status {
+	case StatusError:
+		line = fmt.Sprintf("[%s] ERROR - Target: %s, Error: %v", ts, r.Target, r.Err)
+	case StatusStopped:
+		line = fmt.Sprintf("[%s] STOPPED - %s", ts, r.Message)
+	case StatusEvent:
+		line = fmt.Sprintf("[%s] EVENT - Target: %s, State: %s", ts, r.Target, eventSummary(r))
+	case StatusHook:
+		line = fmt.Sprintf("[%s] HOOK - Target: %s, Hook: %s", ts, r.Target, hookSummary(r))
+	case StatusChain:
+		line = fmt.Sprintf("[%s] CHAIN - Prev: %s", ts, r.Message)
+	default:
+		line = fmt.Sprintf("[%s] %s - Target: %s, RTT: %v", ts, r.Status, r.Target, r.RTT)
+		if r.Detail != "" {
+			line += ", " + r.Detail
+		}
+		if r.Warning != "" {
+			line += ", Warning: " + r.Warning
+		}
+	}
+	return newlineEscaper.Replace(line) + "\n"
+}
+
+// jsonlRecord はJSON Lines形式で出力する1行分の内容です
+type jsonlRecord struct {
+	Seq        uint64            `json:"seq"`
+	Timestamp  string            `json:"timestamp"`
+	Target     string            `json:"target"`
+	IP         string            `json:"ip,omitempty"`
+	Prober     string            `json:"prober,omitempty"`
+	Status     string            `json:"status"`
+	RTTMicros  *int64            `json:"rtt_us,omitempty"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Detail     string            `json:"detail,omitempty"`
+	Warning    string            `json:"warning,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	ErrorClass string            `json:"error_class,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	State      string            `json:"state,omitempty"`
+	PrevState  string            `json:"previous_state,omitempty"`
+	Since      string            `json:"since,omitempty"`
+	OutageMS   *int64            `json:"outage_ms,omitempty"`
+	Hook       string            `json:"hook,omitempty"`
+	ExitCode   *int              `json:"exit_code,omitempty"`
+	ElapsedMS  *int64            `json:"duration_ms,omitempty"`
+	Output     string            `json:"output,omitempty"`
+}
+
+// jsonlFormatter は1行に1つのJSONオブジェクトを出力します
+type jsonlFormatter struct{}
+
+func (jsonlFormatter) header() string { return "" }
+
+func (jsonlFormatter) format(r Record) string {
+	rec := jsonlRecord{
+		Seq:        r.Seq,
+		Timestamp:  r.Timestamp.Format(time.RFC3339Nano),
+		Target:     r.Target,
+		IP:         r.IP,
+		Prober:     r.Prober,
+		Status:     r.Status,
+		StatusCode: r.StatusCode,
+		Detail:     r.Detail,
+		Warning:    r.Warning,
+		Message:    r.Message,
+		Labels:     r.Labels,
+		State:      r.State,
+		PrevState:  r.PrevState,
+		Hook:       r.Hook,
+		Output:     r.Output,
+	}
+	if r.Status == StatusSuccess || r.Status == StatusWarn {
+		us := r.RTT.Microseconds()
+		rec.RTTMicros = &us
+	}
+	if r.Status == StatusEvent {
+		rec.Since = r.Since.Format(time.RFC3339Nano)
+		if r.Outage > 0 {
+			ms := r.Outage.Milliseconds()
+			rec.OutageMS = &ms
+		}
+	}
+	if r.Status == StatusHook {
+		ms := r.Elapsed.Milliseconds()
+		rec.ElapsedMS = &ms
+		if r.ExitCode >= 0 {
+			rec.ExitCode = &r.ExitCode
+		}
+	}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+		if r.Status == StatusError {
+			rec.ErrorClass = ping.ClassifyError(r.Err)
+		}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		// 文字列と数値のみのため通常は発生しない
+		return fmt.Sprintf(`{"status":%q,"error":%q}`+"\n", StatusError, err.Error())
+	}
+	return string(b) + "\n"
+}
+
+// csvHeader はCSV形式のヘッダー行の列名です
+var csvHeader = []string{"timestamp", "target", "status", "rtt_ms", "error"}
+
+// csvFormatter は表計算ソフトで開けるCSV形式でログを出力します
+type csvFormatter struct {
+	bom   bool // ファイルの先頭にUTF-8のBOMを付けるか
+	chain bool // ハッシュチェーンの列を追加するか
+}
+
+func (f csvFormatter) header() string {
+	columns := csvHeader
+	if f.chain {
+		columns = append(columns[:len(columns):len(columns)], "chain")
+	}
+	h := csvLine(columns)
+	if f.bom {
+		h = utf8BOM + h
+	}
+	return h
+}
+
+func (csvFormatter) format(r Record) string {
+	var rtt, message string
+	switch r.Status {
+	case StatusSuccess, StatusWarn:
+		rtt = fmt.Sprintf("%.3f", float64(r.RTT)/float64(time.Millisecond))
+		message = r.Warning
+	case StatusError:
+		message = fmt.Sprint(r.Err)
+	case StatusEvent:
+		message = eventSummary(r)
+	case StatusHook:
+		message = hookSummary(r)
+	default:
+		message = r.Message
+	}
+	return csvLine([]string{
+		r.Timestamp.Format("2006-01-02 15:04:05"),
+		r.Target,
+		r.Status,
+		rtt,
+		message,
+	})
+}
+
+// isErrorLine はログファイルの1行がERRORの記録かを返します
+// 形式は行の先頭の文字で判別します（テキスト形式は"["、JSON Lines形式は"{"、それ以外はCSV形式）
+func isErrorLine(line string) bool {
+	switch {
+	case strings.HasPrefix(line, "{"):
+		var r struct {
+			Status string `json:"status"`
+		}
+		return json.Unmarshal([]byte(line), &r) == nil && r.Status == StatusError
+	case strings.HasPrefix(line, "["):
+		return strings.Contains(line, "] "+StatusError+" - ")
+	default:
+		fields, err := csv.NewReader(strings.NewReader(line)).Read()
+		return err == nil && len(fields) > 2 && fields[2] == StatusError
+	}
+}
+
+// csvLine は必要に応じて引用符で囲んだ1行分のCSVを返します
+// 値の改行はエスケープし、引用符で囲んだ改行で1件の記録が複数行に分かれないようにします
+func csvLine(fields []string) string {
+	escaped := make([]string, len(fields))
+	for i, f := range fields {
+		escaped[i] = newlineEscaper.Replace(f)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(escaped)
+	w.Flush()
+	return buf.String()
+}
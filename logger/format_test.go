@@ -0,0 +1,198 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+func TestTextFormatter(t *testing.T) {
+	ts := time.Date(2025, 2, 19, 18, 14, 27, 0, time.Local)
+	tests := []struct {
+		name   string
+		record Record
+		want   string
+	}{
+		{
+			"Success",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusSuccess, RTT: 123456 * time.Microsecond},
+			"[2025-02-19 18:14:27] SUCCESS - Target: example.com, RTT: 123.456ms\n",
+		},
+		{
+			"Error",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusError, Err: fmt.Errorf("failed to resolve host")},
+			"[2025-02-19 18:14:27] ERROR - Target: example.com, Error: failed to resolve host\n",
+		},
+		{
+			"Stopped",
+			Record{Timestamp: ts, Status: StatusStopped, Message: "Monitoring stopped"},
+			"[2025-02-19 18:14:27] STOPPED - Monitoring stopped\n",
+		},
+		{
+			"EventDown",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusEvent, State: "DOWN", PrevState: "UP", Since: ts.Add(-10 * time.Second), Message: "request timed out"},
+			"[2025-02-19 18:14:27] EVENT - Target: example.com, State: DOWN (from UP), Since: 2025-02-19 18:14:17, Reason: request timed out\n",
+		},
+		{
+			"EventUp",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusEvent, State: "UP", PrevState: "DOWN", Since: ts.Add(-5 * time.Second), Outage: 330 * time.Second},
+			"[2025-02-19 18:14:27] EVENT - Target: example.com, State: UP (from DOWN), Since: 2025-02-19 18:14:22, Outage: 5m30s\n",
+		},
+		{
+			"Hook",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusHook, Hook: "on_down", ExitCode: 0, Elapsed: 1234 * time.Millisecond, Output: "traceroute to example.com\n 1  192.168.1.1"},
+			"[2025-02-19 18:14:27] HOOK - Target: example.com, Hook: on_down, Exit: 0, Duration: 1.234s, Output: \"traceroute to example.com\\n 1  192.168.1.1\"\n",
+		},
+		{
+			"HookTimeout",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusHook, Hook: "on_up", ExitCode: -1, Elapsed: 30 * time.Second, Err: fmt.Errorf("timed out after 30s")},
+			"[2025-02-19 18:14:27] HOOK - Target: example.com, Hook: on_up, Duration: 30s, Error: timed out after 30s\n",
+		},
+		{
+			// 改行を含むエラーも1行に収める
+			"MultilineError",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusError, Err: fmt.Errorf("unexpected response:\r\n<html>")},
+			"[2025-02-19 18:14:27] ERROR - Target: example.com, Error: unexpected response:\\r\\n<html>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (textFormatter{}).format(tt.record); got != tt.want {
+				t.Errorf("format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLFormatter(t *testing.T) {
+	ts := time.Date(2025, 2, 19, 18, 14, 27, 123456789, time.UTC)
+
+	line := (jsonlFormatter{}).format(Record{
+		Seq:       7,
+		Timestamp: ts,
+		Target:    "example.com",
+		IP:        "93.184.216.34",
+		Prober:    "icmp",
+		Status:    StatusSuccess,
+		RTT:       1500 * time.Microsecond,
+	})
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("JSONとして解析できません: %v (%q)", err, line)
+	}
+	want := map[string]interface{}{
+		"seq":       float64(7),
+		"timestamp": "2025-02-19T18:14:27.123456789Z",
+		"target":    "example.com",
+		"ip":        "93.184.216.34",
+		"prober":    "icmp",
+		"status":    "SUCCESS",
+		"rtt_us":    float64(1500),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	line = (jsonlFormatter{}).format(Record{
+		Seq:       8,
+		Timestamp: ts,
+		Target:    "example.com",
+		Status:    StatusError,
+		Err:       &ping.ProbeError{Prober: "icmp", Err: fmt.Errorf("wrap: %w", ping.ErrTimeout)},
+	})
+	got = nil
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("JSONとして解析できません: %v (%q)", err, line)
+	}
+	if got["error_class"] != "timeout" || got["error"] != "wrap: request timed out" {
+		t.Errorf("error fields = %v, %v", got["error_class"], got["error"])
+	}
+	if _, ok := got["rtt_us"]; ok {
+		t.Errorf("エラー時にrtt_usが出力されています: %q", line)
+	}
+}
+
+func TestNewFormatter(t *testing.T) {
+	for _, format := range []string{"", "text", "jsonl", "csv"} {
+		if _, err := newFormatter(format, false, false); err != nil {
+			t.Errorf("newFormatter(%q) error = %v", format, err)
+		}
+	}
+	if _, err := newFormatter("xml", false, false); err == nil {
+		t.Error("newFormatter(\"xml\") error = nil, want error")
+	}
+}
+
+func TestCSVFormatter(t *testing.T) {
+	ts := time.Date(2025, 2, 19, 18, 14, 27, 0, time.Local)
+	tests := []struct {
+		name   string
+		record Record
+		want   string
+	}{
+		{
+			"Success",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusSuccess, RTT: 123456 * time.Microsecond},
+			"2025-02-19 18:14:27,example.com,SUCCESS,123.456,\n",
+		},
+		{
+			"Error with comma",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusError, Err: fmt.Errorf("dial tcp: lookup example.com, no such host")},
+			"2025-02-19 18:14:27,example.com,ERROR,,\"dial tcp: lookup example.com, no such host\"\n",
+		},
+		{
+			"Error with quote",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusError, Err: fmt.Errorf(`body does not contain "ok"`)},
+			"2025-02-19 18:14:27,example.com,ERROR,,\"body does not contain \"\"ok\"\"\"\n",
+		},
+		{
+			"Error with newline",
+			Record{Timestamp: ts, Target: "example.com", Status: StatusError, Err: fmt.Errorf("unexpected response:\n<html>")},
+			"2025-02-19 18:14:27,example.com,ERROR,,unexpected response:\\n<html>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (csvFormatter{}).format(tt.record); got != tt.want {
+				t.Errorf("format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVHeader(t *testing.T) {
+	logFilePath := "test.csv"
+	os.Remove(logFilePath)
+	defer os.Remove(logFilePath)
+
+	// 新しいファイルにはBOMとヘッダーを書き込む
+	file, err := openLogFile(logFilePath, csvFormatter{bom: true})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	file.Close()
+
+	// 既存のファイルにはヘッダーを重複して書き込まない
+	file, err = openLogFile(logFilePath, csvFormatter{bom: true})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	file.Close()
+
+	content, err := os.ReadFile(logFilePath)
+	if err != nil {
+		t.Fatalf("ログファイルの読み込みに失敗しました: %v", err)
+	}
+	want := "\ufefftimestamp,target,status,rtt_ms,error\n"
+	if string(content) != want {
+		t.Errorf("ログファイルの内容が期待値と異なります: expected %q, got %q", want, string(content))
+	}
+}
@@ -0,0 +1,249 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// アップロードの方式
+const (
+	UploadModeSegment     = "segment"     // 書き込み中のファイルを切り替えてファイルごとにアップロード（デフォルト）
+	UploadModeIncremental = "incremental" // 前回のアップロード以降に追記された部分のみを連番のパートとしてアップロード
+)
+
+// partState はファイルごとのアップロード済みの位置と次のパート番号です
+type partState struct {
+	Offset   int64 `json:"offset"`
+	NextPart int   `json:"next_part"`
+}
+
+// incrementalState はログファイルとエラーログファイルのアップロード済みの位置を保持します
+type incrementalState struct {
+	path  string
+	Files map[string]*partState `json:"files"` // ファイル名ごとの状態
+}
+
+// getIncrementalStatePath はログファイルに対応するアップロード位置の記録のパスを返します
+func getIncrementalStatePath(logFilePath string) string {
+	dir, file := filepath.Split(logFilePath)
+	ext := filepath.Ext(file)
+	base := file[:len(file)-len(ext)]
+	return filepath.Join(dir, "."+base+".offsets")
+}
+
+// loadIncrementalState はアップロード位置の記録を読み込みます（存在しない場合は空の記録を返します）
+func loadIncrementalState(logFilePath string) (*incrementalState, error) {
+	s := &incrementalState{
+		path:  getIncrementalStatePath(logFilePath),
+		Files: make(map[string]*partState),
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("アップロード位置の読み込みに失敗しました %s: %v", s.path, err)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]*partState)
+	}
+	return s, nil
+}
+
+// file はファイルの状態を返します
+func (s *incrementalState) file(path string) *partState {
+	name := filepath.Base(path)
+	ps, ok := s.Files[name]
+	if !ok {
+		ps = &partState{NextPart: 1}
+		s.Files[name] = ps
+	}
+	return ps
+}
+
+// save はアップロード位置の記録を一時ファイルに書き込んでから置き換えます
+func (s *incrementalState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("アップロード位置の保存に失敗しました %s: %v", s.path, err)
+	}
+	if err := os.Rename(s.path+".tmp", s.path); err != nil {
+		return fmt.Errorf("アップロード位置の保存に失敗しました %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// incremental は追記された部分のみをアップロードする設定かを返します
+func (l *Logger) incremental() bool {
+	return l.uploader != nil && l.config != nil && l.config.S3.UploadMode == UploadModeIncremental
+}
+
+// captureParts はログファイルと付随するファイル（エラーログ、イベントログ）に追記された部分をパートとしてスプールに登録します
+// 呼び出し側でl.muをロックしておく必要があります
+func (l *Logger) captureParts(index int) error {
+	path := l.paths[index]
+	var lastErr error
+	for _, p := range append([]string{path}, companionPaths(path)...) {
+		if err := l.capturePart(path, p); err != nil {
+			lastErr = err
+			fmt.Fprintf(os.Stderr, "追記部分の登録に失敗しました %s: %v\n", p, err)
+		}
+	}
+	return lastErr
+}
+
+// capturePart は前回登録した位置からファイルの末尾までを次の番号のパートとしてスプールに登録します
+// ロックの中で呼び出すため、登録した位置以降に書き込まれた行は次のパートに含まれます
+func (l *Logger) capturePart(logPath, filePath string) error {
+	state := l.partStates[logPath]
+	if state == nil {
+		return nil
+	}
+
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ps := state.file(filePath)
+	if info.Size() < ps.Offset {
+		// ファイルが作り直された場合は先頭から登録する
+		ps.Offset = 0
+	}
+	if info.Size() == ps.Offset {
+		return nil
+	}
+
+	key := l.uploader.partKey(filePath, ps.NextPart)
+	delta := io.NewSectionReader(f, ps.Offset, info.Size()-ps.Offset)
+	if err := l.spool.enqueuePart(delta, filePath, key); err != nil {
+		return err
+	}
+	ps.Offset = info.Size()
+	ps.NextPart++
+	return state.save()
+}
+
+// resetPart はローテーションで新しいファイルに切り替えたファイルの位置を先頭に戻します
+func (l *Logger) resetPart(logPath, filePath string) error {
+	state := l.partStates[logPath]
+	if state == nil {
+		return nil
+	}
+	state.file(filePath).Offset = 0
+	return state.save()
+}
+
+// partNumberPattern はパートのキーのプレフィックス以降からパート番号を取り出す正規表現です
+var partNumberPattern = regexp.MustCompile(`^(\d+)`)
+
+// partPrefix はファイルのパートのキーに共通するプレフィックスを返します
+// 別のディレクトリにある同じ名前のファイルのパートと混ざらないよう、カレントディレクトリ以外のファイルは親ディレクトリの名前を含めます
+func (u *S3Uploader) partPrefix(name string) string {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	prefix := u.config.KeyPrefix
+	if dir := filepath.Base(filepath.Dir(name)); dir != "." && dir != string(filepath.Separator) {
+		prefix += "/" + dir
+	}
+	return fmt.Sprintf("%s/%s/%s.part-", prefix, base, base)
+}
+
+// partKey はファイルのパートのアップロード先のキーを返します
+// 例: logs/example.com/example.com.part-000001.log、logs/web/example.com/example.com.part-000001.log（圧縮する場合は.log.gzなど）
+func (u *S3Uploader) partKey(name string, part int) string {
+	return fmt.Sprintf("%s%06d%s", u.partPrefix(name), part, u.keyExt(name))
+}
+
+// Reassemble はログファイルのパートをS3から取得し、番号順に展開して連結しwに書き込みます
+// nameにはアップロードしたときのログファイルのパス（例: example.com.log、logs/web/example.com.error.log）を指定します
+// 欠番がある場合はエラーを返し、連結したパートの数を返します
+func (u *S3Uploader) Reassemble(ctx context.Context, name string, w io.Writer) (int, error) {
+	prefix := u.partPrefix(name)
+
+	parts := make(map[int]string)
+	paginator := s3.NewListObjectsV2Paginator(u.client, &s3.ListObjectsV2Input{
+		Bucket: &u.config.Bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("パートの一覧の取得に失敗しました: %v", err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, signatureExt) {
+				// パートの署名は連結しない
+				continue
+			}
+			m := partNumberPattern.FindStringSubmatch(strings.TrimPrefix(key, prefix))
+			if m == nil {
+				continue
+			}
+			n, _ := strconv.Atoi(m[1])
+			parts[n] = key
+		}
+	}
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("パートが見つかりません: %s*", prefix)
+	}
+
+	numbers := make([]int, 0, len(parts))
+	for n := range parts {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for i, n := range numbers {
+		if n != i+1 {
+			return 0, fmt.Errorf("パート%dが見つかりません", i+1)
+		}
+	}
+
+	for _, n := range numbers {
+		key := parts[n]
+		out, err := u.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: &u.config.Bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("パートの取得に失敗しました %s: %v", key, err)
+		}
+		body, err := decompressReader(key, out.Body)
+		if err != nil {
+			out.Body.Close()
+			return 0, fmt.Errorf("パートの展開に失敗しました %s: %v", key, err)
+		}
+		_, err = io.Copy(w, body)
+		body.Close()
+		out.Body.Close()
+		if err != nil {
+			return 0, fmt.Errorf("パートの書き込みに失敗しました %s: %v", key, err)
+		}
+	}
+	return len(numbers), nil
+}
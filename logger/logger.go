@@ -1,13 +1,20 @@
 package logger
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
+	"pingood/hook"
+	"pingood/monitor"
 	"pingood/ping"
 )
 
@@ -15,95 +22,213 @@ import (
 type Logger struct {
 	files      []*os.File
 	errorFiles map[string]*os.File // エラーログファイル
+	eventFiles map[string]*os.File // 状態の遷移を記録するイベントログファイル
 	paths      []string
-	uploader   *S3Uploader // オプショナル
-	config     *Config     // オプショナル
-	cron       *cron.Cron  // オプショナル
-	mu         sync.Mutex
+	uploader   *S3Uploader                  // オプショナル
+	config     *Config                      // オプショナル
+	cron       *cron.Cron                   // オプショナル
+	format     formatter                    // nilの場合はテキスト形式
+	seqs       []uint64                     // ターゲットごとの通し番号
+	rotate     *rotator                     // nilの場合はローテーションしない
+	manifests  map[string]*uploadManifest   // スプールへの登録記録（アップロード機能が有効な場合のみ）
+	spool      *spool                       // アップロード待ちのファイル（アップロード機能が有効な場合のみ）
+	partStates map[string]*incrementalState // アップロード済みの位置（incrementalの場合のみ）
+	chains     map[string]string            // ファイルごとの最後の行のハッシュ（hash_chainの場合のみ）
+	fileOpts   []FileOptions                // ログファイルごとの設定
+	stopRetry  chan struct{}                // 再送処理の停止
+	retryDone  chan struct{}                // 再送処理の終了
+	stopOnce   sync.Once
+	mu         sync.Mutex // ログファイルへの書き込みと切り替えを保護する
+	uploadMu   sync.Mutex // アップロードを1つずつ実行する
 }
 
 // LoggerOptions はロガーの設定オプションを定義します
 type LoggerOptions struct {
-	ConfigPath     string // S3アップロード用の設定ファイルパス
-	UploadExisting bool   // 起動時に既存のログファイルをアップロードするか
+	ConfigPath     string        // 設定ファイルパス（ログ形式やS3アップロードの設定）
+	Config         *Config       // 読み込み済みの設定（指定した場合はConfigPathを読み込まない）
+	Upload         bool          // S3アップロード機能を有効にするか
+	UploadExisting bool          // 起動時に既存のログファイルをアップロードするか
+	Files          []FileOptions // ログファイルごとの設定（pathsと同じ順序、省略可能）
+}
+
+// FileOptions はログファイルごとの設定です
+type FileOptions struct {
+	ErrorLogMode string            // エラーログの書き出し方法（空の場合は設定ファイルのerror_log_mode）
+	Labels       map[string]string // JSON Lines形式のログに記録するラベル
 }
 
 // NewLogger creates a new Logger instance
 func NewLogger(paths []string, opts *LoggerOptions) (*Logger, error) {
 	var files []*os.File
 	var errorFiles = make(map[string]*os.File)
+	var eventFiles = make(map[string]*os.File)
 	var uploader *S3Uploader
 	var config *Config
 	var cronJob *cron.Cron
 
+	// 設定ファイルの読み込み（オプショナル）
+	if opts != nil && opts.Config != nil {
+		config = opts.Config
+	} else if opts != nil && opts.ConfigPath != "" {
+		var err error
+		config, err = LoadConfig(opts.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("設定の読み込みに失敗しました: %v", err)
+		}
+	}
+
+	// ログ形式の選択
+	var logFormat string
+	var csvBOM, hashChain bool
+	if config != nil {
+		logFormat, csvBOM, hashChain = config.LogFormat, config.CSVBOM, config.HashChain
+	}
+	format, err := newFormatter(logFormat, csvBOM, hashChain)
+	if err != nil {
+		return nil, err
+	}
+
+	// ローテーションの設定（オプショナル）
+	var rotate *rotator
+	if config != nil {
+		if rotate, err = newRotator(config.Rotation, paths); err != nil {
+			return nil, err
+		}
+	}
+
+	// エラーが発生した場合、既に開いたファイルを全て閉じる
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+		for _, f := range errorFiles {
+			f.Close()
+		}
+		for _, f := range eventFiles {
+			f.Close()
+		}
+	}
+
 	// 複数のログファイルを開く
 	for _, path := range paths {
-		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		file, err := openLogFile(path, format)
 		if err != nil {
-			// エラーが発生した場合、既に開いたファイルを全て閉じる
-			for _, f := range files {
-				f.Close()
-			}
+			closeAll()
 			return nil, fmt.Errorf("ログファイルのオープンに失敗しました %s: %v", path, err)
 		}
 		files = append(files, file)
 
 		// エラーログファイルを開く
 		errorFilePath := getErrorLogFilePath(path)
-		errorFile, err := os.OpenFile(errorFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		errorFile, err := openLogFile(errorFilePath, format)
 		if err != nil {
-			for _, f := range files {
-				f.Close()
-			}
+			closeAll()
 			return nil, fmt.Errorf("エラーログファイルのオープンに失敗しました %s: %v", errorFilePath, err)
 		}
 		errorFiles[path] = errorFile
+
+		// イベントログファイルを開く
+		eventFilePath := getEventLogFilePath(path)
+		eventFile, err := openLogFile(eventFilePath, format)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("イベントログファイルのオープンに失敗しました %s: %v", eventFilePath, err)
+		}
+		eventFiles[path] = eventFile
 	}
 
 	// S3アップロード機能の初期化（オプショナル）
-	if opts != nil && opts.ConfigPath != "" {
-		var err error
-		// 設定ファイルの読み込み
-		config, err = LoadConfig(opts.ConfigPath)
-		if err != nil {
-			for _, f := range files {
-				f.Close()
-			}
-			return nil, fmt.Errorf("設定の読み込みに失敗しました: %v", err)
+	if opts != nil && opts.Upload && config != nil {
+		if err := config.S3.Validate(); err != nil {
+			closeAll()
+			return nil, err
+		}
+		if err := checkUniqueBaseNames(paths); err != nil {
+			closeAll()
+			return nil, err
 		}
 
 		// S3アップローダーの初期化
 		uploader, err = NewS3Uploader(config.S3)
 		if err != nil {
-			for _, f := range files {
-				f.Close()
-			}
+			closeAll()
 			return nil, fmt.Errorf("S3アップローダーの初期化に失敗しました: %v", err)
 		}
 
 		// cronの初期化
 		cronJob = cron.New()
-
-		// 既存ファイルのアップロード確認
-		if opts.UploadExisting {
-			fmt.Println("既存のログファイルをアップロードしています...")
-			for _, path := range paths {
-				if err := uploader.UploadFile(path); err != nil {
-					fmt.Fprintf(os.Stderr, "既存ファイルのアップロードに失敗しました %s: %v\n", path, err)
-				} else {
-					fmt.Printf("アップロード完了: %s\n", path)
-				}
-			}
-		}
 	}
 
 	l := &Logger{
 		files:      files,
 		errorFiles: errorFiles,
+		eventFiles: eventFiles,
 		paths:      paths,
 		uploader:   uploader,
 		config:     config,
 		cron:       cronJob,
+		format:     format,
+		seqs:       make([]uint64, len(paths)),
+		rotate:     rotate,
+	}
+	if hashChain {
+		l.chains = make(map[string]string)
+	}
+	if opts != nil {
+		l.fileOpts = opts.Files
+	}
+
+	if uploader != nil {
+		l.manifests = make(map[string]*uploadManifest)
+		for _, path := range paths {
+			m, err := loadUploadManifest(path)
+			if err != nil {
+				l.Close()
+				return nil, err
+			}
+			l.manifests[path] = m
+		}
+
+		// アップロード待ちのファイルを保持するスプールを開く
+		spoolDir := config.S3.SpoolDir
+		if spoolDir == "" {
+			spoolDir = ".pingood-spool"
+			if len(paths) > 0 {
+				spoolDir = filepath.Join(filepath.Dir(paths[0]), spoolDir)
+			}
+		}
+		retryInitial, _ := time.ParseDuration(config.S3.RetryInitial)
+		retryMax, _ := time.ParseDuration(config.S3.RetryMax)
+		if retryMax <= 0 {
+			retryMax = DefaultRetryMax
+		}
+		if l.spool, err = openSpool(spoolDir, retryInitial, retryMax); err != nil {
+			l.Close()
+			return nil, err
+		}
+
+		// 追記された部分のみをアップロードする場合は、アップロード済みの位置を読み込む
+		if l.incremental() {
+			l.partStates = make(map[string]*incrementalState)
+			for _, path := range paths {
+				state, err := loadIncrementalState(path)
+				if err != nil {
+					l.Close()
+					return nil, err
+				}
+				l.partStates[path] = state
+			}
+		}
+
+		// 既存ファイルのアップロード確認
+		if opts.UploadExisting {
+			fmt.Println("既存のログファイルをアップロードしています...")
+			if err := l.UploadNow(); err != nil {
+				fmt.Fprintf(os.Stderr, "既存ファイルのアップロードに失敗しました: %v\n", err)
+			} else {
+				fmt.Println("アップロード完了")
+			}
+		}
 	}
 
 	// S3アップロード機能が有効な場合のみスケジュール設定
@@ -115,9 +240,30 @@ func NewLogger(paths []string, opts *LoggerOptions) (*Logger, error) {
 		cronJob.Start()
 	}
 
+	// 前回の実行で残ったファイルを含め、スプールのファイルを再送する
+	if l.spool != nil {
+		l.stopRetry = make(chan struct{})
+		l.retryDone = make(chan struct{})
+		go l.retryLoop(l.stopRetry, l.retryDone)
+	}
+
 	return l, nil
 }
 
+// checkUniqueBaseNames はログファイルの名前が重複していないことを確認します
+// S3のキーはファイル名から決まるため、別のディレクトリにある同じ名前のファイルはアップロードできません
+func checkUniqueBaseNames(paths []string) error {
+	seen := make(map[string]string, len(paths))
+	for _, p := range paths {
+		base := filepath.Base(p)
+		if prev, ok := seen[base]; ok {
+			return fmt.Errorf("アップロードするログファイルの名前が重複しています（S3のキーが衝突するため、別の名前にしてください）: %s, %s", prev, p)
+		}
+		seen[base] = p
+	}
+	return nil
+}
+
 // scheduleUpload configures the upload schedule
 func (l *Logger) scheduleUpload() error {
 	var schedule string
@@ -148,34 +294,267 @@ func (l *Logger) scheduleUpload() error {
 
 // uploadLogs uploads all log files to S3
 func (l *Logger) uploadLogs() {
+	l.UploadNow()
+}
+
+// cutAll はすべてのログファイルを切り替え、書き込み中の内容をアップロードできる状態にします
+func (l *Logger) cutAll() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	var lastErr error
+	for i := range l.paths {
+		stamp := time.Now().Format("2006-01-02")
+		if l.rotate != nil {
+			stamp = l.rotate.stamp(l.rotate.starts[i])
+		}
+		if err := l.cut(i, stamp); err != nil {
+			lastErr = err
+			fmt.Fprintf(os.Stderr, "ログファイルの切り替えに失敗しました %s: %v\n", l.paths[i], err)
+		}
+	}
+	return lastErr
+}
+
+// enqueueAll は切り替え済みのログファイルと付随するファイルをスプールに登録し、最後に発生したエラーを返します
+// 登録したファイルは記録し、重複して登録しないようにします
+// 呼び出し側でl.uploadMuをロックしておく必要があります
+func (l *Logger) enqueueAll() error {
+	var lastErr error
 	for _, path := range l.paths {
-		if err := l.uploader.UploadFile(path); err != nil {
-			fmt.Fprintf(os.Stderr, "ログファイルのアップロードに失敗しました %s: %v\n", path, err)
+		for _, p := range l.pendingSegments(path) {
+			if err := l.spool.enqueue(p); err != nil {
+				lastErr = err
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				continue
+			}
+			if m := l.manifests[path]; m != nil {
+				if err := m.markQueued(p); err != nil {
+					lastErr = err
+				}
+			}
 		}
 
-		// エラーログファイルのアップロード
-		errorFilePath := getErrorLogFilePath(path)
-		if _, err := os.Stat(errorFilePath); err == nil { // ファイルが存在する場合のみアップロード
-			if err := l.uploader.UploadFile(errorFilePath); err != nil {
-				fmt.Fprintf(os.Stderr, "エラーログファイルのアップロードに失敗しました %s: %v\n", errorFilePath, err)
+		// スプールに登録するまで残していた、保持数を超えた切り替え済みのファイルを削除する
+		l.mu.Lock()
+		if err := l.prune(path); err != nil {
+			lastErr = err
+		}
+		l.mu.Unlock()
+	}
+	return lastErr
+}
+
+// processSpool はスプールのファイルをアップロードし、最後に発生したエラーを返します
+// allがfalseの場合は再送時刻を過ぎたファイルのみを対象とします
+// アップロードに成功したファイルはスプールから取り除き、delete_afterの場合は元のファイルも削除します
+// signing_keyの場合は、アップロードしたオブジェクトの一覧を署名したマニフェストもアップロードします
+// 呼び出し側でl.uploadMuをロックしておく必要があります
+func (l *Logger) processSpool(now time.Time, all bool) error {
+	var lastErr error
+	var signed []*uploadRecord
+	aborted := l.uploader.abortContext()
+	for _, e := range l.spool.due(now, all) {
+		// 停止のために中断された場合、残りのファイルは次のアップロードで送信する
+		if aborted.Err() != nil {
+			break
+		}
+
+		// ハッシュチェーンの先頭をメタデータとして記録する
+		var metadata map[string]string
+		var head string
+		if l.chains != nil {
+			var err error
+			if head, err = fileChainHead(l.spool.path(e)); err != nil {
+				fmt.Fprintf(os.Stderr, "ハッシュチェーンの読み込みに失敗しました %s: %v\n", e.Source, err)
+			} else {
+				metadata = map[string]string{chainMetadataKey: head}
+			}
+		}
+
+		var record *uploadRecord
+		var err error
+		if e.Key != "" {
+			record, err = l.uploader.uploadKey(l.spool.path(e), e.Key, metadata)
+		} else {
+			record, err = l.uploader.upload(l.spool.path(e), e.Source, metadata)
+		}
+		if err != nil {
+			lastErr = err
+			fmt.Fprintf(os.Stderr, "ログファイルのアップロードに失敗しました %s（%d回目）: %v\n", e.Source, e.Attempts+1, err)
+			if err := l.spool.failed(e.Name, err, time.Now()); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
+			continue
+		}
+
+		// アップロード元はスプール内のファイルのため、登録元のファイルを記録する
+		record.Source = e.Source
+		record.ChainHead = head
+		if err := l.spool.record(record); err != nil {
+			lastErr = err
+		}
+		if record.Statement != "" {
+			signed = append(signed, record)
+		}
+		if err := l.spool.done(e.Name); err != nil {
+			lastErr = err
+		}
+		// パートの場合は元のファイルに書き込みを続けるため削除しない
+		if l.config.S3.DeleteAfter && e.Key == "" {
+			if err := os.Remove(e.Source); err != nil && !os.IsNotExist(err) {
+				lastErr = fmt.Errorf("ファイルの削除に失敗しました: %v", err)
+			}
+			for _, m := range l.manifests {
+				if filepath.Dir(m.path) == filepath.Dir(e.Source) {
+					m.forget(e.Source)
+				}
 			}
 		}
 	}
+
+	if len(signed) > 0 {
+		if _, err := l.uploader.uploadManifest(signed, time.Now()); err != nil {
+			lastErr = err
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+	return lastErr
 }
 
-// UploadNow triggers an immediate upload of all log files to S3
+// retryLoop はスプールに残っているファイルを再送時刻になるたびにアップロードします
+func (l *Logger) retryLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		l.uploadMu.Lock()
+		l.processSpool(time.Now(), false)
+		l.uploadMu.Unlock()
+
+		wait := time.Minute
+		if next, ok := l.spool.nextAttempt(); ok {
+			wait = min(max(time.Until(next), time.Second), time.Minute)
+		}
+		timer.Reset(wait)
+	}
+}
+
+// Pending returns the number of log files waiting in the upload spool
+func (l *Logger) Pending() int {
+	if l.spool == nil {
+		return 0
+	}
+	return l.spool.Pending()
+}
+
+// UploadStats returns the number of successful and failed uploads since startup
+func (l *Logger) UploadStats() UploadStats {
+	if l.uploader == nil {
+		return UploadStats{}
+	}
+	return l.uploader.Stats()
+}
+
+// UploadNow cuts the live log files and uploads every sealed segment, including error logs, to S3
+// 切り替えは書き込みと同じロックの中で行うため、アップロード中に書き込まれた行は次回のアップロード対象になります
 func (l *Logger) UploadNow() error {
+	if l.uploader == nil {
+		return nil
+	}
+
+	l.uploadMu.Lock()
+	defer l.uploadMu.Unlock()
+
+	var enqueueErr error
+	if l.incremental() {
+		enqueueErr = l.captureAll()
+	} else {
+		cutErr := l.cutAll()
+		if enqueueErr = l.enqueueAll(); enqueueErr == nil {
+			enqueueErr = cutErr
+		}
+	}
+	if err := l.processSpool(time.Now(), true); err != nil {
+		return err
+	}
+	return enqueueErr
+}
+
+// captureAll はすべてのログファイルに追記された部分をパートとしてスプールに登録します
+func (l *Logger) captureAll() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	var lastErr error
-	for _, path := range l.paths {
-		if err := l.uploader.UploadFile(path); err != nil {
+	for i := range l.paths {
+		if err := l.captureParts(i); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// StopSchedule stops the scheduled uploads and retries, aborts a running upload and waits for it to return
+// Files whose upload was aborted stay in the spool and are sent by the next UploadNow
+func (l *Logger) StopSchedule() {
+	var cronStopped context.Context
+	if l.cron != nil {
+		cronStopped = l.cron.Stop()
+	}
+	l.stopOnce.Do(func() {
+		if l.stopRetry != nil {
+			close(l.stopRetry)
+		}
+	})
+	// 応答しないエンドポイントへのリクエストで停止が止まらないよう、実行中のリクエストを中断する
+	if l.uploader != nil {
+		l.uploader.abort()
+	}
+
+	if cronStopped != nil {
+		<-cronStopped.Done()
+	}
+	if l.retryDone != nil {
+		<-l.retryDone
+	}
+}
+
+// LogStopped writes a "monitoring stopped" marker to every log file, including error and event logs
+func (l *Logger) LogStopped() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	var lastErr error
+	for i, path := range l.paths {
+		if err := l.ensureFileExists(i); err != nil {
+			lastErr = err
+			continue
+		}
+		logLine := l.formatter().format(Record{
+			Seq:       l.nextSeq(i),
+			Timestamp: now,
+			Status:    StatusStopped,
+			Message:   "Monitoring stopped",
+		})
+		if err := l.write(l.files[i], logLine); err != nil {
 			lastErr = err
-			fmt.Fprintf(os.Stderr, "ログファイルのアップロードに失敗しました %s: %v\n", path, err)
+		}
+		for _, files := range []map[string]*os.File{l.errorFiles, l.eventFiles} {
+			if file, ok := files[path]; ok {
+				if err := l.write(file, logLine); err != nil {
+					lastErr = err
+				}
+			}
 		}
 	}
 	return lastErr
@@ -184,9 +563,7 @@ func (l *Logger) UploadNow() error {
 // Close stops the cron job and closes all log files
 func (l *Logger) Close() error {
 	// cronジョブを停止
-	if l.cron != nil {
-		l.cron.Stop()
-	}
+	l.StopSchedule()
 
 	var lastErr error
 	for _, file := range l.files {
@@ -194,10 +571,38 @@ func (l *Logger) Close() error {
 			lastErr = err
 		}
 	}
+	for _, files := range []map[string]*os.File{l.errorFiles, l.eventFiles} {
+		for _, file := range files {
+			if err := file.Close(); err != nil {
+				lastErr = err
+			}
+		}
+	}
 	return lastErr
 }
 
+// openLogFile はログファイルを追記モードで開き、空のファイルの場合はヘッダーを書き込みます
+func openLogFile(path string, f formatter) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if header := f.header(); header != "" {
+		info, err := file.Stat()
+		if err == nil && info.Size() == 0 {
+			_, err = file.WriteString(header)
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
 // ensureFileExists checks if the file exists and recreates it if necessary
+// 呼び出し側でl.muをロックしておく必要があります
 func (l *Logger) ensureFileExists(index int) error {
 	if _, err := os.Stat(l.paths[index]); os.IsNotExist(err) {
 		// 既存のファイルハンドルを閉じる
@@ -206,40 +611,126 @@ func (l *Logger) ensureFileExists(index int) error {
 		}
 
 		// 新しいファイルを作成
-		file, err := os.OpenFile(l.paths[index], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		file, err := openLogFile(l.paths[index], l.formatter())
 		if err != nil {
 			return fmt.Errorf("failed to recreate log file %s: %v", l.paths[index], err)
 		}
 		l.files[index] = file
+		l.resetChain(l.paths[index])
 	}
 	return nil
 }
 
+// formatter は設定されたログ形式のformatterを返します
+func (l *Logger) formatter() formatter {
+	if l.format == nil {
+		return textFormatter{}
+	}
+	return l.format
+}
+
+// fileOptions はログファイルごとの設定を返します（設定がない場合は空の設定）
+func (l *Logger) fileOptions(index int) FileOptions {
+	if index < len(l.fileOpts) {
+		return l.fileOpts[index]
+	}
+	return FileOptions{}
+}
+
+// nextSeq はターゲットの次の通し番号を返します
+func (l *Logger) nextSeq(index int) uint64 {
+	if len(l.seqs) != len(l.paths) {
+		l.seqs = make([]uint64, len(l.paths))
+	}
+	l.seqs[index]++
+	return l.seqs[index]
+}
+
 // LogSuccess logs a successful ping result to the specified file index
 func (l *Logger) LogSuccess(index int, target string, result *ping.PingResult) error {
 	if index < 0 || index >= len(l.files) {
 		return fmt.Errorf("invalid file index: %d", index)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	// ファイルの存在を確認し、必要に応じて再作成
 	if err := l.ensureFileExists(index); err != nil {
 		return err
 	}
+	if err := l.rotateIfNeeded(index, time.Now()); err != nil {
+		return err
+	}
 
-	logLine := fmt.Sprintf("[%s] SUCCESS - Target: %s, RTT: %v\n",
-		result.Timestamp.Format("2006-01-02 15:04:05"),
-		target,
-		result.RTT)
+	// 警告がある場合はWARNとして記録
+	status := StatusSuccess
+	if result.Warning != "" {
+		status = StatusWarn
+	}
 
-	_, err := l.files[index].WriteString(logLine)
-	return err
+	logLine := l.formatter().format(Record{
+		Seq:        l.nextSeq(index),
+		Timestamp:  result.Timestamp,
+		Target:     target,
+		IP:         result.IP,
+		Prober:     result.Prober,
+		Status:     status,
+		RTT:        result.RTT,
+		StatusCode: result.StatusCode,
+		Detail:     result.Detail,
+		Warning:    result.Warning,
+		Labels:     l.fileOptions(index).Labels,
+	})
+
+	return l.write(l.files[index], logLine)
 }
 
-func getErrorLogFilePath(logFilePath string) string {
+// ログファイルに付随するファイルの拡張子（ログファイルの拡張子を置き換える）
+const (
+	errorLogExt = ".error.log"  // エラーログ
+	eventLogExt = ".events.log" // 状態の遷移を記録するイベントログ
+)
+
+// companionExts はログファイルと一緒にローテーション、アップロードするファイルの拡張子です
+var companionExts = []string{errorLogExt, eventLogExt}
+
+// companionPath はログファイルに付随するファイルのパスを返します
+func companionPath(logFilePath, companionExt string) string {
 	dir, file := filepath.Split(logFilePath)
 	ext := filepath.Ext(file)
 	base := file[:len(file)-len(ext)]
-	return filepath.Join(dir, base+".error.log")
+	return filepath.Join(dir, base+companionExt)
+}
+
+// companionPaths はログファイルに付随するすべてのファイルのパスを返します
+func companionPaths(logFilePath string) []string {
+	paths := make([]string, len(companionExts))
+	for i, ext := range companionExts {
+		paths[i] = companionPath(logFilePath, ext)
+	}
+	return paths
+}
+
+func getErrorLogFilePath(logFilePath string) string {
+	return companionPath(logFilePath, errorLogExt)
+}
+
+// getEventLogFilePath はイベントログファイルのパスを返します（example.com.log は example.com.events.log）
+func getEventLogFilePath(logFilePath string) string {
+	return companionPath(logFilePath, eventLogExt)
+}
+
+// errorLogMode はファイルごとのエラーログの書き出し方法を返します（設定がない場合はboth）
+func (l *Logger) errorLogMode(index int) string {
+	mode := l.fileOptions(index).ErrorLogMode
+	if mode == "" && l.config != nil {
+		mode = l.config.ErrorLogMode
+	}
+	if mode == "" {
+		mode = ErrorLogModeBoth // デフォルトはboth
+	}
+	return mode
 }
 
 // LogError logs a failed ping attempt to the specified file index
@@ -248,48 +739,59 @@ func (l *Logger) LogError(index int, target string, err error) error {
 		return fmt.Errorf("invalid file index: %d", index)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	// ファイルの存在を確認し、必要に応じて再作成
 	if err := l.ensureFileExists(index); err != nil {
 		return err
 	}
+	if err := l.rotateIfNeeded(index, time.Now()); err != nil {
+		return err
+	}
 
-	logLine := fmt.Sprintf("[%s] ERROR - Target: %s, Error: %v\n",
-		time.Now().Format("2006-01-02 15:04:05"),
-		target,
-		err)
-
-	errorLogMode := l.config.ErrorLogMode
-	if errorLogMode == "" {
-		errorLogMode = "both" // デフォルトはboth
+	record := Record{
+		Seq:       l.nextSeq(index),
+		Timestamp: time.Now(),
+		Target:    target,
+		Status:    StatusError,
+		Err:       err,
+		Labels:    l.fileOptions(index).Labels,
+	}
+	var probeErr *ping.ProbeError
+	if errors.As(err, &probeErr) {
+		record.Prober = probeErr.Prober
+		record.IP = probeErr.IP
 	}
+	logLine := l.formatter().format(record)
 
-	switch errorLogMode {
-	case "same":
-		_, err = l.files[index].WriteString(logLine)
+	switch l.errorLogMode(index) {
+	case ErrorLogModeSame:
+		err = l.write(l.files[index], logLine)
 		if err != nil {
 			return err
 		}
-	case "both":
-		_, err = l.files[index].WriteString(logLine)
+	case ErrorLogModeBoth:
+		err = l.write(l.files[index], logLine)
 		if err != nil {
 			return err
 		}
-		_, err = l.errorFiles[l.paths[index]].WriteString(logLine)
+		err = l.write(l.errorFiles[l.paths[index]], logLine)
 		if err != nil {
 			return err
 		}
-	case "error":
-		_, err = l.errorFiles[l.paths[index]].WriteString(logLine)
+	case ErrorLogModeError:
+		err = l.write(l.errorFiles[l.paths[index]], logLine)
 		if err != nil {
 			return err
 		}
 	default:
 		// 不正な設定の場合は、両方のログに書き出す
-		_, err = l.files[index].WriteString(logLine)
+		err = l.write(l.files[index], logLine)
 		if err != nil {
 			return err
 		}
-		_, err = l.errorFiles[l.paths[index]].WriteString(logLine)
+		err = l.write(l.errorFiles[l.paths[index]], logLine)
 		if err != nil {
 			return err
 		}
@@ -297,3 +799,173 @@ func (l *Logger) LogError(index int, target string, err error) error {
 
 	return err
 }
+
+// LogEvent logs a state transition of the target to the log file and the event log file
+func (l *Logger) LogEvent(index int, t monitor.Transition) error {
+	if index < 0 || index >= len(l.files) {
+		return fmt.Errorf("invalid file index: %d", index)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// ファイルの存在を確認し、必要に応じて再作成
+	if err := l.ensureFileExists(index); err != nil {
+		return err
+	}
+	if err := l.rotateIfNeeded(index, time.Now()); err != nil {
+		return err
+	}
+
+	logLine := l.formatter().format(Record{
+		Seq:       l.nextSeq(index),
+		Timestamp: t.Time,
+		Target:    t.Job.Target,
+		Status:    StatusEvent,
+		Message:   t.Reason,
+		Labels:    l.fileOptions(index).Labels,
+		State:     string(t.To),
+		PrevState: string(t.From),
+		Since:     t.Since,
+		Outage:    t.Outage,
+	})
+
+	if err := l.write(l.files[index], logLine); err != nil {
+		return err
+	}
+	if eventFile, ok := l.eventFiles[l.paths[index]]; ok {
+		return l.write(eventFile, logLine)
+	}
+	return nil
+}
+
+// LogHook logs the result of a hook command to the log file and the event log file
+func (l *Logger) LogHook(index int, r hook.Result) error {
+	if index < 0 || index >= len(l.files) {
+		return fmt.Errorf("invalid file index: %d", index)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// ファイルの存在を確認し、必要に応じて再作成
+	if err := l.ensureFileExists(index); err != nil {
+		return err
+	}
+	if err := l.rotateIfNeeded(index, time.Now()); err != nil {
+		return err
+	}
+
+	output := r.Output
+	if r.Truncated {
+		output += "\n... (truncated)"
+	}
+	logLine := l.formatter().format(Record{
+		Seq:       l.nextSeq(index),
+		Timestamp: r.Time,
+		Target:    r.Job.Target,
+		Status:    StatusHook,
+		Err:       r.Err,
+		Labels:    l.fileOptions(index).Labels,
+		Hook:      r.Name,
+		ExitCode:  r.ExitCode,
+		Elapsed:   r.Duration,
+		Output:    output,
+	})
+
+	if err := l.write(l.files[index], logLine); err != nil {
+		return err
+	}
+	if eventFile, ok := l.eventFiles[l.paths[index]]; ok {
+		return l.write(eventFile, logLine)
+	}
+	return nil
+}
+
+// tailSize はTailErrorsで読み込むファイルの末尾の大きさの上限です
+const tailSize = 64 << 10
+
+// TailErrors returns the last n error lines recorded for the specified file index
+// エラーログファイルに書き出さない場合（error_log_mode = "same"）はログファイルのERRORの行を返します
+// ローテーションや切り替えの直後で行が足りない場合は、直前のローテーション済みのファイルからも読み込みます
+// ヘッダー行と空行は含めません。ファイルがない場合は空のスライスを返します
+func (l *Logger) TailErrors(index, n int) ([]string, error) {
+	if index < 0 || index >= len(l.paths) {
+		return nil, fmt.Errorf("invalid file index: %d", index)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	path, ext, keep := getErrorLogFilePath(l.paths[index]), errorLogExt, func(string) bool { return true }
+	if l.errorLogMode(index) == ErrorLogModeSame {
+		path, ext, keep = l.paths[index], "", isErrorLine
+	}
+
+	tail, err := tailLines(path, n, keep)
+	if err != nil || len(tail) >= n {
+		return tail, err
+	}
+	segments, err := listSegments(l.paths[index], ext)
+	if err != nil || len(segments) == 0 {
+		return tail, nil
+	}
+	older, err := tailLines(segments[len(segments)-1], n-len(tail), keep)
+	if err != nil {
+		return nil, err
+	}
+	return append(older, tail...), nil
+}
+
+// tailLines はファイルの最後のn行のうち、keepがtrueを返す行を返します
+// 圧縮されていないファイルは末尾のtailSizeのみを読み込み、圧縮されたファイルは展開しながら読み込みます
+func tailLines(path string, n int, keep func(string) bool) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	partial := false
+	if isCompressed(path) {
+		zr, err := decompressReader(path, f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if offset := info.Size() - tailSize; offset > 0 {
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			partial = true
+		}
+	}
+
+	var tail []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if partial {
+			// 途中から読み込んだ最初の行は含めない
+			partial = false
+			continue
+		}
+		if line == "" || isHeaderLine(line) || !keep(line) {
+			continue
+		}
+		if tail = append(tail, line); len(tail) > n {
+			tail = tail[1:]
+		}
+	}
+	return tail, scanner.Err()
+}
@@ -3,8 +3,12 @@ package logger
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"pingood/ping"
 )
 
 func TestLogError(t *testing.T) {
@@ -318,3 +322,209 @@ func TestGetErrorLogFilePath(t *testing.T) {
 		t.Errorf("エラーログファイルパスが期待値と異なります: expected %q, got %q", expectedErrorLogFilePath, errorLogFilePath)
 	}
 }
+
+func TestLogSuccessWarn(t *testing.T) {
+	logFilePath := "test.log"
+	os.Remove(logFilePath)
+
+	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	logger := &Logger{
+		files:      []*os.File{file},
+		errorFiles: map[string]*os.File{},
+		paths:      []string{logFilePath},
+		config:     &Config{},
+	}
+
+	timestamp := time.Date(2025, 2, 20, 15, 4, 5, 0, time.Local)
+	result := &ping.PingResult{
+		RTT:       12 * time.Millisecond,
+		Timestamp: timestamp,
+		Detail:    "Version: TLS 1.3",
+		Warning:   "certificate expires in 5 days",
+	}
+	if err := logger.LogSuccess(0, "tls://example.com", result); err != nil {
+		t.Fatalf("LogSuccessに失敗しました: %v", err)
+	}
+
+	logFileContent, err := os.ReadFile(logFilePath)
+	if err != nil {
+		t.Fatalf("ログファイルの読み込みに失敗しました: %v", err)
+	}
+	logLine := "[2025-02-20 15:04:05] WARN - Target: tls://example.com, RTT: 12ms, Version: TLS 1.3, Warning: certificate expires in 5 days\n"
+	if string(logFileContent) != logLine {
+		t.Errorf("ログファイルの内容が期待値と異なります: expected %q, got %q", logLine, string(logFileContent))
+	}
+
+	file.Close()
+	os.Remove(logFilePath)
+}
+
+func TestLogStopped(t *testing.T) {
+	logFilePath := "test.log"
+	errorLogFilePath := "test.error.log"
+	os.Remove(logFilePath)
+	os.Remove(errorLogFilePath)
+
+	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	errorFile, err := os.OpenFile(errorLogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("エラーログファイルのオープンに失敗しました: %v", err)
+	}
+	logger := &Logger{
+		files:      []*os.File{file},
+		errorFiles: map[string]*os.File{logFilePath: errorFile},
+		paths:      []string{logFilePath},
+	}
+
+	if err := logger.LogStopped(); err != nil {
+		t.Fatalf("LogStoppedに失敗しました: %v", err)
+	}
+	// アップロード機能が無効な場合は何もしない
+	if err := logger.UploadNow(); err != nil {
+		t.Errorf("UploadNowに失敗しました: %v", err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("Closeに失敗しました: %v", err)
+	}
+
+	logLine := fmt.Sprintf("[%s] STOPPED - Monitoring stopped\n", time.Now().Format("2006-01-02 15:04:05"))
+	for _, path := range []string{logFilePath, errorLogFilePath} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ログファイルの読み込みに失敗しました: %v", err)
+		}
+		if string(content) != logLine {
+			t.Errorf("%sの内容が期待値と異なります: expected %q, got %q", path, logLine, string(content))
+		}
+	}
+
+	os.Remove(logFilePath)
+	os.Remove(errorLogFilePath)
+}
+
+func TestNewLoggerUsesLoadedConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.com.log")
+	configPath := filepath.Join(dir, "config.toml")
+	os.WriteFile(configPath, []byte(`log_format = "csv"`+"\n"), 0644)
+
+	// 読み込み済みの設定を渡した場合は設定ファイルを読み込み直さない
+	l, err := NewLogger([]string{path}, &LoggerOptions{ConfigPath: configPath, Config: &Config{LogFormat: FormatJSONL}})
+	if err != nil {
+		t.Fatalf("NewLoggerに失敗しました: %v", err)
+	}
+	if err := l.LogError(0, "example.com", fmt.Errorf("request timed out")); err != nil {
+		t.Fatalf("LogErrorに失敗しました: %v", err)
+	}
+	l.Close()
+
+	content, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(content), "{") {
+		t.Errorf("ログの形式がJSON Linesではありません: %q", content)
+	}
+}
+
+func TestTailErrors(t *testing.T) {
+	l, _, _ := newUploadingLogger(t, false)
+	for i := 1; i <= 3; i++ {
+		if err := l.LogError(0, "example.com", fmt.Errorf("error %d", i)); err != nil {
+			t.Fatalf("LogErrorに失敗しました: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		n    int
+		want []string
+	}{
+		{"Last", 2, []string{"error 2", "error 3"}},
+		{"All", 10, []string{"error 1", "error 2", "error 3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := l.TailErrors(0, tt.n)
+			if err != nil {
+				t.Fatalf("TailErrorsに失敗しました: %v", err)
+			}
+			if len(lines) != len(tt.want) {
+				t.Fatalf("TailErrors() = %q, want %d行", lines, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasSuffix(lines[i], "Error: "+want) {
+					t.Errorf("%d行目 = %q, want %q", i+1, lines[i], want)
+				}
+			}
+		})
+	}
+
+	if _, err := l.TailErrors(1, 10); err == nil {
+		t.Error("TailErrors(1) error = nil, want invalid file index")
+	}
+}
+
+func TestTailErrorsAfterRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		format   formatter
+		compress bool
+	}{
+		{"Both", "", textFormatter{}, false},
+		{"BothCompressed", ErrorLogModeBoth, textFormatter{}, true},
+		{"Same", ErrorLogModeSame, textFormatter{}, false},
+		{"SameJSONL", ErrorLogModeSame, jsonlFormatter{}, false},
+		{"SameCSVCompressed", ErrorLogModeSame, csvFormatter{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newRotatingLogger(t, RotationConfig{MaxSize: "1MB", Compress: tt.compress})
+			l.config.ErrorLogMode = tt.mode
+			l.format = tt.format
+			result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+			logError := func(i int) {
+				t.Helper()
+				if err := l.LogError(0, "example.com", fmt.Errorf("error %d", i)); err != nil {
+					t.Fatalf("LogErrorに失敗しました: %v", err)
+				}
+			}
+
+			l.LogSuccess(0, "example.com", result)
+			logError(1)
+			logError(2)
+			// 失敗してから通知するまでの間にローテーションする
+			l.mu.Lock()
+			err := l.cut(0, "2025-02-19")
+			l.mu.Unlock()
+			if err != nil {
+				t.Fatalf("cutに失敗しました: %v", err)
+			}
+
+			lines, err := l.TailErrors(0, 5)
+			if err != nil {
+				t.Fatalf("TailErrorsに失敗しました: %v", err)
+			}
+			if len(lines) != 2 || !strings.Contains(lines[0], "error 1") || !strings.Contains(lines[1], "error 2") {
+				t.Errorf("TailErrors() = %q, want error 1, error 2", lines)
+			}
+
+			// 切り替え後の行と合わせてn行を返す
+			l.LogSuccess(0, "example.com", result)
+			logError(3)
+			lines, err = l.TailErrors(0, 2)
+			if err != nil {
+				t.Fatalf("TailErrorsに失敗しました: %v", err)
+			}
+			if len(lines) != 2 || !strings.Contains(lines[0], "error 2") || !strings.Contains(lines[1], "error 3") {
+				t.Errorf("TailErrors() = %q, want error 2, error 3", lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// uploadManifest はアップロード用のスプールに登録済みのログファイルを記録し、同じファイルを重複してアップロードしないようにします
+// アップロード後に削除しない設定でも、再起動をまたいで記録を保持するためファイルに保存します
+type uploadManifest struct {
+	path string
+	mu   sync.Mutex
+	done map[string]bool // スプールに登録済みのファイル名
+}
+
+// getUploadManifestPath はログファイルに対応するアップロード記録のパスを返します
+func getUploadManifestPath(logFilePath string) string {
+	dir, file := filepath.Split(logFilePath)
+	ext := filepath.Ext(file)
+	base := file[:len(file)-len(ext)]
+	return filepath.Join(dir, "."+base+".uploaded")
+}
+
+// loadUploadManifest はアップロード記録を読み込みます（存在しない場合は空の記録を返します）
+// 既に存在しないファイルの記録は読み込み時に取り除きます
+func loadUploadManifest(logFilePath string) (*uploadManifest, error) {
+	m := &uploadManifest{
+		path: getUploadManifestPath(logFilePath),
+		done: make(map[string]bool),
+	}
+
+	f, err := os.Open(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("アップロード記録の読み込みに失敗しました %s: %v", m.path, err)
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(logFilePath)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" && fileExists(filepath.Join(dir, name)) {
+			m.done[name] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("アップロード記録の読み込みに失敗しました %s: %v", m.path, err)
+	}
+	return m, nil
+}
+
+// queued はファイルがスプールに登録済みかを返します
+func (m *uploadManifest) queued(path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.done[filepath.Base(path)]
+}
+
+// markQueued はファイルをスプールに登録済みとして記録し、記録を保存します
+func (m *uploadManifest) markQueued(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done[filepath.Base(path)] = true
+	return m.save()
+}
+
+// forget は削除したファイルの記録を取り除きます
+func (m *uploadManifest) forget(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.done[filepath.Base(path)] {
+		return nil
+	}
+	delete(m.done, filepath.Base(path))
+	return m.save()
+}
+
+// save は記録を一時ファイルに書き込んでから置き換えます
+// 呼び出し側でm.muをロックしておく必要があります
+func (m *uploadManifest) save() error {
+	names := make([]string, 0, len(m.done))
+	for name := range m.done {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tmp := m.path + ".tmp"
+	content := strings.Join(names, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return fmt.Errorf("アップロード記録の保存に失敗しました %s: %v", m.path, err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("アップロード記録の保存に失敗しました %s: %v", m.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ローテーションの周期
+const (
+	PeriodHourly = "hourly"
+	PeriodDaily  = "daily"
+)
+
+// RotationConfig はログファイルのローテーション設定を保持します
+type RotationConfig struct {
+	MaxSize  string `toml:"max_size"`  // ファイルサイズの上限（例: "10MB"、空の場合はサイズでローテーションしない）
+	Period   string `toml:"period"`    // "hourly" または "daily"（空の場合は期間でローテーションしない）
+	Compress bool   `toml:"compress"`  // ローテーションしたファイルをgzipで圧縮するか
+	MaxFiles int    `toml:"max_files"` // 保持するローテーション済みファイルの数（0の場合は無制限）
+}
+
+// enabled はローテーションが設定されているかを返します
+func (c RotationConfig) enabled() bool {
+	return c.MaxSize != "" || c.Period != ""
+}
+
+// validate はローテーション設定を検証します
+func (c RotationConfig) validate() error {
+	if _, err := parseSize(c.MaxSize); err != nil {
+		return err
+	}
+	switch c.Period {
+	case "", PeriodHourly, PeriodDaily:
+	default:
+		return fmt.Errorf("不正なローテーション周期です（hourlyまたはdailyを指定してください）: %s", c.Period)
+	}
+	if c.MaxFiles < 0 {
+		return fmt.Errorf("max_filesには0以上の値を指定してください: %d", c.MaxFiles)
+	}
+	return nil
+}
+
+// parseSize は"10MB"のようなサイズ指定をバイト数に変換します（空の場合は0）
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("不正なファイルサイズです（例: 10MB）: %s", s)
+	}
+	return n * unit, nil
+}
+
+// rotator はターゲットごとのログファイルのローテーション状態を管理します
+type rotator struct {
+	maxSize  int64
+	period   string
+	compress bool
+
+	starts []time.Time // 現在のファイルに記録している期間の開始時刻
+}
+
+// newRotator はローテーション設定からrotatorを生成します（設定がない場合はnil）
+func newRotator(cfg RotationConfig, paths []string) (*rotator, error) {
+	if !cfg.enabled() {
+		return nil, nil
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	maxSize, _ := parseSize(cfg.MaxSize)
+
+	r := &rotator{
+		maxSize:  maxSize,
+		period:   cfg.Period,
+		compress: cfg.Compress,
+		starts:   make([]time.Time, len(paths)),
+	}
+
+	// 既存のファイルは最終更新時刻の期間に属するものとして扱う
+	now := time.Now()
+	for i, path := range paths {
+		r.starts[i] = r.periodStart(now)
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+			r.starts[i] = r.periodStart(info.ModTime())
+		}
+	}
+	return r, nil
+}
+
+// periodStart は指定した時刻が属する期間の開始時刻を返します
+// 期間を指定していない場合はファイル名の日付に使用するため日単位で区切ります
+func (r *rotator) periodStart(t time.Time) time.Time {
+	if r.period == PeriodHourly {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// stamp はローテーション済みファイルの名前に付ける期間の表記を返します
+func (r *rotator) stamp(start time.Time) string {
+	if r.period == PeriodHourly {
+		return start.Format("2006-01-02-15")
+	}
+	return start.Format("2006-01-02")
+}
+
+// due はファイルをローテーションする必要があるかを返します
+func (r *rotator) due(index int, now time.Time, files ...*os.File) bool {
+	if r.period != "" && !r.periodStart(now).Equal(r.starts[index]) {
+		return true
+	}
+	if r.maxSize > 0 {
+		for _, f := range files {
+			if f == nil {
+				continue
+			}
+			if info, err := f.Stat(); err == nil && info.Size() >= r.maxSize {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentPath は使用されていないローテーション済みファイルのパスを返します
+// example.com.log は example.com.2025-02-20.log となり、同じ期間に複数回ローテーションした場合は
+// example.com.2025-02-20.1.log のように連番を付けます
+func segmentPath(path, stamp string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 0; ; n++ {
+		name := fmt.Sprintf("%s.%s%s", base, stamp, ext)
+		if n > 0 {
+			name = fmt.Sprintf("%s.%s.%d%s", base, stamp, n, ext)
+		}
+		if !segmentExists(name) {
+			return name
+		}
+	}
+}
+
+// segmentExists はローテーション済みのファイルか、それに付随するファイルが存在するかを返します
+func segmentExists(name string) bool {
+	for _, p := range append([]string{name}, companionPaths(name)...) {
+		if fileExists(p) || fileExists(p+".gz") {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentPattern はログファイルのローテーション済みファイル名にマッチする正規表現を返します
+// extに付随するファイルの拡張子（errorLogExtなど）を指定した場合は、そのファイルのローテーション済みファイル名にマッチします
+func segmentPattern(path, ext string) *regexp.Regexp {
+	mainExt := filepath.Ext(path)
+	base := filepath.Base(strings.TrimSuffix(path, mainExt))
+	if ext == "" {
+		ext = mainExt
+	}
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `\.\d{4}-\d{2}-\d{2}(-\d{2})?(\.\d+)?` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+}
+
+// listSegments はローテーション済みのファイルを古い順に返します
+// extには付随するファイルの拡張子を指定します（空の場合はログファイル）
+func listSegments(path, ext string) ([]string, error) {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := segmentPattern(path, ext)
+	type segment struct {
+		path    string
+		modTime time.Time
+	}
+	var segments []segment
+	for _, e := range entries {
+		if e.IsDir() || !pattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{filepath.Join(dir, e.Name()), info.ModTime()})
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		if segments[i].modTime.Equal(segments[j].modTime) {
+			return segments[i].path < segments[j].path
+		}
+		return segments[i].modTime.Before(segments[j].modTime)
+	})
+
+	paths := make([]string, len(segments))
+	for i, s := range segments {
+		paths[i] = s.path
+	}
+	return paths, nil
+}
+
+// rotateIfNeeded は必要に応じてログファイルと付随するファイルをローテーションします
+// 呼び出し側でl.muをロックしておく必要があります
+func (l *Logger) rotateIfNeeded(index int, now time.Time) error {
+	r := l.rotate
+	if r == nil {
+		return nil
+	}
+	path := l.paths[index]
+	if !r.due(index, now, l.files[index], l.errorFiles[path], l.eventFiles[path]) {
+		return nil
+	}
+
+	stamp := r.stamp(r.starts[index])
+	r.starts[index] = r.periodStart(now)
+	return l.cut(index, stamp)
+}
+
+// cut は書き込み中のログファイルと付随するファイル（エラーログ、イベントログ）を閉じてローテーション済みのファイルに移動し、
+// 同じパスで新しいファイルを開きます。移動したファイル以降に書き込まれた行は新しいファイルに記録されます
+// 呼び出し側でl.muをロックしておく必要があります
+func (l *Logger) cut(index int, stamp string) error {
+	path := l.paths[index]
+
+	// 追記された部分のみをアップロードする場合は、切り替える前に残りをパートとして登録する
+	// ローテーション済みのファイルはパートでアップロード済みのため、スプールに登録しない
+	if l.incremental() {
+		if err := l.captureParts(index); err != nil {
+			return err
+		}
+	}
+
+	segment := segmentPath(path, stamp)
+	rotated, err := l.rotateFile(path, segment, &l.files[index])
+	if err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		files map[string]*os.File
+		ext   string
+	}{
+		{l.errorFiles, errorLogExt},
+		{l.eventFiles, eventLogExt},
+	} {
+		file, ok := c.files[path]
+		if !ok {
+			continue
+		}
+		companionRotated, err := l.rotateFile(companionPath(path, c.ext), companionPath(segment, c.ext), &file)
+		if err != nil {
+			return err
+		}
+		c.files[path] = file
+		rotated = append(rotated, companionRotated...)
+	}
+
+	if l.incremental() {
+		for _, p := range rotated {
+			if m := l.manifests[path]; m != nil {
+				m.markQueued(p)
+			}
+		}
+		for _, p := range append([]string{path}, companionPaths(path)...) {
+			if err := l.resetPart(path, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if l.rotate == nil {
+		return nil
+	}
+	if l.rotate.compress {
+		for _, p := range rotated {
+			if err := compressFile(p); err != nil {
+				return fmt.Errorf("ローテーションしたファイルの圧縮に失敗しました %s: %v", p, err)
+			}
+		}
+	}
+	return l.prune(path)
+}
+
+// rotateFile は開いているファイルを閉じてsegmentに移動し、同じパスで新しいファイルを開きます
+// ヘッダー（とCHAINの行）のみの空のファイルは移動しません。移動したファイルのパスを返します
+// ハッシュチェーンが有効な場合は、新しいファイルのチェーンを移動したファイルの最後の行から続けます
+func (l *Logger) rotateFile(path, segment string, file **os.File) ([]string, error) {
+	header := l.formatter().header()
+	if info, err := (*file).Stat(); err == nil && !hasRecords(path, header, info.Size()) {
+		return nil, nil
+	}
+
+	if err := (*file).Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(path, segment); err != nil {
+		return nil, fmt.Errorf("ログファイルのローテーションに失敗しました %s: %v", path, err)
+	}
+	f, err := openLogFile(path, l.formatter())
+	if err != nil {
+		return nil, fmt.Errorf("ローテーション後のログファイルのオープンに失敗しました %s: %v", path, err)
+	}
+	*file = f
+	if l.chains != nil {
+		if err := l.seedChain(f, segment); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+	return []string{segment}, nil
+}
+
+// prune は保持数（max_files）を超えた古いローテーション済みファイルを削除します
+// ローテーションを設定していない場合も、アップロード時に切り替えたファイルに同じ保持数を適用します
+// アップロードが有効な場合、まだスプールに登録していないファイルはアップロードの前に失われないよう削除しません
+// （登録済みのファイルはスプールにハードリンクがあるため、削除してもアップロードできます）
+func (l *Logger) prune(path string) error {
+	if l.config == nil || l.config.Rotation.MaxFiles <= 0 {
+		return nil
+	}
+	maxFiles := l.config.Rotation.MaxFiles
+	m := l.manifests[path]
+
+	var lastErr error
+	for _, ext := range append([]string{""}, companionExts...) {
+		segments, err := listSegments(path, ext)
+		if err != nil {
+			return err
+		}
+		for _, s := range segments[:max(len(segments)-maxFiles, 0)] {
+			if l.uploader != nil && (m == nil || !m.queued(s)) {
+				continue
+			}
+			if err := os.Remove(s); err != nil && !os.IsNotExist(err) {
+				lastErr = err
+			}
+			if m != nil {
+				m.forget(s)
+			}
+		}
+	}
+	return lastErr
+}
+
+// compressFile はファイルをgzipで圧縮して.gzファイルに置き換えます
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	zw.ModTime = info.ModTime()
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+
+	// 保持数の判定で順序が変わらないよう、元のファイルの更新時刻を引き継ぐ
+	os.Chtimes(dst.Name(), info.ModTime(), info.ModTime())
+	return os.Remove(path)
+}
+
+// pendingSegments はまだスプールに登録していないローテーション済みファイルを古い順に返します
+func (l *Logger) pendingSegments(path string) []string {
+	var pending []string
+	for _, ext := range append([]string{""}, companionExts...) {
+		segments, err := listSegments(path, ext)
+		if err != nil {
+			continue
+		}
+		for _, s := range segments {
+			if m := l.manifests[path]; m == nil || !m.queued(s) {
+				pending = append(pending, s)
+			}
+		}
+	}
+	return pending
+}
+
+// fileExists はファイルが存在するかを返します
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
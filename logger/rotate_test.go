@@ -0,0 +1,257 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"512", 512, false},
+		{"100B", 100, false},
+		{"10KB", 10 << 10, false},
+		{"10mb", 10 << 20, false},
+		{"1 GB", 1 << 30, false},
+		{"0MB", 0, true},
+		{"-1MB", 0, true},
+		{"ten", 0, true},
+		{"1.5MB", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// newRotatingLogger はテスト用にローテーションを有効にしたLoggerを生成します
+func newRotatingLogger(t *testing.T, cfg RotationConfig) (*Logger, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "example.com.log")
+	file, err := openLogFile(path, textFormatter{})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	errorFile, err := openLogFile(getErrorLogFilePath(path), textFormatter{})
+	if err != nil {
+		t.Fatalf("エラーログファイルのオープンに失敗しました: %v", err)
+	}
+	rotate, err := newRotator(cfg, []string{path})
+	if err != nil {
+		t.Fatalf("newRotatorに失敗しました: %v", err)
+	}
+	l := &Logger{
+		files:      []*os.File{file},
+		errorFiles: map[string]*os.File{path: errorFile},
+		paths:      []string{path},
+		config:     &Config{Rotation: cfg},
+		rotate:     rotate,
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, path
+}
+
+func TestRotateBySize(t *testing.T) {
+	l, path := newRotatingLogger(t, RotationConfig{MaxSize: "100B"})
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+
+	for i := 0; i < 5; i++ {
+		if err := l.LogSuccess(0, "example.com", result); err != nil {
+			t.Fatalf("LogSuccessに失敗しました: %v", err)
+		}
+		if err := l.LogError(0, "example.com", fmt.Errorf("request timed out")); err != nil {
+			t.Fatalf("LogErrorに失敗しました: %v", err)
+		}
+	}
+
+	stamp := time.Now().Format("2006-01-02")
+	dir := filepath.Dir(path)
+	for _, name := range []string{
+		"example.com." + stamp + ".log",
+		"example.com." + stamp + ".1.log",
+		"example.com." + stamp + ".error.log",
+		"example.com." + stamp + ".1.error.log",
+	} {
+		if !fileExists(filepath.Join(dir, name)) {
+			t.Errorf("ローテーションしたファイル%sが存在しません", name)
+		}
+	}
+
+	// 書き込み中のファイルは上限を超えない
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("ログファイルが存在しません: %v", err)
+	}
+	if info.Size() >= 200 {
+		t.Errorf("ログファイルのサイズ = %d, ローテーションされていません", info.Size())
+	}
+
+	// アップロード対象はローテーション済みのファイルのみ
+	for _, p := range l.pendingSegments(path) {
+		if p == path || p == getErrorLogFilePath(path) {
+			t.Errorf("書き込み中のファイル%sがアップロード対象に含まれています", p)
+		}
+	}
+	if got := len(l.pendingSegments(path)); got < 4 {
+		t.Errorf("アップロード対象 = %d件, want at least 4", got)
+	}
+}
+
+func TestRotateByPeriod(t *testing.T) {
+	l, path := newRotatingLogger(t, RotationConfig{Period: PeriodDaily})
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+
+	if err := l.LogSuccess(0, "example.com", result); err != nil {
+		t.Fatalf("LogSuccessに失敗しました: %v", err)
+	}
+	// 前日から書き込んでいたファイルとして扱う
+	yesterday := time.Now().AddDate(0, 0, -1)
+	l.rotate.starts[0] = l.rotate.periodStart(yesterday)
+
+	if err := l.LogSuccess(0, "example.com", result); err != nil {
+		t.Fatalf("LogSuccessに失敗しました: %v", err)
+	}
+
+	segment := filepath.Join(filepath.Dir(path), "example.com."+yesterday.Format("2006-01-02")+".log")
+	content, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("ローテーションしたファイルが存在しません: %v", err)
+	}
+	if n := strings.Count(string(content), "\n"); n != 1 {
+		t.Errorf("ローテーションしたファイルの行数 = %d, want 1", n)
+	}
+	// 空のエラーログはローテーションしない
+	if fileExists(getErrorLogFilePath(segment)) {
+		t.Errorf("空のエラーログファイルがローテーションされました")
+	}
+	content, _ = os.ReadFile(path)
+	if n := strings.Count(string(content), "\n"); n != 1 {
+		t.Errorf("新しいログファイルの行数 = %d, want 1", n)
+	}
+}
+
+func TestRotateCompressAndPrune(t *testing.T) {
+	l, path := newRotatingLogger(t, RotationConfig{MaxSize: "50B", Compress: true, MaxFiles: 2})
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+
+	for i := 0; i < 6; i++ {
+		if err := l.LogSuccess(0, "example.com", result); err != nil {
+			t.Fatalf("LogSuccessに失敗しました: %v", err)
+		}
+	}
+
+	segments, err := listSegments(path, "")
+	if err != nil {
+		t.Fatalf("listSegmentsに失敗しました: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("ローテーション済みファイル = %v, want 2 files", segments)
+	}
+	for _, s := range segments {
+		if !strings.HasSuffix(s, ".log.gz") {
+			t.Errorf("%sが圧縮されていません", s)
+			continue
+		}
+		f, err := os.Open(s)
+		if err != nil {
+			t.Fatalf("圧縮ファイルのオープンに失敗しました: %v", err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzipの読み込みに失敗しました: %v", err)
+		}
+		content, _ := io.ReadAll(zr)
+		f.Close()
+		if !strings.Contains(string(content), "SUCCESS - Target: example.com") {
+			t.Errorf("圧縮ファイルの内容が不正です: %q", content)
+		}
+	}
+}
+
+func TestPruneKeepsSegmentsUntilQueued(t *testing.T) {
+	// アップロードの間隔よりも短い間隔でローテーションする
+	l, fake, path := newUploadingLogger(t, false, `[rotation]`, `max_size = "50B"`, `max_files = 2`)
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+
+	const lines = 6
+	for i := 0; i < lines; i++ {
+		if err := l.LogSuccess(0, fmt.Sprintf("target-%d", i), result); err != nil {
+			t.Fatalf("LogSuccessに失敗しました: %v", err)
+		}
+	}
+
+	// スプールに登録していないファイルは保持数を超えても削除しない
+	segments, err := listSegments(path, "")
+	if err != nil {
+		t.Fatalf("listSegmentsに失敗しました: %v", err)
+	}
+	if len(segments) != lines-1 {
+		t.Errorf("アップロード前のローテーション済みファイル = %d件, want %d", len(segments), lines-1)
+	}
+
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+
+	// すべての行がアップロードされる
+	uploaded := strings.Join(fake.contents(), "")
+	for i := 0; i < lines; i++ {
+		if line := fmt.Sprintf("Target: target-%d,", i); strings.Count(uploaded, line) != 1 {
+			t.Errorf("%qがちょうど1回アップロードされていません", line)
+		}
+	}
+
+	// スプールに登録した後は保持数まで削除する
+	if segments, _ = listSegments(path, ""); len(segments) != 2 {
+		t.Errorf("アップロード後のローテーション済みファイル = %v, want 2 files", segments)
+	}
+}
+
+func TestSegmentPattern(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+		want bool
+	}{
+		{"example.com.2025-02-20.log", "", true},
+		{"example.com.2025-02-20-13.log", "", true},
+		{"example.com.2025-02-20.3.log.gz", "", true},
+		{"example.com.log", "", false},
+		{"example.com.error.log", "", false},
+		{"example.com.2025-02-20.error.log", "", false},
+		{"example.com.2025-02-20.events.log", "", false},
+		{"example.com.2025-02-20.error.log", errorLogExt, true},
+		{"example.com.2025-02-20.1.error.log.gz", errorLogExt, true},
+		{"example.com.error.log", errorLogExt, false},
+		{"example.com.2025-02-20.events.log", errorLogExt, false},
+		{"example.com.2025-02-20.events.log", eventLogExt, true},
+		{"example.com.events.log", eventLogExt, false},
+		{"example.org.2025-02-20.log", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := segmentPattern("logs/example.com.log", tt.ext).MatchString(tt.name); got != tt.want {
+			t.Errorf("segmentPattern(%q).MatchString(%q) = %v, want %v", tt.ext, tt.name, got, tt.want)
+		}
+	}
+}
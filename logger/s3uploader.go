@@ -1,17 +1,26 @@
 package logger
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3Config はS3アップロードの設定を保持します
@@ -27,16 +36,87 @@ type S3Config struct {
 	Schedule       string `toml:"schedule"`         // cron式でのスケジュール
 	UploadTime     string `toml:"upload_time"`      // HH:MM形式（後方互換性用）
 	DeleteAfter    bool   `toml:"delete_after"`
+	SpoolDir       string `toml:"spool_dir"`       // アップロード待ちのファイルを保持するディレクトリ（デフォルト: ログファイルと同じ場所の.pingood-spool）
+	RetryInitial   string `toml:"retry_initial"`   // 最初の再送までの間隔（デフォルト: 30s）
+	RetryMax       string `toml:"retry_max"`       // 再送間隔の上限（デフォルト: 1h）
+	UploadMode     string `toml:"upload_mode"`     // "segment"（デフォルト）または "incremental"
+	Compression    string `toml:"compression"`     // アップロード時の圧縮方式（"gzip"、"zstd"、空の場合は圧縮しない）
+	SigningKey     string `toml:"signing_key"`     // オブジェクトに署名するEd25519の秘密鍵のパス（空の場合は署名しない）
+	RequestTimeout string `toml:"request_timeout"` // S3への1回のリクエストのタイムアウト（デフォルト: 5m）
+}
+
+// DefaultRequestTimeout はS3への1回のリクエストのタイムアウトのデフォルト値です
+const DefaultRequestTimeout = 5 * time.Minute
+
+// requestTimeout はS3への1回のリクエストのタイムアウトを返します
+func (c S3Config) requestTimeout() time.Duration {
+	if d, err := time.ParseDuration(c.RequestTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultRequestTimeout
 }
 
 // S3Uploader はS3へのアップロード機能を提供します
 type S3Uploader struct {
-	client *s3.Client
-	config S3Config
+	client    *s3.Client
+	config    S3Config
+	signer    ed25519.PrivateKey // nilの場合は署名しない
+	succeeded atomic.Uint64      // アップロードに成功したオブジェクトの数
+	failed    atomic.Uint64      // アップロードに失敗した回数
+
+	mu     sync.Mutex
+	ctx    context.Context // 実行中のリクエストをabortで中断するためのコンテキスト
+	cancel context.CancelFunc
+}
+
+// requestContext はS3への1回のリクエストに使用する、タイムアウト付きのコンテキストを返します
+func (u *S3Uploader) requestContext() (context.Context, context.CancelFunc) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return context.WithTimeout(u.ctx, u.config.requestTimeout())
+}
+
+// abortContext は実行中のリクエストの親コンテキストを返します
+// 返したコンテキストはabortを呼び出すとキャンセルされます
+func (u *S3Uploader) abortContext() context.Context {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.ctx
+}
+
+// abort は実行中のリクエストを中断します
+// 以降のリクエストは新しいコンテキストで実行するため、停止時の最終アップロードは行えます
+func (u *S3Uploader) abort() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cancel()
+	u.ctx, u.cancel = context.WithCancel(context.Background())
+}
+
+// UploadStats は起動してからのアップロードの回数です
+type UploadStats struct {
+	Succeeded uint64 // アップロードと確認に成功したオブジェクトの数
+	Failed    uint64 // アップロードまたは確認に失敗した回数（再送を含む）
+}
+
+// Stats は起動してからのアップロードの回数を返します
+func (u *S3Uploader) Stats() UploadStats {
+	return UploadStats{Succeeded: u.succeeded.Load(), Failed: u.failed.Load()}
 }
 
 // NewS3Uploader は新しいS3Uploaderインスタンスを作成します
 func NewS3Uploader(cfg S3Config) (*S3Uploader, error) {
+	if err := validateCompression(cfg.Compression); err != nil {
+		return nil, err
+	}
+	var signer ed25519.PrivateKey
+	if cfg.SigningKey != "" {
+		var err error
+		if signer, err = LoadSigningKey(cfg.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+
 	// 認証情報を設定
 	creds := aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
 		cfg.AccessKey,
@@ -90,51 +170,235 @@ func NewS3Uploader(cfg S3Config) (*S3Uploader, error) {
 	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
 		o.UsePathStyle = cfg.ForcePathStyle
 	})
+	ctx, cancel := context.WithCancel(context.Background())
 	return &S3Uploader{
 		client: client,
 		config: cfg,
+		signer: signer,
+		ctx:    ctx,
+		cancel: cancel,
 	}, nil
 }
 
-// UploadFile は指定されたファイルをS3にアップロードします
-func (u *S3Uploader) UploadFile(filePath string) error {
+// uploadRecord はアップロードしたオブジェクトの記録です
+type uploadRecord struct {
+	Key          string    `json:"key"`
+	Source       string    `json:"source"`               // アップロード元のファイル
+	Size         int64     `json:"size"`                 // アップロード元のファイルのサイズ
+	SHA256       string    `json:"sha256"`               // アップロード元のファイルのSHA-256（16進数）
+	ObjectSize   int64     `json:"object_size"`          // オブジェクトのサイズ（圧縮した場合は圧縮後）
+	ObjectSHA256 string    `json:"object_sha256"`        // オブジェクトのSHA-256（S3のチェックサムと同じ値、Base64）
+	ChainHead    string    `json:"chain_head,omitempty"` // 最後の行のハッシュ（hash_chainの場合のみ）
+	Statement    string    `json:"statement,omitempty"`  // 署名した文（signing_keyの場合のみ）
+	Signature    string    `json:"signature,omitempty"`  // 署名した文へのEd25519署名（Base64、signing_keyの場合のみ）
+	Uploaded     time.Time `json:"uploaded"`
+}
+
+// upload はファイルをnameのファイル名でS3にアップロードし、アップロードされたオブジェクトを確認します
+func (u *S3Uploader) upload(filePath, name string, metadata map[string]string) (*uploadRecord, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ファイル情報の取得に失敗しました: %v", err)
+	}
+
+	// S3のキーを生成（プレフィックス + 日付 + ファイル名_タイムスタンプ）
+	// 再送時に同じキーになるよう、切り替え後に変更されないファイルの更新時刻を使用する
+	return u.uploadKey(filePath, u.objectKey(name, info.ModTime()), metadata)
+}
+
+// uploadKey はファイルをkeyのオブジェクトとしてS3にアップロードし、成功と失敗の回数を記録します
+func (u *S3Uploader) uploadKey(filePath, key string, metadata map[string]string) (*uploadRecord, error) {
+	record, err := u.putObject(filePath, key, metadata)
+	if err != nil {
+		u.failed.Add(1)
+		return nil, err
+	}
+	u.succeeded.Add(1)
+	return record, nil
+}
+
+// putObject はファイルをkeyのオブジェクトとしてS3にアップロードし、アップロードされたオブジェクトを確認します
+// keyに圧縮方式の拡張子が付いている場合は、圧縮してからアップロードします
+// オブジェクトのSHA-256をチェックサムとして送信し、HeadObjectでS3に保存された値と一致することを確認します
+// metadataはオブジェクトのユーザー定義メタデータ（x-amz-meta-*）として保存します
+func (u *S3Uploader) putObject(filePath, key string, metadata map[string]string) (*uploadRecord, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("ファイルのオープンに失敗しました: %v", err)
+		return nil, fmt.Errorf("ファイルのオープンに失敗しました: %v", err)
 	}
 	defer file.Close()
 
-	// S3のキーを生成（プレフィックス + 日付 + ファイル名_タイムスタンプ）
-	now := time.Now()
-	baseFileName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
-	ext := filepath.Ext(filePath)
-	key := fmt.Sprintf("%s/%s/%s_%s%s",
-		u.config.KeyPrefix,
-		now.Format("2006/01/02"),
-		baseFileName,
-		now.Format("2006_01_02_15_04_05"),
-		ext,
-	)
+	// アップロード前にファイルのハッシュを計算する
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, fmt.Errorf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	record := &uploadRecord{
+		Key:          key,
+		Source:       filePath,
+		Size:         size,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		ObjectSize:   size,
+		ObjectSHA256: base64.StdEncoding.EncodeToString(hash.Sum(nil)),
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:        &u.config.Bucket,
+		Key:           &key,
+		Body:          file,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType(key)),
+		Metadata:      metadata,
+	}
+	if u.compresses(filePath, key) {
+		// Content-LengthとチェックサムをPutObjectの前に求めるため、圧縮した内容は同じディレクトリの一時ファイルに書き出す
+		tmp, err := os.CreateTemp(filepath.Dir(filePath), ".pingood-compress-*")
+		if err != nil {
+			return nil, fmt.Errorf("圧縮用の一時ファイルの作成に失敗しました: %v", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		sum := sha256.New()
+		if err := compressPayload(u.config.Compression, io.MultiWriter(tmp, sum), file); err != nil {
+			return nil, err
+		}
+		size, err := tmp.Seek(0, io.SeekCurrent)
+		if err == nil {
+			_, err = tmp.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("圧縮したファイルの読み込みに失敗しました: %v", err)
+		}
+
+		input.Body = tmp
+		input.ContentLength = aws.Int64(size)
+		record.ObjectSize = size
+		record.ObjectSHA256 = base64.StdEncoding.EncodeToString(sum.Sum(nil))
+	}
+	input.ChecksumSHA256 = aws.String(record.ObjectSHA256)
 
 	// S3にアップロード
-	_, err = u.client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket: &u.config.Bucket,
-		Key:    &key,
-		Body:   file,
+	ctx, cancel := u.requestContext()
+	_, err = u.client.PutObject(ctx, input)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("S3へのアップロードに失敗しました: %v", err)
+	}
+
+	// アップロードされたオブジェクトを確認
+	ctx, cancel = u.requestContext()
+	defer cancel()
+	head, err := u.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       &u.config.Bucket,
+		Key:          &key,
+		ChecksumMode: types.ChecksumModeEnabled,
 	})
 	if err != nil {
-		return fmt.Errorf("S3へのアップロードに失敗しました: %v", err)
+		return nil, fmt.Errorf("アップロードしたオブジェクトの確認に失敗しました: %v", err)
+	}
+	if got := aws.ToInt64(head.ContentLength); got != record.ObjectSize {
+		return nil, fmt.Errorf("アップロードしたオブジェクトのサイズが一致しません %s: expected %d, got %d", key, record.ObjectSize, got)
 	}
+	// チェックサムを返さないS3互換ストレージではサイズのみを確認する
+	if got := aws.ToString(head.ChecksumSHA256); got != "" && got != record.ObjectSHA256 {
+		return nil, fmt.Errorf("アップロードしたオブジェクトのチェックサムが一致しません %s: expected %s, got %s", key, record.ObjectSHA256, got)
+	}
+
+	record.Uploaded = time.Now()
 
-	// アップロード後に削除が指定されている場合
-	if u.config.DeleteAfter {
-		if err := os.Remove(filePath); err != nil {
-			return fmt.Errorf("ファイルの削除に失敗しました: %v", err)
+	// 署名をオブジェクトと同じ場所にアップロードする
+	if u.signer != nil {
+		if err := u.uploadSignature(filePath, record, metadata[chainMetadataKey]); err != nil {
+			return nil, err
 		}
 	}
+	return record, nil
+}
+
+// uploadSignature はアップロードの記録に署名し、keyに.sigを付けたオブジェクトとしてアップロードします
+// 署名する文はアップロードの記録のうち、キー、ログの内容（圧縮前）のSHA-256、チェーンの先頭、アップロードの時刻です
+// 圧縮前の内容に対して署名するため、オブジェクトを展開したファイルも検証できます
+func (u *S3Uploader) uploadSignature(filePath string, record *uploadRecord, chainHead string) error {
+	statement, sig, err := signFile(u.signer, filePath, record.Key, chainHead, record.Uploaded)
+	if err != nil {
+		return err
+	}
+	sigKey := record.Key + signatureExt
+	if err := u.putText(sigKey, signatureFile(statement, sig)); err != nil {
+		return fmt.Errorf("署名のアップロードに失敗しました %s: %v", sigKey, err)
+	}
+	record.Statement, record.Signature = statement, sig
 	return nil
 }
 
+// uploadManifest は1回のアップロードで署名したオブジェクトの一覧に署名し、マニフェストとしてアップロードします
+// キーは{key_prefix}/manifests/{日付}/manifest_{時刻}.txtで、アップロードしたキーを返します
+func (u *S3Uploader) uploadManifest(records []*uploadRecord, uploaded time.Time) (string, error) {
+	body, err := signManifest(u.signer, records, uploaded)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("%s/manifests/%s/manifest_%s.txt",
+		u.config.KeyPrefix,
+		uploaded.Format("2006/01/02"),
+		uploaded.Format("2006_01_02_15_04_05.000000000"),
+	)
+	if err := u.putText(key, body); err != nil {
+		return "", fmt.Errorf("マニフェストのアップロードに失敗しました %s: %v", key, err)
+	}
+	return key, nil
+}
+
+// putText はテキストをkeyのオブジェクトとしてアップロードします
+func (u *S3Uploader) putText(key, text string) error {
+	body := []byte(text)
+	sum := sha256.Sum256(body)
+	ctx, cancel := u.requestContext()
+	defer cancel()
+	_, err := u.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:         &u.config.Bucket,
+		Key:            &key,
+		Body:           bytes.NewReader(body),
+		ContentLength:  aws.Int64(int64(len(body))),
+		ContentType:    aws.String("text/plain; charset=utf-8"),
+		ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+	})
+	return err
+}
+
+// compresses はファイルを圧縮してkeyにアップロードするかを返します
+// ローテーションで圧縮済みのファイルは、そのままアップロードします
+func (u *S3Uploader) compresses(filePath, key string) bool {
+	ext := compressionExt(u.config.Compression)
+	return ext != "" && strings.HasSuffix(key, ext) && !isCompressed(filePath)
+}
+
+// keyExt はファイルのキーに付ける拡張子を返します（圧縮する場合は圧縮方式の拡張子を追加します）
+func (u *S3Uploader) keyExt(name string) string {
+	ext := filepath.Ext(name)
+	if !isCompressed(name) {
+		ext += compressionExt(u.config.Compression)
+	}
+	return ext
+}
+
+// objectKey はファイルのアップロード先のキーを返します
+func (u *S3Uploader) objectKey(name string, t time.Time) string {
+	baseFileName := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	return fmt.Sprintf("%s/%s/%s_%s%s",
+		u.config.KeyPrefix,
+		t.Format("2006/01/02"),
+		baseFileName,
+		t.Format("2006_01_02_15_04_05"),
+		u.keyExt(name),
+	)
+}
+
 // ParseUploadTime は設定された時刻をパースします
 func (u *S3Uploader) ParseUploadTime() (time.Time, error) {
 	now := time.Now()
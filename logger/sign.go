@@ -0,0 +1,403 @@
+package logger
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// signatureExt は署名ファイルとそのオブジェクトのキーに付ける拡張子です
+const signatureExt = ".sig"
+
+// PEM形式のブロックの種類
+const (
+	privateKeyPEMType = "PRIVATE KEY"
+	publicKeyPEMType  = "PUBLIC KEY"
+)
+
+// ErrSignatureMismatch は署名がファイルの内容と一致しない場合のエラーです
+var ErrSignatureMismatch = errors.New("署名が一致しません（ファイルが改ざんされたか、別の鍵で署名されています）")
+
+// GenerateSigningKey はEd25519の鍵ペアを生成し、秘密鍵をpathに、公開鍵をpath.pubに保存します
+// 鍵はPEM形式（秘密鍵はPKCS #8、公開鍵はPKIX）で保存し、秘密鍵のパーミッションは0600とします
+// 既存の鍵を上書きしないよう、どちらかのファイルが存在する場合はエラーを返します
+func GenerateSigningKey(path string) (string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("鍵の生成に失敗しました: %v", err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", fmt.Errorf("秘密鍵の変換に失敗しました: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("公開鍵の変換に失敗しました: %v", err)
+	}
+
+	pubPath := path + ".pub"
+	if err := writePEM(path, privateKeyPEMType, privDER, 0600); err != nil {
+		return "", err
+	}
+	if err := writePEM(pubPath, publicKeyPEMType, pubDER, 0644); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return pubPath, nil
+}
+
+// writePEM はDER形式の鍵をPEM形式で新しいファイルに書き込みます
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("鍵ファイルの作成に失敗しました: %v", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("鍵ファイルの書き込みに失敗しました %s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// readPEM はPEM形式のファイルから指定した種類のブロックを読み込みます
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("鍵ファイルの読み込みに失敗しました: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%sは%sのPEMファイルではありません", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// LoadSigningKey はGenerateSigningKeyで生成した秘密鍵を読み込みます
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, privateKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("秘密鍵の読み込みに失敗しました %s: %v", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%sはEd25519の秘密鍵ではありません", path)
+	}
+	return priv, nil
+}
+
+// LoadVerifyKey はGenerateSigningKeyで生成した公開鍵を読み込みます
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, publicKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("公開鍵の読み込みに失敗しました %s: %v", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%sはEd25519の公開鍵ではありません", path)
+	}
+	return pub, nil
+}
+
+// contentDigest はログの内容のSHA-256を返します
+// 圧縮されたファイル（.gz、.zst）は展開した内容のハッシュを返すため、アップロード時の圧縮の有無に関係なく同じ値になります
+func contentDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := decompressReader(path, f)
+	if err != nil {
+		return nil, fmt.Errorf("ファイルの展開に失敗しました %s: %v", path, err)
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// signatureVersion は署名する文の1行目です
+// pingoodのアップロードの署名であることと形式の版を表し、他の用途の署名と取り違えないようにします
+const signatureVersion = "pingood-upload-signature-v1"
+
+// signatureField は署名ファイルの最後の行で、署名（Base64）の前に付ける項目名です
+const signatureField = "signature: "
+
+// ErrSignatureTarget は署名が別のオブジェクトに対するものである場合のエラーです
+var ErrSignatureTarget = errors.New("署名は別のオブジェクトに対するものです")
+
+// Statement は署名する文で、アップロードしたオブジェクトの記録です
+// 鍵で署名するのはStatementを正規化した文字列で、ログの内容だけでなくキー、チェーンの先頭、アップロードの時刻も検証できます
+type Statement struct {
+	Key       string    // オブジェクトのキー
+	SHA256    string    // ログの内容（圧縮前）のSHA-256（16進数）
+	ChainHead string    // 最後の行のハッシュ（hash_chainでない場合は空）
+	Uploaded  time.Time // アップロードした時刻
+}
+
+// String は署名する文を正規化した文字列（項目ごとに1行）で返します
+func (s Statement) String() string {
+	head := s.ChainHead
+	if head == "" {
+		head = "-"
+	}
+	return signatureVersion + "\n" +
+		"key: " + s.Key + "\n" +
+		"sha256: " + s.SHA256 + "\n" +
+		"chain-head: " + head + "\n" +
+		"uploaded: " + s.Uploaded.UTC().Format(time.RFC3339Nano) + "\n"
+}
+
+// parseStatement は正規化した文字列から署名する文を読み込みます
+func parseStatement(text string) (Statement, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	fields := []string{"key: ", "sha256: ", "chain-head: ", "uploaded: "}
+	if len(lines) != len(fields)+1 || lines[0] != signatureVersion {
+		return Statement{}, fmt.Errorf("署名する文の形式が不正です")
+	}
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		v, ok := strings.CutPrefix(lines[i+1], field)
+		if !ok {
+			return Statement{}, fmt.Errorf("署名する文に%sがありません", strings.TrimSuffix(field, ": "))
+		}
+		values[i] = v
+	}
+
+	s := Statement{Key: values[0], SHA256: values[1], ChainHead: values[2]}
+	if s.ChainHead == "-" {
+		s.ChainHead = ""
+	}
+	uploaded, err := time.Parse(time.RFC3339Nano, values[3])
+	if err != nil {
+		return Statement{}, fmt.Errorf("署名する文のアップロードの時刻が不正です: %s", values[3])
+	}
+	s.Uploaded = uploaded
+	return s, nil
+}
+
+// signFile はログの内容のSHA-256、キー、チェーンの先頭、アップロードの時刻を署名する文にまとめて署名します
+// 署名する文と、Base64でエンコードした署名を返します
+func signFile(priv ed25519.PrivateKey, path, key, chainHead string, uploaded time.Time) (string, string, error) {
+	if strings.ContainsAny(key, "\r\n") {
+		return "", "", fmt.Errorf("キーに改行が含まれています: %q", key)
+	}
+	digest, err := contentDigest(path)
+	if err != nil {
+		return "", "", fmt.Errorf("署名するファイルの読み込みに失敗しました: %v", err)
+	}
+	statement := Statement{Key: key, SHA256: hex.EncodeToString(digest), ChainHead: chainHead, Uploaded: uploaded}.String()
+	return statement, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(statement))), nil
+}
+
+// signatureFile は署名ファイル（.sig）の内容を返します
+// 署名する文の後に、署名をsignatureFieldの行として続けます
+func signatureFile(statement, sig string) string {
+	return statement + signatureField + sig + "\n"
+}
+
+// VerifySignatureFile はログファイルをsigPathの署名ファイルと公開鍵で検証し、署名された文を返します
+// 署名する文の署名、ログの内容（圧縮されたファイルは展開した内容）のSHA-256、ファイル名とキーの一致を確認します
+func VerifySignatureFile(pub ed25519.PublicKey, path, sigPath string) (*Statement, error) {
+	text, err := readSigned(pub, sigPath)
+	if err != nil {
+		return nil, err
+	}
+	statement, err := parseStatement(text)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, sigPath)
+	}
+
+	if err := checkDigest(path, statement.SHA256); err != nil {
+		return nil, err
+	}
+	// 別のオブジェクトの署名を流用していないことを確認する
+	if !matchesKey(path, statement.Key) {
+		return nil, fmt.Errorf("%w: %s（署名したキー: %s）", ErrSignatureTarget, filepath.Base(path), statement.Key)
+	}
+	return &statement, nil
+}
+
+// readSigned は最後の行に署名を付けたファイル（署名ファイルとマニフェスト）を公開鍵で検証し、署名された部分を返します
+func readSigned(pub ed25519.PublicKey, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("署名ファイルの読み込みに失敗しました: %v", err)
+	}
+	text := string(data)
+	i := strings.LastIndex(text, signatureField)
+	if i < 0 || (i > 0 && text[i-1] != '\n') {
+		return "", fmt.Errorf("署名ファイルの形式が不正です: %s", path)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text[i+len(signatureField):]))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return "", fmt.Errorf("署名ファイルの形式が不正です: %s", path)
+	}
+	if !ed25519.Verify(pub, []byte(text[:i]), sig) {
+		return "", ErrSignatureMismatch
+	}
+	return text[:i], nil
+}
+
+// checkDigest はログの内容（圧縮されたファイルは展開した内容）のSHA-256が署名した値と一致するかを確認します
+func checkDigest(path, want string) error {
+	digest, err := contentDigest(path)
+	if err != nil {
+		return fmt.Errorf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	if hex.EncodeToString(digest) != want {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// matchesKey はファイル名がオブジェクトのキーの最後の要素と一致するかを返します
+// ダウンロード後に展開した場合は、圧縮方式の拡張子を除いた名前と比較します
+func matchesKey(path, key string) bool {
+	name, object := filepath.Base(path), filepath.Base(key)
+	return name == object || (isCompressed(object) && name == strings.TrimSuffix(object, filepath.Ext(object)))
+}
+
+// manifestVersion はマニフェストの1行目です
+const manifestVersion = "pingood-upload-manifest-v1"
+
+// ErrManifestIncomplete はマニフェストに記載されたオブジェクトのファイルが指定されていない場合のエラーです
+var ErrManifestIncomplete = errors.New("マニフェストに記載されたオブジェクトのファイルがありません（オブジェクトが削除された可能性があります）")
+
+// ManifestEntry はマニフェストに記載する1つのオブジェクトです
+type ManifestEntry struct {
+	Key       string // オブジェクトのキー
+	SHA256    string // ログの内容（圧縮前）のSHA-256（16進数）
+	ChainHead string // 最後の行のハッシュ（hash_chainでない場合は空）
+}
+
+// Manifest は1回のアップロードでアップロードしたオブジェクトの一覧です
+// オブジェクトごとの署名ではオブジェクトの削除を検出できないため、一覧にまとめて署名します
+type Manifest struct {
+	Uploaded time.Time // アップロードした時刻
+	Entries  []ManifestEntry
+}
+
+// String はマニフェストを正規化した文字列（オブジェクトごとに1行）で返します
+// キーには空白が含まれる可能性があるため、各行の最後に置きます
+func (m Manifest) String() string {
+	var b strings.Builder
+	b.WriteString(manifestVersion + "\n")
+	b.WriteString("uploaded: " + m.Uploaded.UTC().Format(time.RFC3339Nano) + "\n")
+	for _, e := range m.Entries {
+		head := e.ChainHead
+		if head == "" {
+			head = "-"
+		}
+		fmt.Fprintf(&b, "object: %s %s %s\n", e.SHA256, head, e.Key)
+	}
+	return b.String()
+}
+
+// parseManifest は正規化した文字列からマニフェストを読み込みます
+func parseManifest(text string) (Manifest, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) < 2 || lines[0] != manifestVersion {
+		return Manifest{}, fmt.Errorf("マニフェストの形式が不正です")
+	}
+	v, ok := strings.CutPrefix(lines[1], "uploaded: ")
+	if !ok {
+		return Manifest{}, fmt.Errorf("マニフェストにuploadedがありません")
+	}
+	uploaded, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("マニフェストのアップロードの時刻が不正です: %s", v)
+	}
+
+	m := Manifest{Uploaded: uploaded}
+	for _, line := range lines[2:] {
+		v, ok := strings.CutPrefix(line, "object: ")
+		fields := strings.SplitN(v, " ", 3)
+		if !ok || len(fields) != 3 {
+			return Manifest{}, fmt.Errorf("マニフェストの行が不正です: %s", line)
+		}
+		e := ManifestEntry{SHA256: fields[0], ChainHead: fields[1], Key: fields[2]}
+		if e.ChainHead == "-" {
+			e.ChainHead = ""
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	return m, nil
+}
+
+// signManifest はアップロードしたオブジェクトの署名した文からマニフェストを作成して署名し、マニフェストのファイルの内容を返します
+func signManifest(priv ed25519.PrivateKey, records []*uploadRecord, uploaded time.Time) (string, error) {
+	m := Manifest{Uploaded: uploaded}
+	for _, r := range records {
+		statement, err := parseStatement(r.Statement)
+		if err != nil {
+			return "", fmt.Errorf("%v: %s", err, r.Key)
+		}
+		m.Entries = append(m.Entries, ManifestEntry{Key: statement.Key, SHA256: statement.SHA256, ChainHead: statement.ChainHead})
+	}
+	text := m.String()
+	return signatureFile(text, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(text)))), nil
+}
+
+// VerifyManifestFile はマニフェストの署名を公開鍵で検証し、pathsのファイルをマニフェストの記載と照合します
+// 各ファイルはキーの最後の要素が一致する記載の内容のSHA-256と比較し、記載のないファイルはErrSignatureTargetとします
+// pathsを指定した場合、ファイルのない記載があればErrManifestIncompleteを返します（オブジェクトの削除の検出）
+func VerifyManifestFile(pub ed25519.PublicKey, manifestPath string, paths []string) (*Manifest, error) {
+	text, err := readSigned(pub, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseManifest(text)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, manifestPath)
+	}
+
+	found := make([]bool, len(m.Entries))
+	for _, path := range paths {
+		i := slices.IndexFunc(m.Entries, func(e ManifestEntry) bool { return matchesKey(path, e.Key) })
+		if i < 0 {
+			return &m, fmt.Errorf("%w: %s（マニフェストに記載がありません）", ErrSignatureTarget, filepath.Base(path))
+		}
+		if err := checkDigest(path, m.Entries[i].SHA256); err != nil {
+			return &m, fmt.Errorf("%s: %w", path, err)
+		}
+		found[i] = true
+	}
+	if len(paths) > 0 {
+		var missing []string
+		for i, e := range m.Entries {
+			if !found[i] {
+				missing = append(missing, e.Key)
+			}
+		}
+		if len(missing) > 0 {
+			return &m, fmt.Errorf("%w: %s", ErrManifestIncomplete, strings.Join(missing, ", "))
+		}
+	}
+	return &m, nil
+}
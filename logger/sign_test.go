@@ -0,0 +1,308 @@
+package logger
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+// newSigningKey はテスト用の鍵ペアを生成し、秘密鍵と公開鍵のパスを返します
+func newSigningKey(t *testing.T) (string, string) {
+	t.Helper()
+	keyPath := filepath.Join(t.TempDir(), "pingood.key")
+	pubPath, err := GenerateSigningKey(keyPath)
+	if err != nil {
+		t.Fatalf("GenerateSigningKeyに失敗しました: %v", err)
+	}
+	return keyPath, pubPath
+}
+
+func TestGenerateSigningKey(t *testing.T) {
+	keyPath, pubPath := newSigningKey(t)
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("秘密鍵が存在しません: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("秘密鍵のパーミッション = %o, want 600", perm)
+	}
+	if _, err := LoadSigningKey(keyPath); err != nil {
+		t.Errorf("LoadSigningKeyに失敗しました: %v", err)
+	}
+	if _, err := LoadVerifyKey(pubPath); err != nil {
+		t.Errorf("LoadVerifyKeyに失敗しました: %v", err)
+	}
+	// 秘密鍵と公開鍵を取り違えた場合はエラー
+	if _, err := LoadVerifyKey(keyPath); err == nil {
+		t.Error("秘密鍵を公開鍵として読み込めてしまいます")
+	}
+	// 既存の鍵は上書きしない
+	if _, err := GenerateSigningKey(keyPath); err == nil {
+		t.Error("既存の鍵が上書きされました")
+	}
+}
+
+func TestStatement(t *testing.T) {
+	uploaded := time.Date(2025, 2, 20, 15, 4, 5, 123000000, time.FixedZone("JST", 9*60*60))
+	tests := []Statement{
+		{Key: "logs/2025/02/20/example.com_2025_02_20_15_04_05.log.gz", SHA256: strings.Repeat("ab", 32), ChainHead: strings.Repeat("cd", 32), Uploaded: uploaded},
+		{Key: "example.com.log", SHA256: strings.Repeat("ab", 32), Uploaded: uploaded},
+	}
+
+	for _, want := range tests {
+		text := want.String()
+		if !strings.HasPrefix(text, signatureVersion+"\n") {
+			t.Errorf("String() = %q, want prefix %q", text, signatureVersion)
+		}
+		got, err := parseStatement(text)
+		if err != nil {
+			t.Fatalf("parseStatement(%q) error = %v", text, err)
+		}
+		if got.Key != want.Key || got.SHA256 != want.SHA256 || got.ChainHead != want.ChainHead || !got.Uploaded.Equal(want.Uploaded) {
+			t.Errorf("parseStatement(%q) = %+v, want %+v", text, got, want)
+		}
+	}
+}
+
+func TestVerifySignatureFile(t *testing.T) {
+	keyPath, pubPath := newSigningKey(t)
+	priv, _ := LoadSigningKey(keyPath)
+	pub, _ := LoadVerifyKey(pubPath)
+	_, otherPubPath := newSigningKey(t)
+	otherPub, _ := LoadVerifyKey(otherPubPath)
+
+	// 圧縮してアップロードしたオブジェクトの署名
+	dir := t.TempDir()
+	content := "[2025-02-19 18:14:27] SUCCESS - Target: example.com, RTT: 1ms\n"
+	gzPath := filepath.Join(dir, "example.com_2025_02_20_15_04_05.log.gz")
+	f, _ := os.Create(gzPath)
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(content))
+	zw.Close()
+	f.Close()
+	statement, sig, err := signFile(priv, gzPath, "logs/2025/02/20/example.com_2025_02_20_15_04_05.log.gz", "", time.Now())
+	if err != nil {
+		t.Fatalf("signFileに失敗しました: %v", err)
+	}
+	sigPath := filepath.Join(dir, "example.com.sig")
+	os.WriteFile(sigPath, []byte(signatureFile(statement, sig)), 0644)
+
+	// ダウンロード後に展開したファイルも検証できる
+	path := filepath.Join(dir, "example.com_2025_02_20_15_04_05.log")
+	os.WriteFile(path, []byte(content), 0644)
+
+	tampered := filepath.Join(t.TempDir(), "example.com_2025_02_20_15_04_05.log")
+	os.WriteFile(tampered, []byte(strings.Replace(content, "SUCCESS", "ERROR", 1)), 0644)
+
+	// 同じ内容の別のオブジェクトに署名を流用する
+	other := filepath.Join(dir, "example.com_2025_02_21_15_04_05.log")
+	os.WriteFile(other, []byte(content), 0644)
+
+	// 署名する文のキーを書き換える
+	forgedSigPath := filepath.Join(dir, "forged.sig")
+	forged := strings.Replace(signatureFile(statement, sig), "2025_02_20", "2025_02_21", 1)
+	os.WriteFile(forgedSigPath, []byte(forged), 0644)
+
+	tests := []struct {
+		name    string
+		path    string
+		sigPath string
+		pub     []byte
+		wantErr error
+	}{
+		{"Compressed", gzPath, sigPath, pub, nil},
+		{"Decompressed", path, sigPath, pub, nil},
+		{"Tampered", tampered, sigPath, pub, ErrSignatureMismatch},
+		{"OtherKey", gzPath, sigPath, otherPub, ErrSignatureMismatch},
+		{"OtherObject", other, sigPath, pub, ErrSignatureTarget},
+		{"ForgedStatement", other, forgedSigPath, pub, ErrSignatureMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifySignatureFile(tt.pub, tt.path, tt.sigPath)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifySignatureFile() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.Key != "logs/2025/02/20/example.com_2025_02_20_15_04_05.log.gz" {
+				t.Errorf("VerifySignatureFile() key = %q", got.Key)
+			}
+		})
+	}
+}
+
+func TestVerifyManifestFile(t *testing.T) {
+	keyPath, pubPath := newSigningKey(t)
+	priv, _ := LoadSigningKey(keyPath)
+	pub, _ := LoadVerifyKey(pubPath)
+	_, otherPubPath := newSigningKey(t)
+	otherPub, _ := LoadVerifyKey(otherPubPath)
+
+	// 2つのオブジェクトをアップロードしたマニフェスト
+	dir := t.TempDir()
+	uploaded := time.Now()
+	var records []*uploadRecord
+	var paths []string
+	for _, name := range []string{"example.com_2025_02_20_15_04_05.log", "example.com.error_2025_02_20_15_04_05.log"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("[2025-02-19 18:14:27] "+name+"\n"), 0644)
+		key := "logs/2025/02/20/" + name
+		statement, sig, err := signFile(priv, path, key, "", uploaded)
+		if err != nil {
+			t.Fatalf("signFileに失敗しました: %v", err)
+		}
+		records = append(records, &uploadRecord{Key: key, Statement: statement, Signature: sig})
+		paths = append(paths, path)
+	}
+	body, err := signManifest(priv, records, uploaded)
+	if err != nil {
+		t.Fatalf("signManifestに失敗しました: %v", err)
+	}
+	manifestPath := filepath.Join(dir, "manifest.txt")
+	os.WriteFile(manifestPath, []byte(body), 0644)
+
+	tampered := filepath.Join(t.TempDir(), filepath.Base(paths[0]))
+	os.WriteFile(tampered, []byte("[2025-02-19 18:14:27] tampered\n"), 0644)
+	unlisted := filepath.Join(dir, "example.com_2025_02_21_15_04_05.log")
+	os.WriteFile(unlisted, []byte("[2025-02-19 18:14:27] unlisted\n"), 0644)
+
+	tests := []struct {
+		name    string
+		pub     []byte
+		paths   []string
+		wantErr error
+	}{
+		{"SignatureOnly", pub, nil, nil},
+		{"AllObjects", pub, paths, nil},
+		{"OtherKey", otherPub, paths, ErrSignatureMismatch},
+		{"Tampered", pub, []string{tampered, paths[1]}, ErrSignatureMismatch},
+		{"Deleted", pub, paths[:1], ErrManifestIncomplete},
+		{"Unlisted", pub, append([]string{unlisted}, paths...), ErrSignatureTarget},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := VerifyManifestFile(tt.pub, manifestPath, tt.paths)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyManifestFile() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (len(m.Entries) != 2 || m.Entries[0].Key != records[0].Key || !m.Uploaded.Equal(uploaded)) {
+				t.Errorf("VerifyManifestFile() = %+v", m)
+			}
+		})
+	}
+}
+
+func TestSignedUpload(t *testing.T) {
+	keyPath, pubPath := newSigningKey(t)
+	pub, _ := LoadVerifyKey(pubPath)
+
+	for _, mode := range []string{UploadModeSegment, UploadModeIncremental} {
+		t.Run(mode, func(t *testing.T) {
+			l, fake, path := newUploadingLogger(t, false,
+				fmt.Sprintf("signing_key = %q", keyPath),
+				`compression = "gzip"`,
+				fmt.Sprintf("upload_mode = %q", mode))
+			l.chains = make(map[string]string)
+
+			result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+			l.LogSuccess(0, "example.com", result)
+			if err := l.UploadNow(); err != nil {
+				t.Fatalf("UploadNowに失敗しました: %v", err)
+			}
+
+			// オブジェクトごとに署名がアップロードされ、ダウンロードしたファイルを検証できる
+			dir := t.TempDir()
+			var objects int
+			var manifests, downloaded []string
+			for _, key := range fake.keys() {
+				if strings.HasSuffix(key, signatureExt) {
+					continue
+				}
+				if strings.HasPrefix(key, "logs/manifests/") {
+					manifests = append(manifests, key)
+					continue
+				}
+				objects++
+				path := filepath.Join(dir, filepath.Base(key))
+				downloaded = append(downloaded, path)
+				fake.mu.Lock()
+				os.WriteFile(path, fake.objects[key], 0644)
+				sig, ok := fake.objects[key+signatureExt]
+				fake.mu.Unlock()
+				if !ok {
+					t.Errorf("%sの署名がアップロードされていません", key)
+					continue
+				}
+				os.WriteFile(path+signatureExt, sig, 0644)
+				statement, err := VerifySignatureFile(pub, path, path+signatureExt)
+				if err != nil {
+					t.Errorf("VerifySignatureFile(%s) error = %v", key, err)
+					continue
+				}
+				// 署名にはキーとチェーンの先頭も含まれる
+				head, _ := fileChainHead(path)
+				if statement.Key != key || statement.ChainHead != head || head == ChainGenesis {
+					t.Errorf("VerifySignatureFile(%s) = %+v, want chain-head %s", key, statement, head)
+				}
+			}
+			if objects == 0 {
+				t.Error("オブジェクトがアップロードされていません")
+			}
+
+			// アップロードしたオブジェクトの一覧が署名したマニフェストとしてアップロードされる
+			if len(manifests) != 1 {
+				t.Fatalf("マニフェスト = %v, want 1件", manifests)
+			}
+			manifestPath := filepath.Join(t.TempDir(), filepath.Base(manifests[0]))
+			fake.mu.Lock()
+			os.WriteFile(manifestPath, fake.objects[manifests[0]], 0644)
+			fake.mu.Unlock()
+			if m, err := VerifyManifestFile(pub, manifestPath, downloaded); err != nil || len(m.Entries) != objects {
+				t.Errorf("VerifyManifestFile() = %+v, %v", m, err)
+			}
+
+			// アップロードの記録にも署名した文と署名が保存される
+			data, err := os.ReadFile(filepath.Join(filepath.Dir(path), ".pingood-spool", uploadLogName))
+			if err != nil {
+				t.Fatalf("アップロードの記録が存在しません: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if len(lines) != objects {
+				t.Errorf("アップロードの記録 = %d件, want %d", len(lines), objects)
+			}
+			for _, line := range lines {
+				var r uploadRecord
+				if err := json.Unmarshal([]byte(line), &r); err != nil {
+					t.Fatalf("アップロードの記録が不正です: %v", err)
+				}
+				sig, _ := base64.StdEncoding.DecodeString(r.Signature)
+				statement, err := parseStatement(r.Statement)
+				if !ed25519.Verify(pub, []byte(r.Statement), sig) || err != nil || statement.Key != r.Key || !statement.Uploaded.Equal(r.Uploaded) {
+					t.Errorf("アップロードの記録の署名が不正です: %+v", r)
+				}
+			}
+
+			// 署名はパートとして連結しない
+			if mode == UploadModeIncremental {
+				var buf strings.Builder
+				n, err := l.uploader.Reassemble(context.Background(), path, &buf)
+				if err != nil || n != 1 || !strings.Contains(buf.String(), "Target: example.com") {
+					t.Errorf("Reassemble() = %d, %v, %q", n, err, buf.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// スプールの再送間隔のデフォルト値
+const (
+	DefaultRetryInitial = 30 * time.Second
+	DefaultRetryMax     = time.Hour
+)
+
+// スプールディレクトリ内のファイルの名前
+const (
+	spoolManifestName = "manifest.json" // アップロード待ちのファイルの一覧
+	uploadLogName     = "uploads.jsonl" // アップロードしたオブジェクトとハッシュの記録
+)
+
+// spoolEntry はスプールに登録されたアップロード待ちのファイルです
+type spoolEntry struct {
+	Name        string    `json:"name"`                 // スプール内のファイル名
+	Source      string    `json:"source"`               // 登録元のログファイルのパス
+	Key         string    `json:"key,omitempty"`        // アップロード先のキー（パートの場合のみ）
+	Enqueued    time.Time `json:"enqueued"`             // 登録時刻
+	Attempts    int       `json:"attempts"`             // 失敗したアップロードの回数
+	NextAttempt time.Time `json:"next_attempt"`         // 次にアップロードを試みる時刻
+	LastError   string    `json:"last_error,omitempty"` // 最後に発生したエラー
+}
+
+// spool はアップロード待ちのファイルをディスク上に保持し、失敗したアップロードを指数バックオフで再送します
+// 登録したファイルはスプールにハードリンク（できない場合はコピー）するため、
+// 元のファイルがローテーションで削除されてもアップロードが完了するまで失われません
+type spool struct {
+	dir     string
+	initial time.Duration // 最初の再送までの間隔
+	max     time.Duration // 再送間隔の上限
+
+	mu      sync.Mutex
+	entries []*spoolEntry
+}
+
+// openSpool はスプールディレクトリを開き、前回までに登録されたファイルを読み込みます
+func openSpool(dir string, initial, max time.Duration) (*spool, error) {
+	if initial <= 0 {
+		initial = DefaultRetryInitial
+	}
+	if max < initial {
+		max = initial
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("スプールディレクトリの作成に失敗しました %s: %v", dir, err)
+	}
+
+	s := &spool{dir: dir, initial: initial, max: max}
+	data, err := os.ReadFile(filepath.Join(dir, spoolManifestName))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("スプールの読み込みに失敗しました: %v", err)
+	}
+
+	var entries []*spoolEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("スプールの読み込みに失敗しました: %v", err)
+	}
+	// ファイルが失われたエントリは再送できないため取り除く
+	for _, e := range entries {
+		if fileExists(filepath.Join(dir, e.Name)) {
+			s.entries = append(s.entries, e)
+		} else {
+			fmt.Fprintf(os.Stderr, "スプールのファイルが見つかりません %s\n", e.Name)
+		}
+	}
+	return s, nil
+}
+
+// Pending はアップロード待ちのファイルの数を返します
+func (s *spool) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// enqueue はファイルをスプールに登録します
+func (s *spool) enqueue(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	name := fmt.Sprintf("%d-%s", now.UnixNano(), filepath.Base(path))
+	if err := linkOrCopy(path, filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("スプールへの登録に失敗しました %s: %v", path, err)
+	}
+
+	s.entries = append(s.entries, &spoolEntry{
+		Name:        name,
+		Source:      path,
+		Enqueued:    now,
+		NextAttempt: now,
+	})
+	return s.save()
+}
+
+// enqueuePart はファイルの追記部分をパートとしてスプールに登録します
+// パートは元のファイルとは別に保存され、keyのオブジェクトとしてアップロードされます
+func (s *spool) enqueuePart(r io.Reader, source, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	name := fmt.Sprintf("%d-%s", now.UnixNano(), filepath.Base(source))
+	if err := writeFileSync(filepath.Join(s.dir, name), r); err != nil {
+		return fmt.Errorf("スプールへの登録に失敗しました %s: %v", source, err)
+	}
+
+	s.entries = append(s.entries, &spoolEntry{
+		Name:        name,
+		Source:      source,
+		Key:         key,
+		Enqueued:    now,
+		NextAttempt: now,
+	})
+	return s.save()
+}
+
+// due は指定した時刻までにアップロードを試みるべきエントリを登録順に返します
+// allがtrueの場合は再送間隔に関係なくすべてのエントリを返します
+func (s *spool) due(now time.Time, all bool) []spoolEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []spoolEntry
+	for _, e := range s.entries {
+		if all || !e.NextAttempt.After(now) {
+			due = append(due, *e)
+		}
+	}
+	return due
+}
+
+// nextAttempt は最も早く再送するエントリの時刻を返します（エントリがない場合はfalse）
+func (s *spool) nextAttempt() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, e := range s.entries {
+		if next.IsZero() || e.NextAttempt.Before(next) {
+			next = e.NextAttempt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// path はスプール内のファイルのパスを返します
+func (s *spool) path(e spoolEntry) string {
+	return filepath.Join(s.dir, e.Name)
+}
+
+// done はアップロードが完了したエントリをスプールから取り除きます
+func (s *spool) done(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, e := range s.entries {
+		if e.Name == name {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.save()
+}
+
+// record はアップロードしたオブジェクトのハッシュをアップロードの記録に追記します
+func (s *spool) record(r *uploadRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, uploadLogName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("アップロードの記録に失敗しました: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("アップロードの記録に失敗しました: %v", err)
+	}
+	return f.Sync()
+}
+
+// failed はアップロードに失敗したエントリの再送時刻を指数バックオフで設定します
+func (s *spool) failed(name string, err error, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.Name == name {
+			e.Attempts++
+			e.LastError = err.Error()
+			e.NextAttempt = now.Add(backoff(s.initial, s.max, e.Attempts, rand.Float64()))
+			break
+		}
+	}
+	return s.save()
+}
+
+// backoff は失敗した回数に応じた再送までの間隔を返します
+// 間隔はinitialから失敗するごとに倍になりmaxで頭打ちとし、同時に再送が集中しないよう
+// 後半の半分をjitter（0以上1未満）でばらつかせます
+func backoff(initial, max time.Duration, attempts int, jitter float64) time.Duration {
+	d := initial
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(jitter*float64(d/2))
+}
+
+// save はスプールの内容を一時ファイルに書き込んでから置き換えます
+// 呼び出し側でs.muをロックしておく必要があります
+func (s *spool) save() error {
+	sort.SliceStable(s.entries, func(i, j int) bool {
+		return s.entries[i].Enqueued.Before(s.entries[j].Enqueued)
+	})
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, spoolManifestName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("スプールの保存に失敗しました: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("スプールの保存に失敗しました: %v", err)
+	}
+	return nil
+}
+
+// linkOrCopy はファイルをハードリンクし、別のファイルシステムなどでリンクできない場合はコピーします
+// コピーした場合も元のファイルの更新時刻を引き継ぎます
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileSync(dst, in); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// writeFileSync はrの内容を新しいファイルに書き込み、ディスクに反映してから閉じます
+func writeFileSync(path string, r io.Reader) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		jitter   float64
+		want     time.Duration
+	}{
+		{"First retry without jitter", 1, 0, 15 * time.Second},
+		{"First retry with full jitter", 1, 0.999999, 30 * time.Second},
+		{"Doubles each attempt", 3, 0, time.Minute},
+		{"Capped at max", 10, 0, 5 * time.Minute},
+		{"Capped at max with jitter", 100, 0.5, 7*time.Minute + 30*time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := backoff(30*time.Second, 10*time.Minute, tt.attempts, tt.jitter)
+			if got.Round(time.Second) != tt.want {
+				t.Errorf("backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpoolSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "example.com.2025-02-20.log")
+	if err := os.WriteFile(src, []byte("line\n"), 0644); err != nil {
+		t.Fatalf("ファイルの作成に失敗しました: %v", err)
+	}
+
+	s, err := openSpool(filepath.Join(dir, "spool"), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("openSpoolに失敗しました: %v", err)
+	}
+	if err := s.enqueue(src); err != nil {
+		t.Fatalf("enqueueに失敗しました: %v", err)
+	}
+	// 元のファイルが削除されてもスプールの内容は失われない
+	os.Remove(src)
+
+	now := time.Now()
+	entry := s.due(now, false)[0]
+	if err := s.failed(entry.Name, errors.New("connection refused"), now); err != nil {
+		t.Fatalf("failedに失敗しました: %v", err)
+	}
+	if due := s.due(now, false); len(due) != 0 {
+		t.Errorf("失敗直後に再送の対象になっています: %v", due)
+	}
+
+	s, err = openSpool(filepath.Join(dir, "spool"), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("openSpoolに失敗しました: %v", err)
+	}
+	if got := s.Pending(); got != 1 {
+		t.Fatalf("Pending() = %d, want 1", got)
+	}
+	due := s.due(now.Add(time.Hour), false)
+	if len(due) != 1 || due[0].Attempts != 1 || due[0].Source != src || due[0].LastError != "connection refused" {
+		t.Fatalf("再読み込みしたエントリが不正です: %+v", due)
+	}
+	content, err := os.ReadFile(s.path(due[0]))
+	if err != nil || string(content) != "line\n" {
+		t.Errorf("スプールのファイルの内容が不正です: %q, %v", content, err)
+	}
+
+	if err := s.done(due[0].Name); err != nil {
+		t.Fatalf("doneに失敗しました: %v", err)
+	}
+	if got := s.Pending(); got != 0 {
+		t.Errorf("Pending() = %d, want 0", got)
+	}
+	if fileExists(s.path(due[0])) {
+		t.Errorf("アップロード済みのファイルがスプールに残っています")
+	}
+}
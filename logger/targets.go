@@ -0,0 +1,189 @@
+package logger
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"pingood/hook"
+	"pingood/path"
+)
+
+// エラーログの書き出し方法
+const (
+	ErrorLogModeSame  = "same"  // ログファイルのみに書き出す
+	ErrorLogModeBoth  = "both"  // ログファイルとエラーログファイルの両方に書き出す（デフォルト）
+	ErrorLogModeError = "error" // エラーログファイルのみに書き出す
+)
+
+// proberSchemes はproberに指定できる検査方式です
+var proberSchemes = []string{"icmp", "tcp", "http", "https", "tls", "dns"}
+
+// TargetConfig は設定ファイルの[[targets]]で定義する監視対象です
+type TargetConfig struct {
+	Name         string            `toml:"name"`           // ログに記録する名前（省略した場合はaddress）
+	Address      string            `toml:"address"`        // 検査するアドレス（-targetと同じ形式）
+	Prober       string            `toml:"prober"`         // 検査方式（省略した場合はaddressのスキームから判定）
+	Interval     string            `toml:"interval"`       // 検査の間隔（例: "5s"、省略した場合は-interval）
+	Timeout      string            `toml:"timeout"`        // 1回の検査のタイムアウト（省略した場合は検査方式ごとのデフォルト）
+	Log          string            `toml:"log"`            // ログファイルのパス（省略した場合はnameから自動生成）
+	Labels       map[string]string `toml:"labels"`         // JSON Lines形式のログに記録するラベル
+	ErrorLogMode string            `toml:"error_log_mode"` // エラーログの書き出し方法（省略した場合は全体の設定）
+	DownAfter    int               `toml:"down_after"`     // DOWNとする連続失敗回数（省略した場合は[state]の設定）
+	UpAfter      int               `toml:"up_after"`       // UPとする連続成功回数（省略した場合は[state]の設定）
+	OnDown       string            `toml:"on_down"`        // DOWNになったときに実行するコマンド（省略した場合は[hooks]の設定）
+	OnUp         string            `toml:"on_up"`          // DOWNから回復したときに実行するコマンド（省略した場合は[hooks]の設定）
+	DNSServer    string            `toml:"dns_server"`     // DNSの検査で問い合わせるネームサーバー（host[:port]、addressのURLで指定した値が優先）
+	RecordType   string            `toml:"record_type"`    // DNSの検査で問い合わせるレコードの種類（A, AAAA, CNAME, MX, TXT）
+	Expect       []string          `toml:"expect"`         // DNSの応答に含まれるべき値
+}
+
+// StateConfig は状態（UP、DOWN、DEGRADED）を判定する連続回数の設定です
+type StateConfig struct {
+	DownAfter int `toml:"down_after"` // DOWNとする連続失敗回数（0の場合はデフォルトの3回）
+	UpAfter   int `toml:"up_after"`   // UPとする連続成功回数（0の場合はデフォルトの2回）
+}
+
+// validate は連続回数の設定を検証します
+func (c StateConfig) validate() error {
+	if c.DownAfter < 0 || c.UpAfter < 0 {
+		return fmt.Errorf("down_afterとup_afterには0以上の値を指定してください: %d, %d", c.DownAfter, c.UpAfter)
+	}
+	return nil
+}
+
+// DisplayName はログに記録するターゲットの名前を返します
+func (t TargetConfig) DisplayName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Address
+}
+
+// ProbeTarget はproberのスキームを付けた検査対象を返します（ping.NewProberに渡す形式）
+func (t TargetConfig) ProbeTarget() (string, error) {
+	if t.Prober == "" {
+		return t.Address, nil
+	}
+	if scheme, _, found := strings.Cut(t.Address, "://"); found {
+		if !strings.EqualFold(scheme, t.Prober) {
+			return "", fmt.Errorf("ターゲット%sのproberとaddressのスキームが一致しません: %s, %s", t.DisplayName(), t.Prober, scheme)
+		}
+		return t.Address, nil
+	}
+	if t.Prober == "icmp" {
+		return t.Address, nil
+	}
+	return t.Prober + "://" + t.Address, nil
+}
+
+// isDNS はDNSの検査を行うターゲットかどうかを返します
+func (t TargetConfig) isDNS() bool {
+	target, err := t.ProbeTarget()
+	return err == nil && strings.HasPrefix(strings.ToLower(target), "dns://")
+}
+
+// LogPath はターゲットのログファイルのパスを返します
+func (t TargetConfig) LogPath() string {
+	if t.Log != "" {
+		return t.Log
+	}
+	return path.SanitizeTargetForFilename(t.DisplayName())
+}
+
+// IntervalOr は検査の間隔を返します（未設定の場合はdef）
+func (t TargetConfig) IntervalOr(def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(t.Interval); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// StateOr はターゲットの状態を判定する連続回数を返します（未設定の回数はdefの値）
+func (t TargetConfig) StateOr(def StateConfig) StateConfig {
+	if t.DownAfter > 0 {
+		def.DownAfter = t.DownAfter
+	}
+	if t.UpAfter > 0 {
+		def.UpAfter = t.UpAfter
+	}
+	return def
+}
+
+// HooksOr はターゲットの状態の遷移で実行するコマンドを返します（未設定のコマンドはdefのコマンド）
+func (t TargetConfig) HooksOr(def hook.Config) hook.Config {
+	if t.OnDown != "" {
+		def.OnDown = t.OnDown
+	}
+	if t.OnUp != "" {
+		def.OnUp = t.OnUp
+	}
+	return def
+}
+
+// TimeoutDuration は1回の検査のタイムアウトを返します（未設定の場合は0）
+func (t TargetConfig) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(t.Timeout)
+	return d
+}
+
+// validateErrorLogMode はエラーログの書き出し方法を検証します
+func validateErrorLogMode(mode string) error {
+	switch mode {
+	case "", ErrorLogModeSame, ErrorLogModeBoth, ErrorLogModeError:
+		return nil
+	}
+	return fmt.Errorf("不正なエラーログの書き出し方法です（same、bothまたはerrorを指定してください）: %s", mode)
+}
+
+// validateTargets は[[targets]]の設定を検証します
+func validateTargets(targets []TargetConfig) error {
+	names := make(map[string]bool)
+	logs := make(map[string]string)
+	for i, t := range targets {
+		if t.Address == "" {
+			return fmt.Errorf("%d番目のターゲットのaddressを指定してください", i+1)
+		}
+		name := t.DisplayName()
+		if names[name] {
+			return fmt.Errorf("ターゲットの名前が重複しています: %s", name)
+		}
+		names[name] = true
+
+		if t.Prober != "" && !slices.Contains(proberSchemes, t.Prober) {
+			return fmt.Errorf("ターゲット%sのproberが不正です（%sのいずれかを指定してください）: %s", name, strings.Join(proberSchemes, "、"), t.Prober)
+		}
+		if _, err := t.ProbeTarget(); err != nil {
+			return err
+		}
+		for _, d := range []struct{ name, value string }{
+			{"interval", t.Interval},
+			{"timeout", t.Timeout},
+		} {
+			if d.value == "" {
+				continue
+			}
+			if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+				return fmt.Errorf("ターゲット%sの%sの形式が不正です（例: 5s、1m）: %s", name, d.name, d.value)
+			}
+		}
+		if err := validateErrorLogMode(t.ErrorLogMode); err != nil {
+			return fmt.Errorf("ターゲット%s: %v", name, err)
+		}
+		if (t.DNSServer != "" || t.RecordType != "" || len(t.Expect) > 0) && !t.isDNS() {
+			return fmt.Errorf("ターゲット%sのdns_server、record_type、expectはDNSの検査（dns://）でのみ指定できます", name)
+		}
+		if err := (StateConfig{t.DownAfter, t.UpAfter}).validate(); err != nil {
+			return fmt.Errorf("ターゲット%s: %v", name, err)
+		}
+
+		// 同じファイルに複数のターゲットを書き込むとローテーションやアップロードが重複する
+		logPath := t.LogPath()
+		if other, ok := logs[logPath]; ok {
+			return fmt.Errorf("ターゲット%sと%sのログファイルが重複しています: %s", other, name, logPath)
+		}
+		logs[logPath] = name
+	}
+	return nil
+}
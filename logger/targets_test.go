@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  TargetConfig
+		want    string
+		wantErr bool
+	}{
+		{"NoProber", TargetConfig{Address: "example.com"}, "example.com", false},
+		{"ICMP", TargetConfig{Address: "example.com", Prober: "icmp"}, "example.com", false},
+		{"TCP", TargetConfig{Address: "example.com:443", Prober: "tcp"}, "tcp://example.com:443", false},
+		{"SchemeMatches", TargetConfig{Address: "https://example.com/health", Prober: "https"}, "https://example.com/health", false},
+		{"SchemeMismatch", TargetConfig{Address: "http://example.com", Prober: "tcp"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.target.ProbeTarget()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProbeTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ProbeTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []TargetConfig
+		wantErr bool
+	}{
+		{"Valid", []TargetConfig{
+			{Name: "web", Address: "https://example.com", Interval: "30s", Timeout: "5s", ErrorLogMode: "error", DownAfter: 5},
+			{Address: "example.com:443", Prober: "tls"},
+		}, false},
+		{"MissingAddress", []TargetConfig{{Name: "web"}}, true},
+		{"DuplicateName", []TargetConfig{{Name: "web", Address: "a"}, {Name: "web", Address: "b"}}, true},
+		{"DuplicateLog", []TargetConfig{{Address: "a", Log: "x.log"}, {Address: "b", Log: "x.log"}}, true},
+		{"UnknownProber", []TargetConfig{{Address: "a", Prober: "udp"}}, true},
+		{"InvalidInterval", []TargetConfig{{Address: "a", Interval: "5"}}, true},
+		{"NegativeTimeout", []TargetConfig{{Address: "a", Timeout: "-1s"}}, true},
+		{"InvalidErrorLogMode", []TargetConfig{{Address: "a", ErrorLogMode: "none"}}, true},
+		{"NegativeDownAfter", []TargetConfig{{Address: "a", DownAfter: -1}}, true},
+		{"DNSFields", []TargetConfig{{Address: "dns://example.com", DNSServer: "1.1.1.1", RecordType: "MX", Expect: []string{"mx.example.com"}}}, false},
+		{"DNSFieldsWithProber", []TargetConfig{{Address: "example.com", Prober: "dns", DNSServer: "1.1.1.1"}}, false},
+		{"DNSFieldsNotDNS", []TargetConfig{{Address: "https://example.com", RecordType: "MX"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTargets(tt.targets); (err != nil) != tt.wantErr {
+				t.Errorf("validateTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTargets(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "site.toml")
+	os.WriteFile(configPath, []byte(`
+[[targets]]
+name = "web"
+address = "https://example.com/health"
+interval = "30s"
+timeout = "3s"
+log = "logs/web.log"
+labels = { site = "tokyo" }
+error_log_mode = "same"
+on_down = "tcpdump -c 100 host example.com"
+
+[[targets]]
+address = "example.com"
+
+[hooks]
+on_down = "traceroute $PINGOOD_ADDRESS"
+on_up = "echo up"
+timeout = "1m"
+`), 0644)
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigに失敗しました: %v", err)
+	}
+	if len(config.Targets) != 2 {
+		t.Fatalf("ターゲット = %d件, want 2", len(config.Targets))
+	}
+	web, host := config.Targets[0], config.Targets[1]
+	if web.IntervalOr(time.Second) != 30*time.Second || web.TimeoutDuration() != 3*time.Second {
+		t.Errorf("interval, timeout = %v, %v", web.IntervalOr(time.Second), web.TimeoutDuration())
+	}
+	if web.LogPath() != "logs/web.log" || web.Labels["site"] != "tokyo" || web.ErrorLogMode != ErrorLogModeSame {
+		t.Errorf("ターゲットの設定が不正です: %+v", web)
+	}
+	if host.DisplayName() != "example.com" || host.LogPath() != "example.com.log" || host.IntervalOr(5*time.Second) != 5*time.Second {
+		t.Errorf("省略した設定のデフォルト値が不正です: %+v", host)
+	}
+	// ターゲットのon_downは[hooks]のコマンドを上書きし、on_upとtimeoutは[hooks]の設定を使用する
+	if h := web.HooksOr(config.Hooks); h.OnDown != web.OnDown || h.OnUp != "echo up" || h.TimeoutDuration() != time.Minute {
+		t.Errorf("フックの設定が不正です: %+v", h)
+	}
+	if h := host.HooksOr(config.Hooks); h.OnDown != config.Hooks.OnDown {
+		t.Errorf("フックの設定が不正です: %+v", h)
+	}
+}
+
+func TestFileOptions(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "web.log"), filepath.Join(dir, "db.log")}
+	configPath := filepath.Join(dir, "config.toml")
+	os.WriteFile(configPath, []byte(`log_format = "jsonl"`+"\n"), 0644)
+
+	l, err := NewLogger(paths, &LoggerOptions{
+		ConfigPath: configPath,
+		Files: []FileOptions{
+			{ErrorLogMode: ErrorLogModeError, Labels: map[string]string{"site": "tokyo"}},
+			{},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLoggerに失敗しました: %v", err)
+	}
+	for i := range paths {
+		if err := l.LogError(i, "example.com", fmt.Errorf("request timed out")); err != nil {
+			t.Fatalf("LogErrorに失敗しました: %v", err)
+		}
+	}
+	l.Close()
+
+	read := func(path string) string {
+		content, _ := os.ReadFile(path)
+		return string(content)
+	}
+	// ターゲットごとの書き出し方法はエラーログファイルのみ、設定がない場合はboth
+	if read(paths[0]) != "" || read(getErrorLogFilePath(paths[0])) == "" {
+		t.Errorf("error_log_mode = errorのログが不正です: %q, %q", read(paths[0]), read(getErrorLogFilePath(paths[0])))
+	}
+	if read(paths[1]) == "" || read(getErrorLogFilePath(paths[1])) == "" {
+		t.Errorf("error_log_modeを省略したログが不正です: %q, %q", read(paths[1]), read(getErrorLogFilePath(paths[1])))
+	}
+
+	var record struct {
+		Labels map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(read(getErrorLogFilePath(paths[0])))), &record); err != nil {
+		t.Fatalf("JSONとして解析できません: %v", err)
+	}
+	if record.Labels["site"] != "tokyo" {
+		t.Errorf("labels = %v, want site=tokyo", record.Labels)
+	}
+	if strings.Contains(read(paths[1]), "labels") {
+		t.Errorf("ラベルのないターゲットにlabelsが記録されています: %q", read(paths[1]))
+	}
+}
@@ -0,0 +1,407 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+// newUploadingLogger はテスト用のS3互換サーバーにアップロードするLoggerを生成します
+func newUploadingLogger(t *testing.T, deleteAfter bool, extra ...string) (*Logger, *fakeS3, string) {
+	t.Helper()
+	fake, s3cfg := newFakeS3(t)
+	s3cfg.DeleteAfter = deleteAfter
+	s3cfg.Schedule = "0 0 1 1 *"
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.com.log")
+	configPath := filepath.Join(dir, "config.toml")
+	config := fmt.Sprintf(`log_files = [%q]
+
+[s3]
+region = %q
+bucket = %q
+key_prefix = %q
+access_key = "test"
+secret_key = "test"
+endpoint = %q
+force_path_style = true
+tls = false
+schedule = %q
+delete_after = %v
+%s
+`, path, s3cfg.Region, s3cfg.Bucket, s3cfg.KeyPrefix, s3cfg.Endpoint, s3cfg.Schedule, deleteAfter, strings.Join(extra, "\n"))
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("設定ファイルの作成に失敗しました: %v", err)
+	}
+
+	l, err := NewLogger([]string{path}, &LoggerOptions{ConfigPath: configPath, Upload: true})
+	if err != nil {
+		t.Fatalf("NewLoggerに失敗しました: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, fake, path
+}
+
+func TestUploadNowDoesNotLoseLines(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, true)
+
+	// 書き込みとアップロードを並行して行う
+	const lines = 200
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < lines; i++ {
+			result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+			if err := l.LogSuccess(0, fmt.Sprintf("target-%d", i), result); err != nil {
+				t.Errorf("LogSuccessに失敗しました: %v", err)
+			}
+			if i%20 == 0 {
+				l.LogError(0, fmt.Sprintf("target-%d", i), fmt.Errorf("request timed out"))
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		if err := l.UploadNow(); err != nil {
+			t.Errorf("UploadNowに失敗しました: %v", err)
+		}
+	}
+	wg.Wait()
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+
+	// すべての行がちょうど1回ずつアップロードされている
+	uploaded := strings.Join(fake.contents(), "")
+	for i := 0; i < lines; i++ {
+		line := fmt.Sprintf("SUCCESS - Target: target-%d,", i)
+		if n := strings.Count(uploaded, line); n != 1 {
+			t.Errorf("%qのアップロード回数 = %d, want 1", line, n)
+		}
+	}
+	if n := strings.Count(uploaded, "ERROR - Target:"); n != 2*lines/20 {
+		t.Errorf("エラー行のアップロード回数 = %d, want %d", n, 2*lines/20)
+	}
+
+	// アップロードしたファイルは削除され、書き込み中のファイルは空になっている
+	if segments := l.pendingSegments(path); len(segments) != 0 {
+		t.Errorf("アップロード後に残っているファイル = %v", segments)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("書き込み中のファイルが空ではありません: %v", err)
+	}
+}
+
+func TestUploadNowSkipsUploadedSegments(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, false)
+
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+	l.LogSuccess(0, "example.com", result)
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+	// 書き込みがない場合は何もアップロードしない
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+	if got := len(fake.contents()); got != 1 {
+		t.Errorf("アップロードされたオブジェクト = %d件, want 1", got)
+	}
+
+	// 再起動後もスプールに登録済みのファイルは再送しない
+	m, err := loadUploadManifest(path)
+	if err != nil {
+		t.Fatalf("loadUploadManifestに失敗しました: %v", err)
+	}
+	segments, _ := listSegments(path, "")
+	if len(segments) != 1 || !m.queued(segments[0]) {
+		t.Errorf("アップロード記録にファイルが含まれていません: %v", segments)
+	}
+}
+
+func TestUploadNowPrunesSegmentsWithoutRotation(t *testing.T) {
+	// ローテーションを設定していなくても、アップロード時に切り替えたファイルにmax_filesを適用する
+	l, _, path := newUploadingLogger(t, false, "[rotation]", "max_files = 2")
+
+	var uploaded []string
+	for range 4 {
+		result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+		l.LogSuccess(0, "example.com", result)
+		if err := l.UploadNow(); err != nil {
+			t.Fatalf("UploadNowに失敗しました: %v", err)
+		}
+		segments, _ := listSegments(path, "")
+		uploaded = append(uploaded, segments[len(segments)-1])
+	}
+	if got := l.UploadStats().Succeeded; got != 4 {
+		t.Errorf("アップロードしたファイル = %d件, want 4", got)
+	}
+	segments, _ := listSegments(path, "")
+	if !slices.Equal(segments, uploaded[2:]) {
+		t.Errorf("残っているファイル = %v, want %v", segments, uploaded[2:])
+	}
+}
+
+func TestUploadNowKeepsSegmentOnFailure(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, true)
+
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+	l.LogSuccess(0, "example.com", result)
+
+	fake.failPut = true
+	if err := l.UploadNow(); err == nil {
+		t.Fatal("アップロードの失敗がエラーになりません")
+	}
+	if got := l.Pending(); got != 1 {
+		t.Fatalf("Pending() = %d, want 1", got)
+	}
+	// アップロードが完了するまで元のファイルは削除しない
+	if segments, _ := listSegments(path, ""); len(segments) != 1 {
+		t.Fatalf("アップロードに失敗したファイルが残っていません: %v", segments)
+	}
+
+	// 再起動後もスプールに残り、再送される
+	l.Close()
+	fake.failPut = false
+	l, err := NewLogger([]string{path}, &LoggerOptions{ConfigPath: filepath.Join(filepath.Dir(path), "config.toml"), Upload: true})
+	if err != nil {
+		t.Fatalf("NewLoggerに失敗しました: %v", err)
+	}
+	defer l.Close()
+	if got := l.Pending(); got != 1 {
+		t.Fatalf("再起動後のPending() = %d, want 1", got)
+	}
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+	if got := l.Pending(); got != 0 {
+		t.Errorf("再送後のPending() = %d, want 0", got)
+	}
+	if segments, _ := listSegments(path, ""); len(segments) != 0 {
+		t.Errorf("再送後に残っているファイル = %v", segments)
+	}
+	if got := fake.contents(); len(got) != 1 || !strings.Contains(got[0], "Target: example.com") {
+		t.Errorf("アップロードされた内容が不正です: %q", got)
+	}
+}
+
+func TestUploadStats(t *testing.T) {
+	l, fake, _ := newUploadingLogger(t, true)
+	l.LogSuccess(0, "example.com", &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()})
+
+	fake.failPut = true
+	l.UploadNow()
+	if got := l.UploadStats(); got.Succeeded != 0 || got.Failed == 0 {
+		t.Errorf("失敗後のUploadStats() = %+v", got)
+	}
+
+	// 再送に成功した場合は成功の回数に加える
+	fake.failPut = false
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+	if got := l.UploadStats(); got.Succeeded != uint64(len(fake.keys())) || got.Failed == 0 {
+		t.Errorf("再送後のUploadStats() = %+v, アップロードしたオブジェクト = %v", got, fake.keys())
+	}
+}
+
+func TestUploadRequestTimeout(t *testing.T) {
+	l, fake, _ := newUploadingLogger(t, false, `request_timeout = "200ms"`)
+	fake.stall = make(chan struct{})
+	t.Cleanup(func() { close(fake.stall) })
+	l.LogSuccess(0, "example.com", &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()})
+
+	// 応答しないエンドポイントへのリクエストはタイムアウトで打ち切り、スプールに残す
+	start := time.Now()
+	if err := l.UploadNow(); err == nil {
+		t.Error("UploadNow() error = nil, want timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("UploadNowに%vかかりました", elapsed)
+	}
+	if l.Pending() == 0 {
+		t.Error("タイムアウトしたファイルがスプールに残っていません")
+	}
+}
+
+func TestStopScheduleAbortsUpload(t *testing.T) {
+	l, fake, _ := newUploadingLogger(t, false, `request_timeout = "1m"`)
+	stall := make(chan struct{})
+	fake.stall = stall
+	l.LogSuccess(0, "example.com", &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()})
+
+	done := make(chan error, 1)
+	go func() { done <- l.UploadNow() }()
+	time.Sleep(100 * time.Millisecond)
+
+	// 停止すると実行中のアップロードを中断する
+	l.StopSchedule()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("UploadNow() error = nil, want aborted")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("StopScheduleで実行中のアップロードが中断されませんでした")
+	}
+
+	// 停止後の最終アップロードは新しいリクエストで行う
+	close(stall)
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("最終アップロードに失敗しました: %v", err)
+	}
+	if n := l.Pending(); n != 0 {
+		t.Errorf("Pending() = %d, want 0", n)
+	}
+}
+
+func TestIncrementalUpload(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, true, `upload_mode = "incremental"`)
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 5; i++ {
+			l.LogSuccess(0, fmt.Sprintf("target-%d-%d", round, i), result)
+		}
+		if err := l.UploadNow(); err != nil {
+			t.Fatalf("UploadNowに失敗しました: %v", err)
+		}
+	}
+	// 追記がない場合はパートを作らない
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+
+	// パートのキーにはログファイルのディレクトリ名を含める
+	prefix := "logs/" + filepath.Base(filepath.Dir(path)) + "/example.com/example.com.part-"
+	wantKeys := []string{
+		prefix + "000001.log",
+		prefix + "000002.log",
+		prefix + "000003.log",
+	}
+	if got := fake.keys(); strings.Join(got, ",") != strings.Join(wantKeys, ",") {
+		t.Errorf("アップロードされたキー = %v, want %v", got, wantKeys)
+	}
+
+	// 書き込み中のファイルは削除せず、パートを連結すると元のファイルと一致する
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ログファイルの読み込みに失敗しました: %v", err)
+	}
+	var got strings.Builder
+	n, err := l.uploader.Reassemble(context.Background(), path, &got)
+	if err != nil {
+		t.Fatalf("Reassembleに失敗しました: %v", err)
+	}
+	if n != 3 || got.String() != string(content) {
+		t.Errorf("Reassemble() = %d parts %q, want 3 parts %q", n, got.String(), content)
+	}
+
+	// 再起動後も続きの番号からアップロードする
+	l.Close()
+	l, err = NewLogger([]string{path}, &LoggerOptions{ConfigPath: filepath.Join(filepath.Dir(path), "config.toml"), Upload: true})
+	if err != nil {
+		t.Fatalf("NewLoggerに失敗しました: %v", err)
+	}
+	defer l.Close()
+	l.LogSuccess(0, "after-restart", result)
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+	keys := fake.keys()
+	if len(keys) != 4 || keys[3] != prefix+"000004.log" {
+		t.Errorf("再起動後のキー = %v", keys)
+	}
+}
+
+func TestIncrementalUploadWithRotation(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, false, `upload_mode = "incremental"`, `[rotation]`, `max_size = "200B"`)
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+
+	const lines = 30
+	for i := 0; i < lines; i++ {
+		l.LogSuccess(0, fmt.Sprintf("target-%d", i), result)
+		if i%7 == 0 {
+			l.UploadNow()
+		}
+	}
+	if err := l.UploadNow(); err != nil {
+		t.Fatalf("UploadNowに失敗しました: %v", err)
+	}
+
+	// ローテーションをまたいでもすべての行がちょうど1回ずつパートに含まれる
+	var got strings.Builder
+	if _, err := l.uploader.Reassemble(context.Background(), path, &got); err != nil {
+		t.Fatalf("Reassembleに失敗しました: %v", err)
+	}
+	for i := 0; i < lines; i++ {
+		line := fmt.Sprintf("Target: target-%d,", i)
+		if n := strings.Count(got.String(), line); n != 1 {
+			t.Errorf("%qの出現回数 = %d, want 1", line, n)
+		}
+	}
+	// ローテーション済みのファイルはファイルごとにはアップロードしない
+	for _, key := range fake.keys() {
+		if !strings.Contains(key, ".part-") {
+			t.Errorf("パート以外のオブジェクトがアップロードされました: %s", key)
+		}
+	}
+}
+
+func TestReassembleMissingPart(t *testing.T) {
+	l, fake, path := newUploadingLogger(t, false, `upload_mode = "incremental"`)
+	result := &ping.PingResult{RTT: time.Millisecond, Timestamp: time.Now()}
+	for i := 0; i < 2; i++ {
+		l.LogSuccess(0, "example.com", result)
+		l.UploadNow()
+	}
+
+	fake.mu.Lock()
+	delete(fake.objects, "logs/"+filepath.Base(filepath.Dir(path))+"/example.com/example.com.part-000001.log")
+	fake.mu.Unlock()
+
+	if _, err := l.uploader.Reassemble(context.Background(), path, io.Discard); err == nil || !strings.Contains(err.Error(), "パート1") {
+		t.Errorf("Reassemble() error = %v, want missing part error", err)
+	}
+}
+
+func TestPartPrefix(t *testing.T) {
+	u := &S3Uploader{config: S3Config{KeyPrefix: "logs"}}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"example.com.log", "logs/example.com/example.com.part-"},
+		{"example.com.error.log", "logs/example.com.error/example.com.error.part-"},
+		// 別のディレクトリにある同じ名前のファイルは区別する
+		{filepath.Join("a", "example.com.log"), "logs/a/example.com/example.com.part-"},
+		{filepath.Join("b", "example.com.log"), "logs/b/example.com/example.com.part-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := u.partPrefix(tt.name); got != tt.want {
+				t.Errorf("partPrefix(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUniqueBaseNames(t *testing.T) {
+	if err := checkUniqueBaseNames([]string{"a/example.com.log", "a/google.com.log"}); err != nil {
+		t.Errorf("checkUniqueBaseNames() error = %v", err)
+	}
+	if err := checkUniqueBaseNames([]string{"a/example.com.log", "b/example.com.log"}); err == nil {
+		t.Error("checkUniqueBaseNames() error = nil, want duplicate error")
+	}
+}
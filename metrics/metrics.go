@@ -0,0 +1,224 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pingood/logger"
+	"pingood/monitor"
+	"pingood/ping"
+)
+
+// rttBuckets はRTTのヒストグラムのバケットの上限（秒）です
+var rttBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// 検査の結果のラベルの値（ログの状態を小文字にしたもの）
+var probeStatuses = []string{"success", "warn", "error"}
+
+// targetStates はpingood_target_stateで出力する状態です
+var targetStates = []monitor.State{monitor.StateUnknown, monitor.StateUp, monitor.StateDown, monitor.StateDegraded}
+
+// Uploader はアップロードの回数とスプールの件数を返します（logger.Logger）
+type Uploader interface {
+	UploadStats() logger.UploadStats
+	Pending() int
+}
+
+// targetMetrics はターゲットごとの集計です
+type targetMetrics struct {
+	target      string
+	probes      map[string]uint64 // 結果ごとの検査の回数
+	buckets     []uint64          // rttBucketsごとのRTTの回数（累積ではない）
+	rttCount    uint64
+	rttSum      float64
+	state       monitor.State
+	lastSuccess time.Time // 最後に疎通を確認した時刻（SUCCESSまたはWARN）
+}
+
+// Collector は検査の結果と状態の遷移を集計し、Prometheusのテキスト形式で出力します
+type Collector struct {
+	mu       sync.Mutex
+	targets  []*targetMetrics // ジョブのインデックス順
+	uploader Uploader         // nilの場合はアップロードの値を出力しない
+}
+
+// New はジョブごとの集計を持つCollectorを作成します
+func New(jobs []monitor.Job, uploader Uploader) *Collector {
+	c := &Collector{targets: make([]*targetMetrics, len(jobs)), uploader: uploader}
+	for i, j := range jobs {
+		c.targets[i] = &targetMetrics{
+			target:  j.Target,
+			probes:  make(map[string]uint64),
+			buckets: make([]uint64, len(rttBuckets)),
+			state:   monitor.StateUnknown,
+		}
+	}
+	return c
+}
+
+// target はジョブのインデックスに対応する集計を返します
+func (c *Collector) target(index int) *targetMetrics {
+	if index < 0 || index >= len(c.targets) {
+		return nil
+	}
+	return c.targets[index]
+}
+
+// Observe は検査の結果を集計します
+func (c *Collector) Observe(r monitor.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.target(r.Job.Index)
+	if t == nil {
+		return
+	}
+
+	if r.Err != nil || r.Result == nil {
+		t.probes["error"]++
+		return
+	}
+	if r.Result.Warning != "" {
+		t.probes["warn"]++
+	} else {
+		t.probes["success"]++
+	}
+	t.lastSuccess = r.Time
+	t.observeRTT(r.Result)
+}
+
+// observeRTT はRTTをヒストグラムに加えます
+func (t *targetMetrics) observeRTT(result *ping.PingResult) {
+	v := result.RTT.Seconds()
+	for i, le := range rttBuckets {
+		if v <= le {
+			t.buckets[i]++
+			break
+		}
+	}
+	t.rttCount++
+	t.rttSum += v
+}
+
+// ObserveTransition はターゲットの現在の状態を更新します
+func (c *Collector) ObserveTransition(tr monitor.Transition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t := c.target(tr.Job.Index); t != nil {
+		t.state = tr.To
+	}
+}
+
+// Write はPrometheusのテキスト形式（version 0.0.4）でメトリクスを書き込みます
+func (c *Collector) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cw := bufio.NewWriter(w)
+	header := func(name, typ, help string) {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("pingood_probes_total", "counter", "Total number of probes by target and status.")
+	for _, t := range c.targets {
+		for _, s := range probeStatuses {
+			fmt.Fprintf(cw, "pingood_probes_total{target=%s,status=%q} %d\n", label(t.target), s, t.probes[s])
+		}
+	}
+
+	header("pingood_probe_rtt_seconds", "histogram", "Round-trip time of successful probes in seconds.")
+	for _, t := range c.targets {
+		var cumulative uint64
+		for i, le := range rttBuckets {
+			cumulative += t.buckets[i]
+			fmt.Fprintf(cw, "pingood_probe_rtt_seconds_bucket{target=%s,le=%q} %d\n", label(t.target), formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(cw, "pingood_probe_rtt_seconds_bucket{target=%s,le=\"+Inf\"} %d\n", label(t.target), t.rttCount)
+		fmt.Fprintf(cw, "pingood_probe_rtt_seconds_sum{target=%s} %s\n", label(t.target), formatFloat(t.rttSum))
+		fmt.Fprintf(cw, "pingood_probe_rtt_seconds_count{target=%s} %d\n", label(t.target), t.rttCount)
+	}
+
+	header("pingood_target_up", "gauge", "Whether the target is up (1 for UP or DEGRADED, 0 for DOWN). Absent until the state is known.")
+	for _, t := range c.targets {
+		switch t.state {
+		case monitor.StateUp, monitor.StateDegraded:
+			fmt.Fprintf(cw, "pingood_target_up{target=%s} 1\n", label(t.target))
+		case monitor.StateDown:
+			fmt.Fprintf(cw, "pingood_target_up{target=%s} 0\n", label(t.target))
+		}
+	}
+
+	header("pingood_target_state", "gauge", "Current state of the target (1 for the current state, 0 otherwise).")
+	for _, t := range c.targets {
+		for _, s := range targetStates {
+			v := 0
+			if t.state == s {
+				v = 1
+			}
+			fmt.Fprintf(cw, "pingood_target_state{target=%s,state=%q} %d\n", label(t.target), s, v)
+		}
+	}
+
+	header("pingood_last_success_timestamp_seconds", "gauge", "Unix time of the last successful probe of the target.")
+	for _, t := range c.targets {
+		if !t.lastSuccess.IsZero() {
+			fmt.Fprintf(cw, "pingood_last_success_timestamp_seconds{target=%s} %s\n", label(t.target), formatFloat(float64(t.lastSuccess.UnixNano())/1e9))
+		}
+	}
+
+	if c.uploader != nil {
+		stats := c.uploader.UploadStats()
+		header("pingood_uploads_total", "counter", "Total number of S3 uploads by result.")
+		fmt.Fprintf(cw, "pingood_uploads_total{result=\"success\"} %d\n", stats.Succeeded)
+		fmt.Fprintf(cw, "pingood_uploads_total{result=\"failure\"} %d\n", stats.Failed)
+
+		header("pingood_spool_depth", "gauge", "Number of log files waiting in the upload spool.")
+		fmt.Fprintf(cw, "pingood_spool_depth %d\n", c.uploader.Pending())
+	}
+
+	return cw.Flush()
+}
+
+// ServeHTTP はメトリクスをPrometheusのテキスト形式で返します
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Write(w)
+}
+
+// Serve はaddrで/metricsを公開するHTTPサーバーを開始します
+// 待ち受けに失敗した場合はエラーを返し、以降のエラーは標準エラー出力に表示します
+func Serve(addr string, c *Collector) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("メトリクスの待ち受けに失敗しました: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			fmt.Fprintf(os.Stderr, "メトリクスのHTTPサーバーが停止しました: %v\n", err)
+		}
+	}()
+	return srv, nil
+}
+
+// label はラベルの値を引用符で囲み、エスケープします
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+// labelEscaper はラベルの値のバックスラッシュ、引用符、改行をエスケープします
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatFloat は数値をPrometheusのテキスト形式で表します
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
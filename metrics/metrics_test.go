@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/logger"
+	"pingood/monitor"
+	"pingood/ping"
+)
+
+// fakeUploader はテスト用のアップロードの回数とスプールの件数です
+type fakeUploader struct {
+	stats   logger.UploadStats
+	pending int
+}
+
+func (f fakeUploader) UploadStats() logger.UploadStats { return f.stats }
+func (f fakeUploader) Pending() int                    { return f.pending }
+
+var testJobs = []monitor.Job{
+	{Index: 0, Target: "web"},
+	{Index: 1, Target: `db "primary"`},
+}
+
+// result はテスト用の検査の結果を返します
+func result(index int, rtt time.Duration, warning string, err error) monitor.Result {
+	r := monitor.Result{Job: testJobs[index], Err: err, Time: time.Unix(1739990067, 500000000)}
+	if err == nil {
+		r.Result = &ping.PingResult{RTT: rtt, Warning: warning}
+	}
+	return r
+}
+
+// render はメトリクスをテキスト形式で返します
+func render(t *testing.T, c *Collector) string {
+	t.Helper()
+	var b strings.Builder
+	if err := c.Write(&b); err != nil {
+		t.Fatalf("Writeに失敗しました: %v", err)
+	}
+	return b.String()
+}
+
+func TestCollectorProbes(t *testing.T) {
+	c := New(testJobs, nil)
+	c.Observe(result(0, 3*time.Millisecond, "", nil))
+	c.Observe(result(0, 40*time.Millisecond, "", nil))
+	c.Observe(result(0, 200*time.Millisecond, "certificate expires in 5 days", nil))
+	c.Observe(result(0, 0, "", fmt.Errorf("request timed out")))
+
+	out := render(t, c)
+	for _, want := range []string{
+		"# TYPE pingood_probes_total counter",
+		`pingood_probes_total{target="web",status="success"} 2`,
+		`pingood_probes_total{target="web",status="warn"} 1`,
+		`pingood_probes_total{target="web",status="error"} 1`,
+		`pingood_probes_total{target="db \"primary\"",status="success"} 0`,
+		"# TYPE pingood_probe_rtt_seconds histogram",
+		`pingood_probe_rtt_seconds_bucket{target="web",le="0.001"} 0`,
+		`pingood_probe_rtt_seconds_bucket{target="web",le="0.005"} 1`,
+		`pingood_probe_rtt_seconds_bucket{target="web",le="0.05"} 2`,
+		`pingood_probe_rtt_seconds_bucket{target="web",le="0.25"} 3`,
+		`pingood_probe_rtt_seconds_bucket{target="web",le="+Inf"} 3`,
+		`pingood_probe_rtt_seconds_count{target="web"} 3`,
+		`pingood_last_success_timestamp_seconds{target="web"} 1.7399900675e+09`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("メトリクスに%qが含まれていません:\n%s", want, out)
+		}
+	}
+	// 一度も成功していないターゲットの最終成功時刻は出力しない
+	if strings.Contains(out, `pingood_last_success_timestamp_seconds{target="db`) {
+		t.Errorf("成功していないターゲットの最終成功時刻が出力されています:\n%s", out)
+	}
+	// アップロードが無効な場合は出力しない
+	if strings.Contains(out, "pingood_uploads_total") {
+		t.Errorf("アップロードの回数が出力されています:\n%s", out)
+	}
+}
+
+func TestCollectorState(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []monitor.State // 順に遷移する状態
+		up     string          // pingood_target_upの行（空の場合は出力しない）
+	}{
+		{"Unknown", nil, ""},
+		{"Up", []monitor.State{monitor.StateUp}, `pingood_target_up{target="web"} 1`},
+		{"Down", []monitor.State{monitor.StateUp, monitor.StateDown}, `pingood_target_up{target="web"} 0`},
+		{"Degraded", []monitor.State{monitor.StateDown, monitor.StateDegraded}, `pingood_target_up{target="web"} 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(testJobs, nil)
+			state := monitor.StateUnknown
+			for _, s := range tt.states {
+				c.ObserveTransition(monitor.Transition{Job: testJobs[0], From: state, To: s})
+				state = s
+			}
+
+			out := render(t, c)
+			if tt.up == "" && strings.Contains(out, `pingood_target_up{target="web"}`) {
+				t.Errorf("状態が不明なターゲットのpingood_target_upが出力されています:\n%s", out)
+			}
+			if tt.up != "" && !strings.Contains(out, tt.up+"\n") {
+				t.Errorf("メトリクスに%qが含まれていません:\n%s", tt.up, out)
+			}
+			if want := fmt.Sprintf(`pingood_target_state{target="web",state=%q} 1`, state); !strings.Contains(out, want+"\n") {
+				t.Errorf("メトリクスに%qが含まれていません:\n%s", want, out)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	c := New(testJobs, fakeUploader{stats: logger.UploadStats{Succeeded: 12, Failed: 3}, pending: 2})
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GETに失敗しました: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	for _, want := range []string{
+		`pingood_uploads_total{result="success"} 12`,
+		`pingood_uploads_total{result="failure"} 3`,
+		"pingood_spool_depth 2",
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("メトリクスに%qが含まれていません:\n%s", want, body)
+		}
+	}
+}
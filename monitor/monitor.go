@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"pingood/ping"
+)
+
+// Job はターゲットごとの検査設定です
+type Job struct {
+	Index      int           // ロガーのファイルインデックス
+	Target     string        // ログに記録するターゲット
+	Address    string        // プローバーに渡すアドレス
+	Prober     ping.Prober   // 検査に使用するプローバー
+	Interval   time.Duration // 検査の間隔
+	Thresholds Thresholds    // 状態を判定する連続回数（0の場合はデフォルト）
+}
+
+// Result は1回の検査結果です
+type Result struct {
+	Job    Job
+	Result *ping.PingResult
+	Err    error
+	Time   time.Time // 検査が完了した時刻
+}
+
+// Monitor はターゲットごとのスケジューラーと、同時実行数を制限した検査ワーカーを管理します
+type Monitor struct {
+	jobs    []Job
+	sem     chan struct{}
+	results chan Result
+	// newTicker はジョブごとのティックのチャネルと停止する関数を返します（テストで置き換える）
+	newTicker func(job Job) (<-chan time.Time, func())
+}
+
+// New は新しいMonitorを作成します
+// workersが0以下の場合はターゲットの数を同時実行数の上限とします
+func New(jobs []Job, workers int) *Monitor {
+	if workers <= 0 {
+		workers = len(jobs)
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Monitor{
+		jobs:    jobs,
+		sem:     make(chan struct{}, workers),
+		results: make(chan Result, len(jobs)),
+		newTicker: func(job Job) (<-chan time.Time, func()) {
+			ticker := time.NewTicker(job.Interval)
+			return ticker.C, ticker.Stop
+		},
+	}
+}
+
+// Results は検査結果を受け取るチャネルを返します
+// Runが終了するとチャネルは閉じられます
+func (m *Monitor) Results() <-chan Result {
+	return m.results
+}
+
+// Run はターゲットごとにスケジューラーのgoroutineを起動し、ctxがキャンセルされるまで検査を続けます
+// キャンセル後は新しい検査を開始せず、実行中の検査がすべて完了してからResultsのチャネルを閉じて戻ります
+func (m *Monitor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range m.jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			m.schedule(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+	close(m.results)
+}
+
+// schedule は独立したティッカーで1つのターゲットを定期的に検査します
+// 検査が間隔より長くかかった場合、その間のティックは破棄され、同じターゲットの検査が重なることはありません
+func (m *Monitor) schedule(ctx context.Context, job Job) {
+	tick, stop := m.newTicker(job)
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		}
+
+		// ワーカーの空きを待つ
+		select {
+		case <-ctx.Done():
+			return
+		case m.sem <- struct{}{}:
+		}
+		// ティックと停止が同時に届いた場合、selectはどちらを選ぶか決まっていないため改めて確認する
+		if ctx.Err() != nil {
+			<-m.sem
+			return
+		}
+
+		// 停止時も実行中の検査は最後まで完了させる（各プローバーのタイムアウトで打ち切られる）
+		result, err := job.Prober.Probe(context.WithoutCancel(ctx), job.Address)
+		<-m.sem
+
+		// ログにプローバーの種類を記録できるようにエラーを包む
+		var probeErr *ping.ProbeError
+		if err != nil && !errors.As(err, &probeErr) {
+			err = &ping.ProbeError{Prober: job.Prober.Name(), Err: err}
+		}
+
+		m.results <- Result{Job: job, Result: result, Err: err, Time: time.Now()}
+	}
+}
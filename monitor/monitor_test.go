@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+// fakeProber は検査の開始を通知し、releaseに送られるまで完了しない検査を模倣します
+type fakeProber struct {
+	started chan string   // 検査を開始したアドレス
+	release chan struct{} // 1つ送るごとに実行中の検査を1つ完了させる
+
+	mu       sync.Mutex
+	inFlight int
+	maxSeen  int // 同時に実行された検査の最大数
+}
+
+func newFakeProber() *fakeProber {
+	return &fakeProber{started: make(chan string, 16), release: make(chan struct{})}
+}
+
+func (p *fakeProber) Name() string { return "fake" }
+
+func (p *fakeProber) Probe(ctx context.Context, target string) (*ping.PingResult, error) {
+	p.mu.Lock()
+	p.inFlight++
+	p.maxSeen = max(p.maxSeen, p.inFlight)
+	p.mu.Unlock()
+
+	p.started <- target
+	<-p.release
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+	return &ping.PingResult{Target: target, Timestamp: time.Now()}, nil
+}
+
+// fakeTickers はMonitorのティッカーを、ジョブのインデックスごとに手動でティックを送るチャネルに置き換えます
+// チャネルはバッファーを持たないため、送信が完了した時点でスケジューラーがティックを受け取っています
+func fakeTickers(m *Monitor) map[int]chan time.Time {
+	tickers := map[int]chan time.Time{}
+	for _, job := range m.jobs {
+		tickers[job.Index] = make(chan time.Time)
+	}
+	m.newTicker = func(job Job) (<-chan time.Time, func()) {
+		return tickers[job.Index], func() {}
+	}
+	return tickers
+}
+
+// receive はチャネルから1つ受け取ります（デッドロックした場合のみ失敗させる）
+func receive[T any](t *testing.T, ch <-chan T) (T, bool) {
+	t.Helper()
+	select {
+	case v, ok := <-ch:
+		return v, ok
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting on channel")
+	}
+	var zero T
+	return zero, false
+}
+
+func TestSlowTargetDoesNotDelayOthers(t *testing.T) {
+	slow, fast := newFakeProber(), newFakeProber()
+	jobs := []Job{
+		{Index: 0, Target: "slow", Address: "slow", Prober: slow, Interval: time.Second},
+		{Index: 1, Target: "fast", Address: "fast", Prober: fast, Interval: time.Second},
+	}
+	m := New(jobs, 0)
+	tickers := fakeTickers(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	tickers[0] <- time.Now()
+	if got, _ := receive(t, slow.started); got != "slow" {
+		t.Fatalf("started = %q, want slow", got)
+	}
+
+	// 遅いターゲットの検査中も、速いターゲットは自分のティックで検査される
+	var order []string
+	for i := 0; i < 3; i++ {
+		tickers[1] <- time.Now()
+		receive(t, fast.started)
+		fast.release <- struct{}{}
+		r, _ := receive(t, m.Results())
+		order = append(order, r.Job.Target)
+	}
+	slow.release <- struct{}{}
+	r, _ := receive(t, m.Results())
+	order = append(order, r.Job.Target)
+
+	want := []string{"fast", "fast", "fast", "slow"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("results = %v, want %v", order, want)
+	}
+}
+
+func TestWorkerLimit(t *testing.T) {
+	p := newFakeProber()
+	var jobs []Job
+	for i := 0; i < 3; i++ {
+		jobs = append(jobs, Job{Index: i, Target: fmt.Sprintf("target%d", i), Prober: p, Interval: time.Second})
+	}
+	m := New(jobs, 2)
+	tickers := fakeTickers(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	for i := range jobs {
+		tickers[i] <- time.Now()
+	}
+	// 上限の2つが開始し、3つ目はワーカーの空きを待つ
+	receive(t, p.started)
+	receive(t, p.started)
+	indexes := map[int]bool{}
+	p.release <- struct{}{}
+	r, _ := receive(t, m.Results())
+	indexes[r.Job.Index] = true
+
+	receive(t, p.started)
+	p.release <- struct{}{}
+	p.release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		r, _ := receive(t, m.Results())
+		indexes[r.Job.Index] = true
+	}
+	if len(indexes) != 3 {
+		t.Errorf("results from %d jobs, want results from every job", len(indexes))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.maxSeen != 2 {
+		t.Errorf("max concurrent probes = %d, want 2", p.maxSeen)
+	}
+}
+
+func TestRunClosesResultsAfterCancel(t *testing.T) {
+	p := newFakeProber()
+	jobs := []Job{{Index: 0, Target: "a", Address: "a", Prober: p, Interval: time.Second}}
+	m := New(jobs, 1)
+	tickers := fakeTickers(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+
+	tickers[0] <- time.Now()
+	receive(t, p.started)
+	cancel()
+
+	// 停止前に開始した検査は完了させ、その結果を送ってからチャネルを閉じる
+	p.release <- struct{}{}
+	r, ok := receive(t, m.Results())
+	if !ok || r.Err != nil || r.Result.Target != "a" {
+		t.Fatalf("Results() = %+v, %v, want the in-flight result", r, ok)
+	}
+	if _, ok := receive(t, m.Results()); ok {
+		t.Error("Results() was not closed after cancel")
+	}
+	receive(t, done)
+}
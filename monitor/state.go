@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// State はターゲットの状態です
+type State string
+
+// ターゲットの状態
+const (
+	StateUnknown  State = "UNKNOWN"  // 起動直後で、まだ判定できる回数の検査を行っていない
+	StateUp       State = "UP"       // 連続して成功している
+	StateDown     State = "DOWN"     // 連続して失敗している
+	StateDegraded State = "DEGRADED" // 成功しているが、警告（WARN）が続いているか、回復の途中で警告があった
+)
+
+// 状態を判定する連続回数のデフォルト値
+const (
+	DefaultDownAfter = 3
+	DefaultUpAfter   = 2
+)
+
+// Thresholds は状態を判定する連続回数です
+type Thresholds struct {
+	DownAfter int // DOWNとする連続失敗回数（0の場合はDefaultDownAfter）
+	UpAfter   int // UPまたはDEGRADEDとする連続成功回数（0の場合はDefaultUpAfter）
+}
+
+// withDefaults は未設定の回数をデフォルト値で補ったThresholdsを返します
+func (t Thresholds) withDefaults() Thresholds {
+	if t.DownAfter <= 0 {
+		t.DownAfter = DefaultDownAfter
+	}
+	if t.UpAfter <= 0 {
+		t.UpAfter = DefaultUpAfter
+	}
+	return t
+}
+
+// Transition はターゲットの状態の遷移です
+type Transition struct {
+	Job       Job
+	From      State
+	To        State
+	Time      time.Time     // 遷移を判定した検査の時刻
+	Since     time.Time     // 遷移の原因となった連続した検査の最初の時刻（DOWNの場合は最初に失敗した時刻）
+	Outage    time.Duration // DOWNから回復した場合の停止時間（最初に失敗してから最初に成功するまで）
+	Reason    string        // 最後の検査のエラーまたは警告
+	LastError string        // 最後に失敗した検査のエラー（DOWNから回復した場合は停止の原因）
+}
+
+func (t Transition) String() string {
+	s := fmt.Sprintf("%s: %s -> %s", t.Job.Target, t.From, t.To)
+	if t.Outage > 0 {
+		s += fmt.Sprintf(" (outage: %v)", t.Outage.Round(time.Millisecond))
+	}
+	return s
+}
+
+// run は同じ種類の結果が連続した回数と、その最初の時刻です
+type run struct {
+	count int
+	start time.Time
+}
+
+// add は結果を連続に加えます
+func (r *run) add(t time.Time) {
+	if r.count == 0 {
+		r.start = t
+	}
+	r.count++
+}
+
+// targetState はターゲットごとの判定の状態です
+type targetState struct {
+	state     State
+	downSince time.Time // DOWNの場合、最初に失敗した時刻
+	lastError string    // 最後に失敗した検査のエラー（UPになると消去）
+	failures  run       // 連続した失敗
+	successes run       // 連続した成功（警告を含む）
+	oks       run       // 警告のない連続した成功
+	warnings  run       // 連続した警告
+}
+
+// Tracker はターゲットごとに検査結果を集計し、状態の遷移を判定します
+// 結果は1つのgoroutineから順番に渡す必要があります
+type Tracker struct {
+	targets map[int]*targetState
+}
+
+// NewTracker は新しいTrackerを作成します
+func NewTracker() *Tracker {
+	return &Tracker{targets: make(map[int]*targetState)}
+}
+
+// State はターゲットの現在の状態を返します
+func (t *Tracker) State(index int) State {
+	if s, ok := t.targets[index]; ok {
+		return s.state
+	}
+	return StateUnknown
+}
+
+// Observe は検査結果を集計し、状態が変わった場合は遷移を返します
+// 失敗がDownAfter回続くとDOWN、警告のない成功がUpAfter回続くとUP、警告がUpAfter回続くとDEGRADEDになります
+// DOWNまたはUNKNOWNから警告を含む成功がUpAfter回続いた場合もDEGRADEDになります
+func (t *Tracker) Observe(r Result) (Transition, bool) {
+	s, ok := t.targets[r.Job.Index]
+	if !ok {
+		s = &targetState{state: StateUnknown}
+		t.targets[r.Job.Index] = s
+	}
+	th := r.Job.Thresholds.withDefaults()
+
+	var reason string
+	switch {
+	case r.Err != nil:
+		reason = r.Err.Error()
+		s.lastError = reason
+		s.failures.add(r.Time)
+		s.successes, s.oks, s.warnings = run{}, run{}, run{}
+	case r.Result != nil && r.Result.Warning != "":
+		reason = r.Result.Warning
+		s.failures, s.oks = run{}, run{}
+		s.successes.add(r.Time)
+		s.warnings.add(r.Time)
+	default:
+		s.failures, s.warnings = run{}, run{}
+		s.successes.add(r.Time)
+		s.oks.add(r.Time)
+	}
+
+	next, since := s.state, time.Time{}
+	switch {
+	case s.failures.count >= th.DownAfter:
+		next, since = StateDown, s.failures.start
+	case s.oks.count >= th.UpAfter:
+		next, since = StateUp, s.oks.start
+	case s.warnings.count >= th.UpAfter:
+		next, since = StateDegraded, s.warnings.start
+	case s.successes.count >= th.UpAfter && (s.state == StateDown || s.state == StateUnknown):
+		next, since = StateDegraded, s.successes.start
+	}
+	if next == s.state {
+		return Transition{}, false
+	}
+
+	tr := Transition{
+		Job:       r.Job,
+		From:      s.state,
+		To:        next,
+		Time:      r.Time,
+		Since:     since,
+		Reason:    reason,
+		LastError: s.lastError,
+	}
+	if s.state == StateDown {
+		tr.Outage = s.successes.start.Sub(s.downSince)
+	}
+	if next == StateDown {
+		s.downSince = since
+	}
+	if next == StateUp {
+		s.lastError = ""
+	}
+	s.state = next
+	return tr, true
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"pingood/ping"
+)
+
+func TestTrackerTransitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds Thresholds
+		results    string // o: 成功、w: 警告、x: 失敗
+		want       []State
+	}{
+		{"InitialUp", Thresholds{}, "ooo", []State{StateUp}},
+		{"InitialDown", Thresholds{}, "xxxx", []State{StateDown}},
+		{"SingleFailureIgnored", Thresholds{}, "ooxoxxo", []State{StateUp}},
+		{"DownAndRecover", Thresholds{}, "ooxxxoo", []State{StateUp, StateDown, StateUp}},
+		{"Flapping", Thresholds{}, "ooxxxoxoxxxo", []State{StateUp, StateDown}},
+		{"Degraded", Thresholds{}, "oowwo", []State{StateUp, StateDegraded}},
+		{"DegradedRecovers", Thresholds{}, "oowwoo", []State{StateUp, StateDegraded, StateUp}},
+		{"RecoverWithWarning", Thresholds{}, "xxxowoo", []State{StateDown, StateDegraded, StateUp}},
+		{"CustomThresholds", Thresholds{DownAfter: 1, UpAfter: 1}, "oxo", []State{StateUp, StateDown, StateUp}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker()
+			job := Job{Index: 0, Target: "example.com", Thresholds: tt.thresholds}
+			start := time.Now()
+
+			var got []State
+			for i, c := range tt.results {
+				r := Result{Job: job, Time: start.Add(time.Duration(i) * time.Second)}
+				switch c {
+				case 'o':
+					r.Result = &ping.PingResult{}
+				case 'w':
+					r.Result = &ping.PingResult{Warning: "slow"}
+				case 'x':
+					r.Err = errors.New("request timed out")
+				}
+				if tr, ok := tracker.Observe(r); ok {
+					if len(got) > 0 && tr.From != got[len(got)-1] {
+						t.Errorf("遷移前の状態 = %s, want %s", tr.From, got[len(got)-1])
+					}
+					got = append(got, tr.To)
+				}
+			}
+			if !equalStates(got, tt.want) {
+				t.Errorf("遷移 = %v, want %v", got, tt.want)
+			}
+			if len(tt.want) > 0 && tracker.State(0) != tt.want[len(tt.want)-1] {
+				t.Errorf("State() = %s, want %s", tracker.State(0), tt.want[len(tt.want)-1])
+			}
+		})
+	}
+}
+
+func TestTrackerOutage(t *testing.T) {
+	tracker := NewTracker()
+	job := Job{Index: 0, Target: "example.com", Thresholds: Thresholds{DownAfter: 2, UpAfter: 2}}
+	start := time.Date(2025, 2, 19, 18, 0, 0, 0, time.UTC)
+	observe := func(sec int, err error) (Transition, bool) {
+		r := Result{Job: job, Err: err, Time: start.Add(time.Duration(sec) * time.Second)}
+		if err == nil {
+			r.Result = &ping.PingResult{}
+		}
+		return tracker.Observe(r)
+	}
+
+	timeout := errors.New("request timed out")
+	observe(0, nil)
+	observe(10, nil)
+	observe(20, timeout)
+	down, ok := observe(30, timeout)
+	if !ok || down.To != StateDown {
+		t.Fatalf("DOWNに遷移していません: %+v", down)
+	}
+	if !down.Since.Equal(start.Add(20*time.Second)) || down.Reason != timeout.Error() {
+		t.Errorf("DOWN Since = %v, Reason = %q", down.Since, down.Reason)
+	}
+
+	observe(40, timeout)
+	observe(50, nil)
+	up, ok := observe(60, nil)
+	if !ok || up.From != StateDown || up.To != StateUp {
+		t.Fatalf("UPに遷移していません: %+v", up)
+	}
+	// 最初に失敗してから最初に成功するまで
+	if up.Outage != 30*time.Second {
+		t.Errorf("Outage = %v, want 30s", up.Outage)
+	}
+	if up.Reason != "" || up.LastError != timeout.Error() {
+		t.Errorf("Reason = %q, LastError = %q, want \"\", %q", up.Reason, up.LastError, timeout.Error())
+	}
+	if !strings.Contains(up.String(), "outage: 30s") {
+		t.Errorf("String() = %q", up.String())
+	}
+}
+
+func TestTrackerSeparatesTargets(t *testing.T) {
+	tracker := NewTracker()
+	a := Job{Index: 0, Target: "a", Thresholds: Thresholds{DownAfter: 1, UpAfter: 1}}
+	b := Job{Index: 1, Target: "b", Thresholds: Thresholds{DownAfter: 1, UpAfter: 1}}
+
+	tracker.Observe(Result{Job: a, Result: &ping.PingResult{}, Time: time.Now()})
+	tracker.Observe(Result{Job: b, Err: errors.New("refused"), Time: time.Now()})
+	if tracker.State(0) != StateUp || tracker.State(1) != StateDown {
+		t.Errorf("State() = %s, %s, want UP, DOWN", tracker.State(0), tracker.State(1))
+	}
+	if tracker.State(2) != StateUnknown {
+		t.Errorf("State(2) = %s, want UNKNOWN", tracker.State(2))
+	}
+}
+
+func equalStates(a, b []State) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
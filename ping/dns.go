@@ -0,0 +1,381 @@
+package ping
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ErrUnexpectedAnswer はDNSの応答が期待する値を含まなかった場合のエラーです
+var ErrUnexpectedAnswer = errors.New("unexpected DNS answer")
+
+// DNSProber は指定したネームサーバーにレコードを問い合わせ、解決にかかった時間を計測します
+type DNSProber struct {
+	Timeout time.Duration
+	Server  string   // ネームサーバー（host:port、空の場合はシステムのリゾルバの設定の最初のネームサーバー）
+	Network string   // "udp" または "tcp"（空の場合は"udp"）
+	Type    string   // レコードの種類（A, AAAA, CNAME, MX, TXT）
+	Expect  []string // 応答に含まれるべき値（オプション）
+}
+
+// Name returns the prober type
+func (p *DNSProber) Name() string { return "dns" }
+
+// newDNSProber はdns://[server[:port]]/name?type=MX 形式のターゲットからプローバーと問い合わせる名前を生成します
+// URLで指定されなかった項目はOptionsの値を使用します
+func newDNSProber(target string, opts Options) (*DNSProber, string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid dns target %q: %v", target, err)
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		return nil, "", fmt.Errorf("invalid dns target %q: missing name", target)
+	}
+
+	p := &DNSProber{
+		Timeout: opts.timeout(),
+		Server:  opts.DNSServer,
+		Network: opts.DNSNetwork,
+		Type:    opts.RecordType,
+		Expect:  opts.ExpectAnswers,
+	}
+
+	q := u.Query()
+	if u.Host != "" {
+		p.Server = u.Host
+	}
+	if v := q.Get("type"); v != "" {
+		p.Type = v
+	}
+	if v := q.Get("network"); v != "" {
+		p.Network = v
+	}
+	if v := q.Get("expect"); v != "" {
+		p.Expect = strings.Split(v, ",")
+	}
+
+	if p.Server != "" {
+		if _, _, err := net.SplitHostPort(p.Server); err != nil {
+			p.Server = net.JoinHostPort(strings.Trim(p.Server, "[]"), "53")
+		}
+	}
+	if p.Network == "" {
+		p.Network = "udp"
+	}
+	if p.Network != "udp" && p.Network != "tcp" {
+		return nil, "", fmt.Errorf("invalid dns network %q", p.Network)
+	}
+	// システムのネームサーバーが分からない場合は、検査のたびにDNSの障害として記録せずに起動時にエラーとする
+	if p.Server == "" {
+		if _, err := systemServer(); err != nil {
+			return nil, "", err
+		}
+	}
+	if p.Type == "" {
+		p.Type = "A"
+	}
+	p.Type = strings.ToUpper(p.Type)
+	switch p.Type {
+	case "A", "AAAA", "CNAME", "MX", "TXT":
+	default:
+		return nil, "", fmt.Errorf("unsupported DNS record type %q", p.Type)
+	}
+	return p, name, nil
+}
+
+// resolvConfPath はシステムのリゾルバの設定ファイルのパスです
+var resolvConfPath = "/etc/resolv.conf"
+
+// systemServer はシステムのリゾルバの設定（resolv.conf）から最初のネームサーバーを返します
+// 設定を読み込めない場合やWindowsの場合は、ネームサーバーの指定を求めるエラーを返します
+func systemServer() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("cannot determine the system DNS server on %s: specify it as dns://server/name or with dns_server", runtime.GOOS)
+	}
+	data, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot determine the system DNS server: %v (specify it as dns://server/name or with dns_server)", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", fmt.Errorf("no nameserver in %s: specify it as dns://server/name or with dns_server", resolvConfPath)
+}
+
+// server はログに記録するネームサーバーの表記を返します
+func (p *DNSProber) server() string {
+	server := p.Server
+	if server == "" {
+		server = "system"
+	}
+	return server + "/" + p.Network
+}
+
+// Probe resolves the record and checks the answers against the expected values
+func (p *DNSProber) Probe(ctx context.Context, target string) (*PingResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	server := p.Server
+	if server == "" {
+		var err error
+		if server, err = systemServer(); err != nil {
+			return nil, probeError(p.Name(), "", err)
+		}
+	}
+	// エラーには問い合わせたネームサーバーのアドレスを記録する
+	serverIP, _, _ := net.SplitHostPort(server)
+	start := time.Now()
+	answers, err := lookup(ctx, p.Network, server, p.Type, target)
+	rtt := time.Since(start)
+	if err != nil {
+		return nil, probeError(p.Name(), serverIP, fmt.Errorf("DNS %s lookup for %s via %s failed: %w", p.Type, target, p.server(), err))
+	}
+
+	if missing := missingAnswers(answers, p.Expect); len(missing) > 0 {
+		return nil, probeError(p.Name(), serverIP, fmt.Errorf("%w: %s %s via %s returned [%s], missing [%s]",
+			ErrUnexpectedAnswer, p.Type, target, p.server(), strings.Join(answers, " "), strings.Join(missing, " ")))
+	}
+
+	result := &PingResult{
+		Target:    target,
+		Prober:    p.Name(),
+		RTT:       rtt,
+		Timestamp: start,
+		Detail:    fmt.Sprintf("Type: %s, Server: %s, Answers: [%s]", p.Type, p.server(), strings.Join(answers, " ")),
+	}
+	if (p.Type == "A" || p.Type == "AAAA") && len(answers) > 0 {
+		result.IP = answers[0]
+	}
+	return result, nil
+}
+
+// recordTypes はレコードの種類の名前とDNSメッセージの種類の対応です
+var recordTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+// lookup はネームサーバーにレコードを直接問い合わせ、応答セクションのうち問い合わせた種類のレコードを文字列で返します
+// /etc/hostsや検索ドメインは使用せず、名前はそのまま（完全修飾名として）問い合わせます
+func lookup(ctx context.Context, network, server, typ, name string) ([]string, error) {
+	qtype, ok := recordTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("unsupported DNS record type %q", typ)
+	}
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS name %q: %v", name, err)
+	}
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET})
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := exchange(ctx, network, server, id, query)
+	if err == nil && network == "udp" && resp.hdr.Truncated {
+		// UDPの応答が切り詰められた場合はTCPで問い合わせ直す
+		resp, err = exchange(ctx, "tcp", server, id, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dnsErr := func(msg string, notFound bool) error {
+		return &net.DNSError{Err: msg, Name: name, Server: server, IsNotFound: notFound}
+	}
+	switch resp.hdr.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, dnsErr("no such host", true)
+	default:
+		return nil, dnsErr("server returned "+resp.hdr.RCode.String(), false)
+	}
+
+	answers, err := parseAnswers(&resp.parser, qtype)
+	if err != nil {
+		return nil, dnsErr("malformed DNS response: "+err.Error(), false)
+	}
+	if len(answers) == 0 {
+		return nil, dnsErr("no "+typ+" records", true)
+	}
+	sort.Strings(answers)
+	return answers, nil
+}
+
+// dnsResponse は解析を開始したDNSの応答です
+type dnsResponse struct {
+	hdr    dnsmessage.Header
+	parser dnsmessage.Parser
+}
+
+// exchange は問い合わせをネームサーバーに送り、IDが一致する応答を返します
+func exchange(ctx context.Context, network, server string, id uint16, query []byte) (*dnsResponse, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	for {
+		msg, err := roundTrip(conn, network, query)
+		if err != nil {
+			return nil, err
+		}
+		resp := &dnsResponse{}
+		resp.hdr, err = resp.parser.Start(msg)
+		// UDPでは無関係なパケットや遅れて届いた応答を無視して待ち続ける
+		if err != nil || resp.hdr.ID != id || !resp.hdr.Response {
+			if network == "udp" {
+				query = nil
+				continue
+			}
+			if err == nil {
+				err = errors.New("DNS response ID mismatch")
+			}
+			return nil, err
+		}
+		if err := resp.parser.SkipAllQuestions(); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// roundTrip は問い合わせを送り（queryがnilの場合は送らない）、応答を1つ受信します
+// TCPではメッセージの前に2バイトの長さを付加します
+func roundTrip(conn net.Conn, network string, query []byte) ([]byte, error) {
+	if network == "udp" {
+		if query != nil {
+			if _, err := conn.Write(query); err != nil {
+				return nil, err
+			}
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	if query != nil {
+		msg := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		copy(msg[2:], query)
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// parseAnswers は応答セクションから問い合わせた種類のレコードを文字列にして返します
+// CNAMEを辿った応答に含まれる別の種類のレコードは無視します
+func parseAnswers(p *dnsmessage.Parser, qtype dnsmessage.Type) ([]string, error) {
+	var answers []string
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			return answers, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Type != qtype || h.Class != dnsmessage.ClassINET {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch qtype {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, net.IP(r.A[:]).String())
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, net.IP(r.AAAA[:]).String())
+		case dnsmessage.TypeCNAME:
+			r, err := p.CNAMEResource()
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, normalizeName(r.CNAME.String()))
+		case dnsmessage.TypeMX:
+			r, err := p.MXResource()
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, strconv.Itoa(int(r.Pref))+" "+normalizeName(r.MX.String()))
+		case dnsmessage.TypeTXT:
+			r, err := p.TXTResource()
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, strings.Join(r.TXT, ""))
+		}
+	}
+}
+
+// missingAnswers は期待する値のうち応答に含まれなかったものを返します
+func missingAnswers(answers, expect []string) []string {
+	got := make(map[string]bool, len(answers))
+	for _, a := range answers {
+		got[normalizeName(a)] = true
+	}
+	var missing []string
+	for _, e := range expect {
+		if e = strings.TrimSpace(e); e != "" && !got[normalizeName(e)] {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
+
+// normalizeName は比較のために名前を小文字にし、末尾のドットを除去します
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
@@ -0,0 +1,272 @@
+package ping
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// answerDNS はテスト用のゾーンから問い合わせに対する応答を生成します
+// big.testはUDPでは切り詰めた応答を返し、TCPでのみ回答します
+func answerDNS(t *testing.T, query []byte, tcp bool) []byte {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil {
+		t.Errorf("failed to parse query: %v", err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Errorf("failed to parse question: %v", err)
+		return nil
+	}
+
+	name := strings.ToLower(q.Name.String())
+	rh := dnsmessage.Header{ID: hdr.ID, Response: true, Authoritative: true}
+	switch {
+	case name == "nxdomain.test.":
+		rh.RCode = dnsmessage.RCodeNameError
+	case name == "big.test." && !tcp:
+		rh.Truncated = true
+	}
+	b := dnsmessage.NewBuilder(nil, rh)
+	b.EnableCompression()
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	if rh.Truncated {
+		name = ""
+	}
+	a := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	switch name {
+	case "alias.test.":
+		// CNAMEを辿った応答（Aの問い合わせにはCNAMEとAを返す）
+		b.CNAMEResource(a, dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("example.test.")})
+		if q.Type == dnsmessage.TypeA {
+			a.Name = dnsmessage.MustNewName("example.test.")
+			b.AResource(a, dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}})
+		}
+	case "example.test.", "big.test.":
+		switch q.Type {
+		case dnsmessage.TypeA:
+			b.AResource(a, dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}})
+		case dnsmessage.TypeMX:
+			b.MXResource(a, dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx.example.test.")})
+		case dnsmessage.TypeTXT:
+			b.TXTResource(a, dnsmessage.TXTResource{TXT: []string{"v=spf1 -all"}})
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Errorf("failed to build response: %v", err)
+	}
+	return msg
+}
+
+// startDNSServer はUDPとTCPで応答するテスト用のネームサーバーを起動します
+func startDNSServer(t *testing.T) (udpAddr, tcpAddr string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen tcp: %v", err)
+	}
+	// 切り詰めた応答からTCPに切り替えられるよう、UDPも同じポートで待ち受ける
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		t.Fatalf("failed to listen udp: %v", err)
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(answerDNS(t, buf[:n], false), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var size uint16
+					if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+						return
+					}
+					query := make([]byte, size)
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					resp := answerDNS(t, query, true)
+					binary.Write(conn, binary.BigEndian, uint16(len(resp)))
+					conn.Write(resp)
+				}
+			}()
+		}
+	}()
+	return pc.LocalAddr().String(), ln.Addr().String()
+}
+
+func TestDNSProber(t *testing.T) {
+	udpAddr, tcpAddr := startDNSServer(t)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantDetail string
+		wantIP     string
+		wantErr    bool
+	}{
+		{"A over UDP", "dns://" + udpAddr + "/example.test", "Answers: [192.0.2.10]", "192.0.2.10", false},
+		{"A over TCP", "dns://" + tcpAddr + "/example.test?network=tcp", "Answers: [192.0.2.10]", "192.0.2.10", false},
+		{"MX", "dns://" + udpAddr + "/example.test?type=MX", "Answers: [10 mx.example.test]", "", false},
+		{"TXT", "dns://" + udpAddr + "/example.test?type=txt", "Answers: [v=spf1 -all]", "", false},
+		{"Expected answer", "dns://" + udpAddr + "/example.test?expect=192.0.2.10", "Type: A", "192.0.2.10", false},
+		{"Unexpected answer", "dns://" + udpAddr + "/example.test?expect=192.0.2.99", "", "", true},
+		{"No record", "dns://" + udpAddr + "/missing.test", "", "", true},
+		{"NXDOMAIN", "dns://" + udpAddr + "/nxdomain.test", "", "", true},
+		{"A via CNAME", "dns://" + udpAddr + "/alias.test", "Answers: [192.0.2.10]", "192.0.2.10", false},
+		{"CNAME", "dns://" + udpAddr + "/alias.test?type=CNAME", "Answers: [example.test]", "", false},
+		// CNAMEがない名前はその名前自体を応答としない
+		{"No CNAME", "dns://" + udpAddr + "/example.test?type=CNAME", "", "", true},
+		// /etc/hostsは参照せず、ネームサーバーに問い合わせる
+		{"Hosts file ignored", "dns://" + udpAddr + "/localhost", "", "", true},
+		{"Truncated UDP falls back to TCP", "dns://" + udpAddr + "/big.test", "Answers: [192.0.2.10]", "192.0.2.10", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, name, err := NewProber(tt.target, Options{Timeout: 2 * time.Second})
+			if err != nil {
+				t.Fatalf("NewProber() error = %v", err)
+			}
+			result, err := p.Probe(context.Background(), name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.Contains(result.Detail, tt.wantDetail) {
+				t.Errorf("Probe() Detail = %q, want to contain %q", result.Detail, tt.wantDetail)
+			}
+			if result.IP != tt.wantIP {
+				t.Errorf("Probe() IP = %q, want %q", result.IP, tt.wantIP)
+			}
+		})
+	}
+
+	p, name, _ := NewProber("dns://"+udpAddr+"/example.test?expect=192.0.2.99", Options{Timeout: time.Second})
+	if _, err := p.Probe(context.Background(), name); !errors.Is(err, ErrUnexpectedAnswer) {
+		t.Errorf("Probe() error = %v, want ErrUnexpectedAnswer", err)
+	}
+
+	p, name, _ = NewProber("dns://"+udpAddr+"/nxdomain.test", Options{Timeout: time.Second})
+	var dnsErr *net.DNSError
+	_, err := p.Probe(context.Background(), name)
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound || ClassifyError(err) != "dns" {
+		t.Errorf("Probe() error = %v, want not found *net.DNSError", err)
+	}
+	// エラーには問い合わせたネームサーバーのアドレスを記録する
+	var probeErr *ProbeError
+	if !errors.As(err, &probeErr) || probeErr.IP != "127.0.0.1" {
+		t.Errorf("Probe() error = %#v, want ProbeError with IP 127.0.0.1", err)
+	}
+}
+
+func TestSystemServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("resolv.confを使用しません")
+	}
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string // 空の場合はファイルを作成しない
+		want    string
+		wantErr bool
+	}{
+		{"Nameserver", "# comment\nsearch example.test\nnameserver 192.0.2.53\nnameserver 192.0.2.54\n", "192.0.2.53:53", false},
+		{"IPv6", "nameserver 2001:db8::53\n", "[2001:db8::53]:53", false},
+		{"NoNameserver", "search example.test\n", "", true},
+		// 設定ファイルがない場合はローカルホストを使用せずにエラーとする
+		{"Missing", "", "", true},
+	}
+	defer func(path string) { resolvConfPath = path }(resolvConfPath)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolvConfPath = filepath.Join(dir, tt.name)
+			if tt.content != "" {
+				os.WriteFile(resolvConfPath, []byte(tt.content), 0644)
+			}
+			got, err := systemServer()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("systemServer() = %q, %v, want %q, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+			// ネームサーバーを指定しないターゲットは作成時にエラーになる
+			if _, _, err := NewProber("dns:///example.com", Options{}); (err != nil) != tt.wantErr {
+				t.Errorf("NewProber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewDNSProber(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		opts        Options
+		wantServer  string
+		wantType    string
+		wantNetwork string
+		wantErr     bool
+	}{
+		{"Default port", "dns://8.8.8.8/example.com", Options{}, "8.8.8.8:53", "A", "udp", false},
+		// Windowsではシステムのネームサーバーを使用できない
+		{"System resolver", "dns:///example.com?type=aaaa", Options{}, "", "AAAA", "udp", runtime.GOOS == "windows"},
+		{"Options as defaults", "dns:///example.com", Options{DNSServer: "1.1.1.1", DNSNetwork: "tcp", RecordType: "MX"}, "1.1.1.1:53", "MX", "tcp", false},
+		{"Unsupported type", "dns://8.8.8.8/example.com?type=SRV", Options{}, "", "", "", true},
+		{"Missing name", "dns://8.8.8.8/", Options{}, "", "", "", true},
+	}
+
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	os.WriteFile(resolvConf, []byte("search example.test\nnameserver 192.0.2.53\n"), 0644)
+	defer func(path string) { resolvConfPath = path }(resolvConfPath)
+	resolvConfPath = resolvConf
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, err := newDNSProber(tt.target, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newDNSProber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if p.Server != tt.wantServer || p.Type != tt.wantType || p.Network != tt.wantNetwork {
+				t.Errorf("newDNSProber() = %s %s %s, want %s %s %s", p.Server, p.Type, p.Network, tt.wantServer, tt.wantType, tt.wantNetwork)
+			}
+		})
+	}
+}
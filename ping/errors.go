@@ -1,11 +1,81 @@
 package ping
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
+	"os"
 	"runtime"
+	"syscall"
 )
 
 var (
 	// ErrUnsupportedOS は未サポートのOSでpingを実行しようとした場合のエラーです
 	ErrUnsupportedOS = fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+
+	// ErrTimeout はタイムアウトまでにエコー応答が得られなかった場合のエラーです
+	ErrTimeout = errors.New("request timed out")
+
+	// ErrNoAddress はホスト名からIPアドレスが得られなかった場合のエラーです
+	ErrNoAddress = errors.New("no address found for host")
+
+	// ErrNoReply はpingコマンドの出力に応答行が含まれていなかった場合のエラーです
+	ErrNoReply = errors.New("no echo reply in ping output")
+
+	// ErrNoSocket はICMPソケットを開く権限がない場合のエラーです
+	ErrNoSocket = errors.New("ICMP socket unavailable")
 )
+
+// ProbeError は失敗した検査のプローバーの種類と接続先を保持するエラーです
+type ProbeError struct {
+	Prober string
+	IP     string
+	Err    error
+}
+
+func (e *ProbeError) Error() string { return e.Err.Error() }
+
+func (e *ProbeError) Unwrap() error { return e.Err }
+
+// probeError は接続先のIPアドレスが分かった後のエラーをProbeErrorで包みます
+func probeError(prober, ip string, err error) error {
+	return &ProbeError{Prober: prober, IP: ip, Err: err}
+}
+
+// ClassifyError はエラーを集計しやすい分類名に変換します
+func ClassifyError(err error) string {
+	var (
+		httpErr      *HTTPError
+		dnsErr       *net.DNSError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrCertExpired):
+		return "cert_expired"
+	case errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return "cert_invalid"
+	case errors.As(err, &httpErr):
+		return "http_status"
+	case errors.Is(err, ErrUnexpectedAnswer):
+		return "dns_answer"
+	case errors.As(err, &dnsErr), errors.Is(err, ErrNoAddress):
+		return "dns"
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded), os.IsTimeout(err):
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "unreachable"
+	case errors.Is(err, ErrNoReply):
+		return "no_reply"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,36 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"Nil", nil, ""},
+		{"Timeout", fmt.Errorf("%w: 192.0.2.1", ErrTimeout), "timeout"},
+		{"Context deadline", context.DeadlineExceeded, "timeout"},
+		{"DNS", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, "dns"},
+		{"Connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, "refused"},
+		{"HTTP status", &HTTPError{StatusCode: 503, Reason: "unexpected status"}, "http_status"},
+		{"DNS answer", fmt.Errorf("%w: missing", ErrUnexpectedAnswer), "dns_answer"},
+		{"Certificate expired", fmt.Errorf("%w: example.com", ErrCertExpired), "cert_expired"},
+		{"Wrapped in ProbeError", &ProbeError{Prober: "icmp", Err: ErrNoReply}, "no_reply"},
+		{"Other", fmt.Errorf("something else"), "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package ping
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHTTPTimeout はHTTPリクエストのデフォルトのタイムアウトです
+	DefaultHTTPTimeout = 5 * time.Second
+
+	// maxBodySize は本文の検査で読み込む最大バイト数です
+	maxBodySize = 1 << 20
+)
+
+// StatusRange は期待するHTTPステータスコードの範囲です
+type StatusRange struct {
+	Min, Max int
+}
+
+// StatusRanges は期待するHTTPステータスコードの範囲の集合です
+type StatusRanges []StatusRange
+
+// DefaultStatusRanges は期待するステータスが未指定の場合に使用する範囲（2xxと3xx）です
+var DefaultStatusRanges = StatusRanges{{Min: 200, Max: 399}}
+
+// ParseStatusRanges は"200-299,301"のような文字列をStatusRangesに変換します
+func ParseStatusRanges(s string) (StatusRanges, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultStatusRanges, nil
+	}
+
+	var ranges StatusRanges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		min, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status range %q", part)
+		}
+		max := min
+		if isRange {
+			if max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil || max < min {
+				return nil, fmt.Errorf("invalid status range %q", part)
+			}
+		}
+		ranges = append(ranges, StatusRange{Min: min, Max: max})
+	}
+	return ranges, nil
+}
+
+// Contains はステータスコードがいずれかの範囲に含まれるかどうかを判定します
+func (r StatusRanges) Contains(code int) bool {
+	for _, sr := range r {
+		if code >= sr.Min && code <= sr.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPTimings はHTTPリクエストの各段階の所要時間です
+type HTTPTimings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration
+	Total   time.Duration
+}
+
+// String はログに記録する形式で所要時間を返します
+func (t HTTPTimings) String() string {
+	return fmt.Sprintf("dns=%v, connect=%v, tls=%v, ttfb=%v, total=%v", t.DNS, t.Connect, t.TLS, t.TTFB, t.Total)
+}
+
+// HTTPError はHTTPの応答が期待と異なった場合のエラーです
+type HTTPError struct {
+	StatusCode int
+	Reason     string
+	Timings    HTTPTimings
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s (%s)", e.StatusCode, e.Reason, e.Timings)
+}
+
+// HTTPProber はHTTP(S)リクエストを送信し、ステータスコードと本文で成否を判定します
+type HTTPProber struct {
+	Timeout      time.Duration
+	Expect       StatusRanges   // 成功とみなすステータスコード（nilの場合はDefaultStatusRanges）
+	BodyContains string         // 本文に含まれるべき文字列（オプション）
+	BodyRegexp   *regexp.Regexp // 本文がマッチすべき正規表現（オプション）
+}
+
+// Name returns the prober type
+func (p *HTTPProber) Name() string { return "http" }
+
+// error は接続を試みたアドレスが分かっている場合、エラーをProbeErrorで包みます
+func (p *HTTPProber) error(ip string, err error) error {
+	if ip == "" {
+		return err
+	}
+	return probeError(p.Name(), ip, err)
+}
+
+// Probe performs a GET request and records the status code and timing breakdown
+func (p *HTTPProber) Probe(ctx context.Context, target string) (*PingResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	var (
+		timings                                 HTTPTimings
+		dnsStart, connectStart, tlsStart, start time.Time
+		remoteIP                                string
+	)
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { timings.DNS = time.Since(dnsStart) },
+		ConnectStart: func(_, addr string) {
+			connectStart = time.Now()
+			// 接続に失敗した場合もエラーに接続先を記録できるよう、接続を試みたアドレスを保持する
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				remoteIP = host
+			}
+		},
+		ConnectDone:       func(string, string, error) { timings.Connect = time.Since(connectStart) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { timings.TLS = time.Since(tlsStart) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				remoteIP = addr.IP.String()
+			}
+		},
+		GotFirstResponseByte: func() { timings.TTFB = time.Since(start) },
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pingood")
+
+	// 計測を正確にするため、接続の再利用とリダイレクトの追跡は行わない
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, p.error(remoteIP, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	timings.Total = time.Since(start)
+	if err != nil {
+		return nil, p.error(remoteIP, err)
+	}
+
+	expect := p.Expect
+	if expect == nil {
+		expect = DefaultStatusRanges
+	}
+	if !expect.Contains(resp.StatusCode) {
+		return nil, p.error(remoteIP, &HTTPError{StatusCode: resp.StatusCode, Reason: "unexpected status", Timings: timings})
+	}
+	if p.BodyContains != "" && !strings.Contains(string(body), p.BodyContains) {
+		return nil, p.error(remoteIP, &HTTPError{StatusCode: resp.StatusCode, Reason: fmt.Sprintf("body does not contain %q", p.BodyContains), Timings: timings})
+	}
+	if p.BodyRegexp != nil && !p.BodyRegexp.Match(body) {
+		return nil, p.error(remoteIP, &HTTPError{StatusCode: resp.StatusCode, Reason: fmt.Sprintf("body does not match %q", p.BodyRegexp), Timings: timings})
+	}
+
+	return &PingResult{
+		Target:     target,
+		Prober:     p.Name(),
+		IP:         remoteIP,
+		StatusCode: resp.StatusCode,
+		RTT:        timings.Total,
+		Timestamp:  start,
+		Detail:     fmt.Sprintf("Status: %d, %s", resp.StatusCode, timings),
+	}, nil
+}
@@ -0,0 +1,100 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    StatusRanges
+		wantErr bool
+	}{
+		{"Empty uses default", "", DefaultStatusRanges, false},
+		{"Single code", "204", StatusRanges{{204, 204}}, false},
+		{"Range and code", "200-299, 301", StatusRanges{{200, 299}, {301, 301}}, false},
+		{"Reversed range", "299-200", nil, true},
+		{"Not a number", "ok", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStatusRanges(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStatusRanges(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseStatusRanges(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPProber(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("status: healthy"))
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		prober     *HTTPProber
+		path       string
+		wantStatus int
+		wantErr    bool
+	}{
+		{"Success", &HTTPProber{}, "/ok", 200, false},
+		{"Service unavailable", &HTTPProber{}, "/down", 503, true},
+		{"Expected 503", &HTTPProber{Expect: StatusRanges{{503, 503}}}, "/down", 503, false},
+		{"Body contains", &HTTPProber{BodyContains: "healthy"}, "/ok", 200, false},
+		{"Body does not contain", &HTTPProber{BodyContains: "degraded"}, "/ok", 200, true},
+		{"Body regex", &HTTPProber{BodyRegexp: regexp.MustCompile(`status: \w+`)}, "/ok", 200, false},
+		{"Body regex mismatch", &HTTPProber{BodyRegexp: regexp.MustCompile(`^error`)}, "/ok", 200, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prober.Timeout = time.Second
+			result, err := tt.prober.Probe(context.Background(), server.URL+tt.path)
+			if tt.wantErr {
+				var httpErr *HTTPError
+				if !errors.As(err, &httpErr) {
+					t.Fatalf("Probe() error = %v, want *HTTPError", err)
+				}
+				if httpErr.StatusCode != tt.wantStatus {
+					t.Errorf("Probe() error status = %d, want %d", httpErr.StatusCode, tt.wantStatus)
+				}
+				var probeErr *ProbeError
+				if !errors.As(err, &probeErr) || probeErr.IP != "127.0.0.1" {
+					t.Errorf("Probe() error = %#v, want ProbeError with IP 127.0.0.1", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if result.StatusCode != tt.wantStatus {
+				t.Errorf("Probe() status = %d, want %d", result.StatusCode, tt.wantStatus)
+			}
+			if result.IP != "127.0.0.1" {
+				t.Errorf("Probe() IP = %q, want 127.0.0.1", result.IP)
+			}
+			if result.RTT <= 0 || result.Detail == "" {
+				t.Errorf("Probe() RTT = %v, Detail = %q, want timing breakdown", result.RTT, result.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package ping
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1  // IPv4のICMPプロトコル番号
+	protocolIPv6ICMP = 58 // IPv6のICMPプロトコル番号
+
+	// DefaultTimeout はエコー応答を待つデフォルトの時間です
+	DefaultTimeout = time.Second
+)
+
+var (
+	// echoID はrawソケットで送信するエコー要求の識別子です
+	// データグラムソケットではカーネルがローカルポートで上書きします
+	echoID = os.Getpid() & 0xffff
+
+	// echoSeq はプロセス全体で共有するシーケンス番号のカウンタです
+	echoSeq uint32
+)
+
+// nextSeq は次のICMPシーケンス番号を返します
+func nextSeq() int {
+	return int(atomic.AddUint32(&echoSeq, 1) & 0xffff)
+}
+
+// icmpSocket は開いたICMPソケットとその種類を保持します
+type icmpSocket struct {
+	conn     *icmp.PacketConn
+	proto    int
+	datagram bool // trueの場合は非特権のデータグラムソケット
+}
+
+// listenICMP は非特権のデータグラムICMPソケットを開き、失敗した場合はrawソケットにフォールバックします
+func listenICMP(ip net.IP) (*icmpSocket, error) {
+	network, rawNetwork, address, proto := "udp4", "ip4:icmp", "0.0.0.0", protocolICMP
+	if ip.To4() == nil {
+		network, rawNetwork, address, proto = "udp6", "ip6:ipv6-icmp", "::", protocolIPv6ICMP
+	}
+
+	sock := &icmpSocket{proto: proto, datagram: true}
+	conn, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		var rawErr error
+		conn, rawErr = icmp.ListenPacket(rawNetwork, address)
+		if rawErr != nil {
+			return nil, fmt.Errorf("%w: %v (raw: %v)", ErrNoSocket, err, rawErr)
+		}
+		sock.datagram = false
+	}
+	sock.conn = conn
+
+	// TTLを取得するための制御メッセージを有効化（未対応の環境ではTTLが0になる）
+	if p := conn.IPv4PacketConn(); p != nil {
+		p.SetControlMessage(ipv4.FlagTTL, true)
+	} else if p := conn.IPv6PacketConn(); p != nil {
+		p.SetControlMessage(ipv6.FlagHopLimit, true)
+	}
+	return sock, nil
+}
+
+// readFrom はパケットを1つ受信し、取得できた場合はTTLも返します
+func (s *icmpSocket) readFrom(b []byte) (n, ttl int, peer net.Addr, err error) {
+	if p := s.conn.IPv4PacketConn(); p != nil {
+		var cm *ipv4.ControlMessage
+		n, cm, peer, err = p.ReadFrom(b)
+		if cm != nil {
+			ttl = cm.TTL
+		}
+		return n, ttl, peer, err
+	}
+	if p := s.conn.IPv6PacketConn(); p != nil {
+		var cm *ipv6.ControlMessage
+		n, cm, peer, err = p.ReadFrom(b)
+		if cm != nil {
+			ttl = cm.HopLimit
+		}
+		return n, ttl, peer, err
+	}
+	n, peer, err = s.conn.ReadFrom(b)
+	return n, 0, peer, err
+}
+
+// resolveIP はターゲットのIPアドレスを解決します（IPv4を優先）
+func resolveIP(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP, nil
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoAddress, host)
+	}
+	return addrs[0].IP, nil
+}
+
+// newEchoRequest はエコー要求メッセージを生成します
+func newEchoRequest(proto, id, seq int, sent time.Time) ([]byte, error) {
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if proto == protocolIPv6ICMP {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data, uint64(sent.UnixNano()))
+	copy(data[8:], "pingood!")
+
+	msg := icmp.Message{
+		Type: typ,
+		Code: 0,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: data},
+	}
+	return msg.Marshal(nil)
+}
+
+// isEchoReply は受信したパケットが送信したエコー要求への応答かどうかを判定します
+// データグラムソケットでは識別子がカーネルに書き換えられるため、シーケンス番号のみで照合します
+func isEchoReply(proto int, b []byte, id, seq int, checkID bool) bool {
+	msg, err := icmp.ParseMessage(proto, b)
+	if err != nil {
+		return false
+	}
+	if msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply {
+		return false
+	}
+	echo, ok := msg.Body.(*icmp.Echo)
+	if !ok {
+		return false
+	}
+	return echo.Seq == seq && (!checkID || echo.ID == id)
+}
+
+// Echo はターゲットにICMPエコー要求を1回送信し、実際の往復時間を返します
+// 名前解決は計測の前に行われるため、RTTには含まれません
+func Echo(ctx context.Context, host string, timeout time.Duration) (*PingResult, error) {
+	ip, err := resolveIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	sock, err := listenICMP(ip)
+	if err != nil {
+		return nil, err
+	}
+	defer sock.conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := sock.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if sock.datagram {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	seq := nextSeq()
+	start := time.Now()
+	req, err := newEchoRequest(sock.proto, echoID, seq, start)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sock.conn.WriteTo(req, dst); err != nil {
+		return nil, probeError("icmp", ip.String(), err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, ttl, peer, err := sock.readFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return nil, probeError("icmp", ip.String(), fmt.Errorf("%w: %s", ErrTimeout, ip))
+			}
+			return nil, probeError("icmp", ip.String(), err)
+		}
+		rtt := time.Since(start)
+
+		if !sameIP(peer, ip) || !isEchoReply(sock.proto, buf[:n], echoID, seq, !sock.datagram) {
+			continue
+		}
+
+		return &PingResult{
+			Target:    host,
+			IP:        ip.String(),
+			Seq:       seq,
+			TTL:       ttl,
+			RTT:       rtt,
+			Timestamp: start,
+		}, nil
+	}
+}
+
+// sameIP はアドレスが指定されたIPと一致するかどうかを判定します
+func sameIP(addr net.Addr, ip net.IP) bool {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.Equal(ip)
+	case *net.IPAddr:
+		return a.IP.Equal(ip)
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func marshalEcho(t *testing.T, typ icmp.Type, id, seq int) []byte {
+	t.Helper()
+	msg := icmp.Message{Type: typ, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("pingood!")}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return b
+}
+
+func TestIsEchoReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		checkID bool
+		want    bool
+	}{
+		{"Matching reply", marshalEcho(t, ipv4.ICMPTypeEchoReply, 10, 5), true, true},
+		{"Wrong sequence", marshalEcho(t, ipv4.ICMPTypeEchoReply, 10, 6), true, false},
+		{"Wrong ID on raw socket", marshalEcho(t, ipv4.ICMPTypeEchoReply, 11, 5), true, false},
+		{"Rewritten ID on datagram socket", marshalEcho(t, ipv4.ICMPTypeEchoReply, 11, 5), false, true},
+		{"Echo request", marshalEcho(t, ipv4.ICMPTypeEcho, 10, 5), true, false},
+		{"Garbage", []byte{0x01}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isEchoReply(protocolICMP, tt.packet, 10, 5, tt.checkID); got != tt.want {
+				t.Errorf("isEchoReply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextSeqIncrements(t *testing.T) {
+	a, b := nextSeq(), nextSeq()
+	if b != (a+1)&0xffff {
+		t.Errorf("nextSeq() = %d then %d, want consecutive values", a, b)
+	}
+}
+
+func TestEchoLoopback(t *testing.T) {
+	if _, err := listenICMP([]byte{127, 0, 0, 1}); err != nil {
+		t.Skipf("ICMP sockets are not available: %v", err)
+	}
+
+	result, err := Echo(context.Background(), "127.0.0.1", 2*time.Second)
+	if errors.Is(err, ErrTimeout) {
+		t.Skipf("loopback did not answer: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Echo() error = %v", err)
+	}
+	if result.IP != "127.0.0.1" {
+		t.Errorf("Echo() IP = %v, want 127.0.0.1", result.IP)
+	}
+	if result.TTL <= 0 {
+		t.Errorf("Echo() TTL = %v, want positive", result.TTL)
+	}
+	if result.RTT <= 0 || result.RTT > 2*time.Second {
+		t.Errorf("Echo() RTT = %v, want within timeout", result.RTT)
+	}
+}
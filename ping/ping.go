@@ -1,42 +1,53 @@
 package ping
 
 import (
-	"net"
+	"context"
+	"fmt"
+	"runtime"
 	"time"
 )
 
 // PingResult represents the result of a ping operation
 type PingResult struct {
 	Target    string
+	Prober    string // 検査に使用したプローバーの種類
+	IP        string // 応答を返したIPアドレス
+	Seq       int    // ICMPシーケンス番号
+	TTL       int    // 応答パケットのTTL（IPv6ではホップリミット）
 	RTT       time.Duration
 	Timestamp time.Time
+
+	StatusCode int    // HTTPのステータスコード
+	Detail     string // プローバー固有の詳細（ログに追記されます）
+	Warning    string // 疎通はあるが注意が必要な状態（空でない場合はWARNとして記録されます）
 }
 
-// Ping executes a ping command to the specified target and returns the result
+// Ping sends an ICMP echo request to the specified target and returns the result
 func Ping(target string) (*PingResult, error) {
 	// URLからホスト名を抽出
 	target = ExtractHostFromURL(target)
 
-	// DNSルックアップ
-	if _, err := net.LookupHost(target); err != nil {
-		return nil, err
-	}
+	return (&ICMPProber{Timeout: DefaultTimeout}).Probe(context.Background(), target)
+}
 
-	// ping commandの生成
+// SystemPing runs the system ping command and parses the reported RTT, TTL and reply address
+func SystemPing(target string) (*PingResult, error) {
 	cmd, err := CreatePingCommand(target)
 	if err != nil {
 		return nil, err
 	}
 
 	start := time.Now()
-	if err := cmd.Run(); err != nil {
+	output, runErr := cmd.Output()
+
+	result, err := ParsePingOutput(runtime.GOOS, output)
+	if err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("%w: %v", err, runErr)
+		}
 		return nil, err
 	}
-	rtt := time.Since(start)
-
-	return &PingResult{
-		Target:    target,
-		RTT:       rtt,
-		Timestamp: time.Now(),
-	}, nil
+	result.Target = target
+	result.Timestamp = start
+	return result, nil
 }
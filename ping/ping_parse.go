@@ -0,0 +1,114 @@
+package ping
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// iputilsReplyPattern はLinux iputilsの応答行にマッチします
+	// 例: 64 bytes from example.com (93.184.216.34): icmp_seq=1 ttl=56 time=11.6 ms
+	iputilsReplyPattern = regexp.MustCompile(`(?m)^\d+ bytes from (?:\S+ \(([^)]+)\)|([^\s:]+(?::[^\s:]+)*)):? icmp_seq=(\d+) ttl=(\d+) time=([\d.]+) ms`)
+
+	// busyboxReplyPattern はBusyBoxの応答行にマッチします
+	// 例: 64 bytes from 93.184.216.34: seq=0 ttl=56 time=11.614 ms
+	busyboxReplyPattern = regexp.MustCompile(`(?m)^\d+ bytes from (\S+): seq=(\d+) ttl=(\d+) time=([\d.]+) ms`)
+
+	// darwinReplyPattern はmacOSの応答行にマッチします
+	// 例: 64 bytes from 93.184.216.34: icmp_seq=0 ttl=56 time=11.614 ms
+	darwinReplyPattern = regexp.MustCompile(`(?m)^\d+ bytes from (\S+): icmp_seq=(\d+) (?:ttl|hlim)=(\d+) time=([\d.]+) ms`)
+
+	// windowsReplyPattern はWindowsの応答行にマッチします
+	// 表示言語に依存しないよう、アドレスと数値部分のみで判定します
+	// 例: Reply from 93.184.216.34: bytes=32 time=11ms TTL=56
+	// 例: 93.184.216.34 からの応答: バイト数 =32 時間 =11ms TTL=56
+	windowsReplyPattern = regexp.MustCompile(`(?m)^(?:Reply from )?([0-9A-Fa-f.:%]+?):?\s.*\s\S*([=<])\s*(\d+)ms(?:\s+TTL=(\d+))?`)
+)
+
+// ParsePingOutput はOSに応じたpingコマンドの出力を解析し、最初の応答をPingResultとして返します
+// Linuxではiputilsの形式を試し、一致しない場合はBusyBoxの形式として解析します
+func ParsePingOutput(goos string, output []byte) (*PingResult, error) {
+	out := string(output)
+	switch goos {
+	case "linux":
+		if result, err := parseIputilsOutput(out); err == nil {
+			return result, nil
+		}
+		return parseBusyBoxOutput(out)
+	case "darwin":
+		return parseDarwinOutput(out)
+	case "windows":
+		return parseWindowsOutput(out)
+	default:
+		return nil, ErrUnsupportedOS
+	}
+}
+
+// parseIputilsOutput はLinux iputilsのping出力を解析します
+func parseIputilsOutput(out string) (*PingResult, error) {
+	m := iputilsReplyPattern.FindStringSubmatch(out)
+	if m == nil {
+		return nil, ErrNoReply
+	}
+	ip := m[1]
+	if ip == "" {
+		ip = m[2]
+	}
+	return newParsedResult(ip, m[3], m[4], m[5]+"ms")
+}
+
+// parseBusyBoxOutput はBusyBoxのping出力を解析します
+func parseBusyBoxOutput(out string) (*PingResult, error) {
+	m := busyboxReplyPattern.FindStringSubmatch(out)
+	if m == nil {
+		return nil, ErrNoReply
+	}
+	return newParsedResult(m[1], m[2], m[3], m[4]+"ms")
+}
+
+// parseDarwinOutput はmacOSのping出力を解析します
+func parseDarwinOutput(out string) (*PingResult, error) {
+	m := darwinReplyPattern.FindStringSubmatch(out)
+	if m == nil {
+		return nil, ErrNoReply
+	}
+	return newParsedResult(m[1], m[2], m[3], m[4]+"ms")
+}
+
+// parseWindowsOutput はWindowsのping出力を解析します
+// Windowsはシーケンス番号を出力しないためSeqは0になり、"time<1ms"は上限値の1msとして記録します
+func parseWindowsOutput(out string) (*PingResult, error) {
+	m := windowsReplyPattern.FindStringSubmatch(out)
+	if m == nil {
+		return nil, ErrNoReply
+	}
+	ttl := m[4]
+	if ttl == "" {
+		ttl = "0" // IPv6の応答にはTTLが含まれない
+	}
+	return newParsedResult(m[1], "0", ttl, m[3]+"ms")
+}
+
+// newParsedResult は解析した文字列からPingResultを生成します
+func newParsedResult(ip, seq, ttl, rtt string) (*PingResult, error) {
+	seqNum, err := strconv.Atoi(seq)
+	if err != nil {
+		return nil, err
+	}
+	ttlNum, err := strconv.Atoi(ttl)
+	if err != nil {
+		return nil, err
+	}
+	d, err := time.ParseDuration(rtt)
+	if err != nil {
+		return nil, err
+	}
+	return &PingResult{
+		IP:  strings.TrimSuffix(ip, ":"),
+		Seq: seqNum,
+		TTL: ttlNum,
+		RTT: d,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package ping
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePingOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		fixture string
+		wantIP  string
+		wantSeq int
+		wantTTL int
+		wantRTT time.Duration
+		wantErr error
+	}{
+		{"Linux iputils", "linux", "iputils.txt", "93.184.216.34", 1, 56, 11600 * time.Microsecond, nil},
+		{"Linux iputils IPv6", "linux", "iputils_ipv6.txt", "2606:2800:220:1:248:1893:25c8:1946", 1, 52, 98200 * time.Microsecond, nil},
+		{"Linux iputils timeout", "linux", "iputils_timeout.txt", "", 0, 0, 0, ErrNoReply},
+		{"Linux BusyBox", "linux", "busybox.txt", "93.184.216.34", 0, 56, 11614 * time.Microsecond, nil},
+		{"macOS", "darwin", "darwin.txt", "93.184.216.34", 0, 56, 11614 * time.Microsecond, nil},
+		{"macOS timeout", "darwin", "darwin_timeout.txt", "", 0, 0, 0, ErrNoReply},
+		{"Windows", "windows", "windows.txt", "93.184.216.34", 0, 56, 11 * time.Millisecond, nil},
+		{"Windows below 1ms", "windows", "windows_sub_ms.txt", "192.168.1.1", 0, 64, time.Millisecond, nil},
+		{"Windows Japanese", "windows", "windows_ja.txt", "93.184.216.34", 0, 56, 11 * time.Millisecond, nil},
+		{"Windows unreachable", "windows", "windows_unreachable.txt", "", 0, 0, 0, ErrNoReply},
+		{"Unsupported OS", "plan9", "iputils.txt", "", 0, 0, 0, ErrUnsupportedOS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+
+			got, err := ParsePingOutput(tt.goos, output)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParsePingOutput() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePingOutput() error = %v", err)
+			}
+			if got.IP != tt.wantIP {
+				t.Errorf("ParsePingOutput() IP = %v, want %v", got.IP, tt.wantIP)
+			}
+			if got.Seq != tt.wantSeq {
+				t.Errorf("ParsePingOutput() Seq = %v, want %v", got.Seq, tt.wantSeq)
+			}
+			if got.TTL != tt.wantTTL {
+				t.Errorf("ParsePingOutput() TTL = %v, want %v", got.TTL, tt.wantTTL)
+			}
+			if got.RTT != tt.wantRTT {
+				t.Errorf("ParsePingOutput() RTT = %v, want %v", got.RTT, tt.wantRTT)
+			}
+		})
+	}
+}
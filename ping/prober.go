@@ -0,0 +1,158 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Prober はターゲットへの疎通を確認する方式を表します
+type Prober interface {
+	// Name はログに記録するプローバーの種類を返します
+	Name() string
+	// Probe はターゲットを1回検査し、結果を返します
+	Probe(ctx context.Context, target string) (*PingResult, error)
+}
+
+// Options はプローバーの動作を調整する設定です
+type Options struct {
+	Timeout time.Duration // 1回の検査のタイムアウト（0の場合はDefaultTimeout）
+
+	// HTTPプローバーの設定
+	ExpectStatus string // 成功とみなすステータスコード（例: "200-299,301"）
+	BodyContains string // 本文に含まれるべき文字列
+	BodyRegex    string // 本文がマッチすべき正規表現
+
+	// DNSプローバーの設定（dns:// のURLで指定された値が優先されます）
+	DNSServer     string   // ネームサーバー（host[:port]）
+	DNSNetwork    string   // "udp" または "tcp"
+	RecordType    string   // レコードの種類（A, AAAA, CNAME, MX, TXT）
+	ExpectAnswers []string // 応答に含まれるべき値
+
+	// TLSプローバーの設定
+	ServerName   string // SNIに使用する名前（空の場合は接続先のホスト名）
+	CertWarnDays int    // 証明書の有効期限の警告を出す残り日数（0の場合はDefaultCertWarnDays）
+}
+
+// timeout はタイムアウト値を返します（未設定の場合はDefaultTimeout）
+func (o Options) timeout() time.Duration {
+	return o.timeoutOr(DefaultTimeout)
+}
+
+// timeoutOr はタイムアウト値を返します（未設定の場合は指定されたデフォルト値）
+func (o Options) timeoutOr(def time.Duration) time.Duration {
+	if o.Timeout <= 0 {
+		return def
+	}
+	return o.Timeout
+}
+
+// NewProber はターゲットのスキームに応じたプローバーと、Probeに渡すアドレスを返します
+// スキームがない場合はICMPを使用します（例: tcp://example.com:443, https://example.com/health, tls://example.com:443, dns://8.8.8.8/example.com?type=MX）
+func NewProber(target string, opts Options) (Prober, string, error) {
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found {
+		return &ICMPProber{Timeout: opts.timeout()}, target, nil
+	}
+
+	switch strings.ToLower(scheme) {
+	case "tcp":
+		addr := strings.Split(rest, "/")[0]
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, "", fmt.Errorf("invalid tcp target %q: %v", target, err)
+		}
+		return &TCPProber{Timeout: opts.timeout()}, addr, nil
+	case "http", "https":
+		expect, err := ParseStatusRanges(opts.ExpectStatus)
+		if err != nil {
+			return nil, "", err
+		}
+		p := &HTTPProber{Timeout: opts.timeoutOr(DefaultHTTPTimeout), Expect: expect, BodyContains: opts.BodyContains}
+		if opts.BodyRegex != "" {
+			if p.BodyRegexp, err = regexp.Compile(opts.BodyRegex); err != nil {
+				return nil, "", fmt.Errorf("invalid body regex %q: %v", opts.BodyRegex, err)
+			}
+		}
+		return p, target, nil
+	case "tls":
+		p, addr, err := newTLSProber(target, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return p, addr, nil
+	case "dns":
+		p, name, err := newDNSProber(target, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return p, name, nil
+	default:
+		// icmp:// および従来通りのURL指定はホスト名を抽出してICMPで検査
+		return &ICMPProber{Timeout: opts.timeout()}, ExtractHostFromURL(target), nil
+	}
+}
+
+// ICMPProber はICMPエコーで疎通を確認します
+type ICMPProber struct {
+	Timeout time.Duration
+}
+
+// Name returns the prober type
+func (p *ICMPProber) Name() string { return "icmp" }
+
+// Probe sends an ICMP echo request, falling back to the system ping command
+func (p *ICMPProber) Probe(ctx context.Context, target string) (*PingResult, error) {
+	result, err := Echo(ctx, target, p.Timeout)
+	if errors.Is(err, ErrNoSocket) {
+		// ICMPソケットが使えない環境ではシステムのpingコマンドにフォールバック
+		result, err = SystemPing(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Prober = p.Name()
+	return result, nil
+}
+
+// TCPProber はTCPの接続確立までの時間を計測します
+type TCPProber struct {
+	Timeout time.Duration
+}
+
+// Name returns the prober type
+func (p *TCPProber) Name() string { return "tcp" }
+
+// Probe connects to host:port and measures the handshake time
+func (p *TCPProber) Probe(ctx context.Context, target string) (*PingResult, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// 名前解決の時間をRTTに含めないよう、先にアドレスを解決する
+	ip, err := resolveIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: p.Timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return nil, probeError(p.Name(), ip.String(), err)
+	}
+	rtt := time.Since(start)
+	conn.Close()
+
+	return &PingResult{
+		Target:    target,
+		IP:        ip.String(),
+		Prober:    p.Name(),
+		RTT:       rtt,
+		Timestamp: start,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewProber(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantProber string
+		wantAddr   string
+		wantErr    bool
+	}{
+		{"Plain host", "example.com", "icmp", "example.com", false},
+		{"ICMP scheme", "icmp://example.com", "icmp", "example.com", false},
+		{"TCP scheme", "tcp://example.com:443", "tcp", "example.com:443", false},
+		{"TCP with IPv6", "tcp://[::1]:22", "tcp", "[::1]:22", false},
+		{"TCP without port", "tcp://example.com", "", "", true},
+		{"HTTPS URL", "https://example.com/health", "http", "https://example.com/health", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, addr, err := NewProber(tt.target, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewProber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if p.Name() != tt.wantProber {
+				t.Errorf("NewProber() prober = %v, want %v", p.Name(), tt.wantProber)
+			}
+			if addr != tt.wantAddr {
+				t.Errorf("NewProber() addr = %v, want %v", addr, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestTCPProber(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	p := &TCPProber{Timeout: time.Second}
+	result, err := p.Probe(context.Background(), ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if result.Prober != "tcp" || result.IP != "127.0.0.1" {
+		t.Errorf("Probe() = %+v, want tcp prober to 127.0.0.1", result)
+	}
+	if result.RTT <= 0 {
+		t.Errorf("Probe() RTT = %v, want positive", result.RTT)
+	}
+
+	// 閉じたポートへの接続はエラーになる
+	addr := ln.Addr().String()
+	ln.Close()
+	_, err = p.Probe(context.Background(), addr)
+	if err == nil {
+		t.Fatal("Probe() to closed port succeeded, want error")
+	}
+	// エラーにも接続先のIPアドレスを記録する
+	var probeErr *ProbeError
+	if !errors.As(err, &probeErr) || probeErr.IP != "127.0.0.1" || probeErr.Prober != "tcp" {
+		t.Errorf("Probe() error = %#v, want ProbeError with IP 127.0.0.1", err)
+	}
+}
@@ -0,0 +1,150 @@
+package ping
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultCertWarnDays は証明書の有効期限の警告を出すデフォルトの残り日数です
+const DefaultCertWarnDays = 14
+
+// ErrCertExpired は証明書の有効期限が切れている場合のエラーです
+var ErrCertExpired = errors.New("certificate has expired")
+
+// TLSProber はTLSハンドシェイクを行い、証明書の有効期限と検証結果を記録します
+type TLSProber struct {
+	Timeout    time.Duration
+	ServerName string // SNIに使用する名前（空の場合は接続先のホスト名）
+	WarnDays   int    // 有効期限までの残り日数がこれ以下になると警告（0の場合はDefaultCertWarnDays）
+
+	RootCAs *x509.CertPool // チェーンの検証に使用するルート証明書（nilの場合はシステムのルート証明書）
+}
+
+// Name returns the prober type
+func (p *TLSProber) Name() string { return "tls" }
+
+// newTLSProber はtls://host[:port]?sni=name&warn_days=30 形式のターゲットからプローバーと接続先を生成します
+// ポートを省略した場合は443を使用し、URLで指定されなかった項目はOptionsの値を使用します
+func newTLSProber(target string, opts Options) (*TLSProber, string, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid tls target %q", target)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	p := &TLSProber{
+		Timeout:    opts.timeoutOr(DefaultHTTPTimeout),
+		ServerName: opts.ServerName,
+		WarnDays:   opts.CertWarnDays,
+	}
+	q := u.Query()
+	if v := q.Get("sni"); v != "" {
+		p.ServerName = v
+	}
+	if v := q.Get("warn_days"); v != "" {
+		if p.WarnDays, err = strconv.Atoi(v); err != nil {
+			return nil, "", fmt.Errorf("invalid warn_days %q in %q", v, target)
+		}
+	}
+	return p, addr, nil
+}
+
+// Probe completes a TLS handshake and inspects the negotiated session and certificate chain
+func (p *TLSProber) Probe(ctx context.Context, target string) (*PingResult, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	serverName := p.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	// 名前解決の時間をRTTに含めないよう、先にアドレスを解決する
+	ip, err := resolveIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// 証明書チェーンの検証はハンドシェイク後に行い、検証に失敗しても詳細を記録できるようにする
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: p.Timeout},
+		Config: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		},
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return nil, probeError(p.Name(), ip.String(), err)
+	}
+	rtt := time.Since(start)
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, probeError(p.Name(), ip.String(), fmt.Errorf("no certificate presented by %s", target))
+	}
+	leaf := state.PeerCertificates[0]
+
+	detail := fmt.Sprintf("Version: %s, Cipher: %s, Expires: %s",
+		tls.VersionName(state.Version),
+		tls.CipherSuiteName(state.CipherSuite),
+		leaf.NotAfter.UTC().Format(time.RFC3339))
+
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		return nil, probeError(p.Name(), ip.String(),
+			fmt.Errorf("%w: %s expired at %s (%s)", ErrCertExpired, leaf.Subject.CommonName, leaf.NotAfter.UTC().Format(time.RFC3339), detail))
+	}
+	if err := verifyChain(state.PeerCertificates, serverName, p.RootCAs, now); err != nil {
+		return nil, probeError(p.Name(), ip.String(), fmt.Errorf("certificate verification failed: %w (%s)", err, detail))
+	}
+
+	result := &PingResult{
+		Target:    target,
+		Prober:    p.Name(),
+		IP:        ip.String(),
+		RTT:       rtt,
+		Timestamp: start,
+		Detail:    detail + ", Chain: valid",
+	}
+
+	warnDays := p.WarnDays
+	if warnDays <= 0 {
+		warnDays = DefaultCertWarnDays
+	}
+	if remaining := leaf.NotAfter.Sub(now); remaining < time.Duration(warnDays)*24*time.Hour {
+		result.Warning = fmt.Sprintf("certificate expires in %d days", int(remaining.Hours()/24))
+	}
+	return result, nil
+}
+
+// verifyChain は証明書チェーンとホスト名を検証します
+func verifyChain(certs []*x509.Certificate, serverName string, roots *x509.CertPool, now time.Time) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	return err
+}
@@ -0,0 +1,152 @@
+package ping
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTLSServer は指定した有効期間の自己署名証明書で応答するTLSサーバーを起動します
+func startTLSServer(t *testing.T, notBefore, notAfter time.Time) (string, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pingood.test"},
+		DNSNames:              []string{"pingood.test"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String(), roots
+}
+
+func TestTLSProber(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Valid certificate", func(t *testing.T) {
+		addr, roots := startTLSServer(t, now.Add(-time.Hour), now.Add(90*24*time.Hour))
+		p := &TLSProber{Timeout: time.Second, ServerName: "pingood.test", RootCAs: roots}
+		result, err := p.Probe(context.Background(), addr)
+		if err != nil {
+			t.Fatalf("Probe() error = %v", err)
+		}
+		if result.Warning != "" {
+			t.Errorf("Probe() Warning = %q, want none", result.Warning)
+		}
+		if !strings.Contains(result.Detail, "Version: TLS 1.3") || !strings.Contains(result.Detail, "Chain: valid") {
+			t.Errorf("Probe() Detail = %q, want version and chain status", result.Detail)
+		}
+	})
+
+	t.Run("Expiring soon", func(t *testing.T) {
+		addr, roots := startTLSServer(t, now.Add(-time.Hour), now.Add(5*24*time.Hour))
+		p := &TLSProber{Timeout: time.Second, ServerName: "pingood.test", RootCAs: roots, WarnDays: 30}
+		result, err := p.Probe(context.Background(), addr)
+		if err != nil {
+			t.Fatalf("Probe() error = %v", err)
+		}
+		if !strings.Contains(result.Warning, "expires in 4 days") && !strings.Contains(result.Warning, "expires in 5 days") {
+			t.Errorf("Probe() Warning = %q, want expiry warning", result.Warning)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		addr, roots := startTLSServer(t, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+		p := &TLSProber{Timeout: time.Second, ServerName: "pingood.test", RootCAs: roots}
+		if _, err := p.Probe(context.Background(), addr); !errors.Is(err, ErrCertExpired) {
+			t.Errorf("Probe() error = %v, want ErrCertExpired", err)
+		}
+	})
+
+	t.Run("Untrusted chain", func(t *testing.T) {
+		addr, _ := startTLSServer(t, now.Add(-time.Hour), now.Add(90*24*time.Hour))
+		p := &TLSProber{Timeout: time.Second, ServerName: "pingood.test", RootCAs: x509.NewCertPool()}
+		if _, err := p.Probe(context.Background(), addr); err == nil || !strings.Contains(err.Error(), "verification failed") {
+			t.Errorf("Probe() error = %v, want verification failure", err)
+		}
+	})
+
+	t.Run("SNI mismatch", func(t *testing.T) {
+		addr, roots := startTLSServer(t, now.Add(-time.Hour), now.Add(90*24*time.Hour))
+		p := &TLSProber{Timeout: time.Second, ServerName: "other.test", RootCAs: roots}
+		if _, err := p.Probe(context.Background(), addr); err == nil {
+			t.Error("Probe() with mismatched SNI succeeded, want error")
+		}
+	})
+}
+
+func TestNewTLSProber(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		wantAddr     string
+		wantSNI      string
+		wantWarnDays int
+		wantErr      bool
+	}{
+		{"Default port", "tls://example.com", "example.com:443", "", 0, false},
+		{"Explicit port", "tls://example.com:8443", "example.com:8443", "", 0, false},
+		{"IPv6", "tls://[::1]", net.JoinHostPort("::1", "443"), "", 0, false},
+		{"Parameters", "tls://192.0.2.1?sni=example.com&warn_days=30", "192.0.2.1:443", "example.com", 30, false},
+		{"Invalid warn_days", "tls://example.com?warn_days=soon", "", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, addr, err := newTLSProber(tt.target, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTLSProber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if addr != tt.wantAddr || p.ServerName != tt.wantSNI || p.WarnDays != tt.wantWarnDays {
+				t.Errorf("newTLSProber() = %s %s %d, want %s %s %d", addr, p.ServerName, p.WarnDays, tt.wantAddr, tt.wantSNI, tt.wantWarnDays)
+			}
+		})
+	}
+}
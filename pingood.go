@@ -2,18 +2,24 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"pingood/alert"
+	"pingood/hook"
 	"pingood/input"
 	"pingood/logger"
-	"pingood/path"
+	"pingood/metrics"
+	"pingood/monitor"
 	"pingood/ping"
 )
 
@@ -36,61 +42,84 @@ func askYesNo(prompt string, defaultYes bool) bool {
 	return defaultYes
 }
 
+// alertFlushTimeout は停止時に送信待ちの通知を送信する時間の上限です
+const alertFlushTimeout = 30 * time.Second
+
+// hookWaitTimeout は停止時に実行中のフックの終了を待つ時間の上限です
+const hookWaitTimeout = 10 * time.Second
+
 func main() {
+	// サブコマンドの実行
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			return
+		}
+	}
+
 	// コマンドライン引数の定義
-	target := flag.String("target", "", "Target URLs or IP addresses to ping (comma-separated)")
+	target := flag.String("target", "", "Target URLs or IP addresses to ping (comma-separated, e.g. tcp://host:443 for TCP)")
 	interval := flag.Int("interval", 5, "Ping interval in seconds")
+	workers := flag.Int("workers", 0, "Maximum number of concurrent probes (default: number of targets)")
 	logPath := flag.String("log", "", "Paths to log files (comma-separated)")
 	upload := flag.Bool("upload", false, "Enable S3 upload with config.toml")
 	configPath := flag.String("config", "config.toml", "Path to config.toml for S3 upload settings")
+	expectStatus := flag.String("expect-status", "", "Expected HTTP status codes for http(s) targets (e.g. 200-299,301)")
+	bodyContains := flag.String("body-contains", "", "Substring the HTTP response body must contain")
+	bodyRegex := flag.String("body-regex", "", "Regular expression the HTTP response body must match")
+	dnsServer := flag.String("dns-server", "", "Nameserver for dns:// targets (host[:port], default: first nameserver in /etc/resolv.conf)")
+	dnsType := flag.String("dns-type", "", "Record type for dns:// targets (A, AAAA, CNAME, MX, TXT; default: A)")
+	expectAnswer := flag.String("expect-answer", "", "Values the DNS answer must contain for dns:// targets (comma-separated)")
+	uploadExisting := flag.Bool("upload-existing", false, "Upload existing log files on startup (with -upload)")
+	nonInteractive := flag.Bool("non-interactive", false, "Never prompt on stdin; fail if a required value is missing (default when stdin is not a terminal)")
+	metricsAddr := flag.String("metrics-addr", "", "Address to expose Prometheus metrics on /metrics (e.g. :9120)")
 	flag.Parse()
 
-	// 引数がない場合は対話的に入力を受け付ける
-	if *target == "" {
-		*target = readInput("対象のURLまたはIPアドレスを入力してください（カンマ区切りで複数指定可能）: ")
-		if *target == "" {
-			fmt.Println("Error: target is required")
-			flag.Usage()
-			os.Exit(1)
-		}
+	// コマンドラインで指定されていないフラグは環境変数（PINGOOD_TARGETなど）から設定する
+	if err := input.ApplyEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		log.Fatalf("Error: %v", err)
 	}
+	if *interval <= 0 {
+		log.Fatalf("Error: -intervalには1以上の秒数を指定してください: %d", *interval)
+	}
+	// systemdやコンテナなど標準入力が端末でない場合は、対話的な入力を行わない
+	interactive := !*nonInteractive && input.IsTerminal(os.Stdin)
 
-	// カンマ区切りの文字列をスライスに分割し、空白を除去
-	targets := path.SanitizePaths(strings.Split(*target, ","))
+	probeOpts := ping.Options{
+		ExpectStatus: *expectStatus,
+		BodyContains: *bodyContains,
+		BodyRegex:    *bodyRegex,
+		DNSServer:    *dnsServer,
+		RecordType:   *dnsType,
+	}
+	if *expectAnswer != "" {
+		probeOpts.ExpectAnswers = strings.Split(*expectAnswer, ",")
+	}
 
-	// intervalが未指定の場合
-	if flag.Lookup("interval").Value.String() == "5" && len(os.Args) == 1 {
-		intervalStr := readInput("Ping実行間隔を秒単位で入力してください（デフォルト: 5）: ")
-		if intervalStr != "" {
-			fmt.Sscanf(intervalStr, "%d", interval)
-		}
+	// -targetを省略し、設定ファイルに[[targets]]が定義されている場合は対話的な入力を行わずに設定ファイルから起動する
+	config, err := logger.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
+	loadedConfigPath := *configPath
+	fromConfig := *target == "" && len(config.Targets) > 0
 
-	// logPathが未指定の場合
-	var logPaths []string
-	if *logPath == "" {
-		if flag.Lookup("log").Value.String() == "" {
-			autoGenerate := readInput("ログファイル名を自動生成しますか？（y/n、デフォルト: y）: ")
-			if autoGenerate == "" || strings.ToLower(autoGenerate) == "y" {
-				// ターゲットごとにログファイル名を自動生成
-				logPaths = path.GenerateLogPaths(targets)
-			} else {
-				*logPath = readInput("ログファイルのパスを入力してください（カンマ区切りで複数指定可能）: ")
-				if *logPath == "" {
-					fmt.Println("Error: log path is required")
-					flag.Usage()
-					os.Exit(1)
-				}
-				logPaths = path.SanitizePaths(strings.Split(*logPath, ","))
-			}
-		}
+	var specs []targetSpec
+	if fromConfig {
+		specs, err = configTargets(config.Targets, config.State, config.Hooks, probeOpts, time.Duration(*interval)*time.Second)
 	} else {
-		logPaths = path.SanitizePaths(strings.Split(*logPath, ","))
+		specs, err = flagTargets(target, logPath, interval, probeOpts, interactive)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
-	// targetsとlogPathsの数が一致することを確認
-	if len(targets) != len(logPaths) {
-		log.Fatalf("Error: number of targets (%d) must match number of log files (%d)", len(targets), len(logPaths))
+	logPaths := make([]string, len(specs))
+	fileOpts := make([]logger.FileOptions, len(specs))
+	for i, s := range specs {
+		logPaths[i], fileOpts[i] = s.LogPath, s.File
 	}
 
 	// ログファイルのディレクトリを作成
@@ -104,88 +133,186 @@ func main() {
 	}
 
 	// ファイルアップロード機能の確認
-	var opts *logger.LoggerOptions
-	uploadFlagProvided := false
-	flag.Visit(func(f *flag.Flag) {
-		if f.Name == "upload" {
-			uploadFlagProvided = true
+	opts := &logger.LoggerOptions{
+		ConfigPath: *configPath,
+		Files:      fileOpts,
+	}
+	switch {
+	case fromConfig:
+		// 設定ファイルから起動する場合は、アップロードのスケジュールが設定されていればアップロードする
+		opts.Upload = *upload || (!flagProvided("upload") && (config.S3.Schedule != "" || config.S3.UploadTime != ""))
+		opts.UploadExisting = opts.Upload && *uploadExisting
+	case !interactive:
+		opts.Upload = *upload
+		opts.UploadExisting = *upload && *uploadExisting
+	case *upload || (!flagProvided("upload") && askYesNo("ファイルアップロード機能を使用しますか？", false)):
+		selectConfig(configPath, logPaths, opts, *uploadExisting)
+	}
+
+	// 対話的に入力しない場合は、存在しない設定ファイルのデフォルト値でアップロードしない
+	if opts.Upload && !interactive {
+		if _, err := os.Stat(*configPath); err != nil {
+			log.Fatalf("Error: アップロードの設定ファイルが見つかりません（-configまたはPINGOOD_CONFIGで指定してください）: %v", err)
 		}
-	})
-	if *upload || (!uploadFlagProvided && askYesNo("ファイルアップロード機能を使用しますか？", false)) {
-		// 設定ファイルのリストを取得
-		var tomlFiles []string
-		entries, err := os.ReadDir(".")
-		if err == nil {
-			for _, entry := range entries {
-				if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".toml") {
-					tomlFiles = append(tomlFiles, entry.Name())
-				}
-			}
+	}
+
+	// 対話的に別の設定ファイルを選択した場合は読み込み直し、ロガー、状態の判定、通知、フックで同じ設定を使用する
+	if *configPath != loadedConfigPath {
+		if config, err = logger.LoadConfig(*configPath); err != nil {
+			log.Fatalf("Error: %v", err)
 		}
+	}
+	if !fromConfig {
+		applyGlobalConfig(specs, config)
+	}
+	opts.Config = config
 
-		// 設定ファイルの選択
-		var selectedConfig string
-		if len(tomlFiles) > 0 {
-			fmt.Println("\n利用可能な設定ファイル:")
-			for i, file := range tomlFiles {
-				fmt.Printf("%d: %s\n", i+1, file)
-			}
-			fmt.Print("使用する設定ファイルの番号を選択してください: ")
-			scanner := bufio.NewScanner(os.Stdin)
-			if scanner.Scan() {
-				if num, err := strconv.Atoi(scanner.Text()); err == nil && num > 0 && num <= len(tomlFiles) {
-					selectedConfig = tomlFiles[num-1]
-					*configPath = selectedConfig
-				}
-			}
+	l, err := logger.NewLogger(logPaths, opts)
+	if err != nil {
+		log.Fatalf("ロガーの初期化に失敗しました: %v", err)
+	}
+
+	if opts.Upload {
+		log.Printf("S3アップロードが有効です（設定ファイル: %s）\n", *configPath)
+	}
+
+	// ターゲットごとの検査ジョブを作成
+	jobs := make([]monitor.Job, len(specs))
+	hookConfigs := make([]hook.Config, len(specs))
+	for i, s := range specs {
+		jobs[i] = monitor.Job{
+			Index:    i,
+			Target:   s.Target,
+			Address:  s.Address,
+			Prober:   s.Prober,
+			Interval: s.Interval,
+			Thresholds: monitor.Thresholds{
+				DownAfter: s.State.DownAfter,
+				UpAfter:   s.State.UpAfter,
+			},
 		}
+		hookConfigs[i] = s.Hooks
+		fmt.Printf("Starting ping to %s (interval: %v, log: %s)\n", s.Target, s.Interval, s.LogPath)
+	}
 
-		if selectedConfig == "" {
-			*configPath = "config.toml"
-			fmt.Printf("デフォルトの設定ファイル '%s' を使用します\n", *configPath)
+	// 状態の遷移の通知先（[alerts]）
+	alerts, err := alert.New(config.Alerts, l.TailErrors)
+	if err != nil {
+		log.Fatalf("通知の設定に失敗しました: %v", err)
+	}
+	if n := alerts.Len(); n > 0 {
+		log.Printf("状態の遷移を%d件の通知先に送信します\n", n)
+	}
+
+	// 状態の遷移で実行するコマンド（[hooks]、[[targets]]のon_downとon_up）
+	// 実行結果と出力はログファイルとイベントログファイルに記録する
+	hooks := hook.NewRunner(hookConfigs, func(r hook.Result) {
+		if r.Err != nil {
+			log.Printf("フック%sの実行に失敗しました %s: %v\n", r.Name, r.Job.Target, r.Err)
+		}
+		if err := l.LogHook(r.Job.Index, r); err != nil {
+			log.Printf("フックの実行結果の記録に失敗しました: %v\n", err)
 		}
+	})
+	if n := hooks.Len(); n > 0 {
+		log.Printf("%d件のターゲットで状態の遷移時にコマンドを実行します\n", n)
+	}
 
-		opts = &logger.LoggerOptions{
-			ConfigPath: *configPath,
+	// 検査の結果と状態をPrometheusのテキスト形式で公開する（-metrics-addr）
+	// アップロードが無効な場合はアップロードの回数とスプールの件数を出力しない
+	var uploader metrics.Uploader
+	if opts.Upload {
+		uploader = l
+	}
+	collector := metrics.New(jobs, uploader)
+	var metricsServer *http.Server
+	if *metricsAddr != "" {
+		if metricsServer, err = metrics.Serve(*metricsAddr, collector); err != nil {
+			log.Fatalf("Error: %v", err)
 		}
+		log.Printf("メトリクスを%sの/metricsで公開しています\n", *metricsAddr)
+	}
 
-		// 既存のログファイルをチェック
-		for _, logPath := range logPaths {
-			if info, err := os.Stat(logPath); err == nil && info.Size() > 0 {
-				fmt.Printf("既存のログファイル '%s' が見つかりました（サイズ: %d bytes）\n", logPath, info.Size())
-				if askYesNo("このログファイルをアップロードしますか？", false) {
-					opts.UploadExisting = true
-					break
-				}
+	// SIGINT/SIGTERMで検査を停止する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	// ターゲットごとに並行して検査し、結果をチャネル経由でロガーに渡す
+	m := monitor.New(jobs, *workers)
+	go m.Run(ctx)
+
+	// 実行中の検査がすべて完了するとチャネルが閉じられる
+	// 結果はターゲットごとの状態（UP、DOWN、DEGRADED）に集計し、状態が変わった場合はイベントとして記録する
+	tracker := monitor.NewTracker()
+	for r := range m.Results() {
+		if r.Err != nil {
+			l.LogError(r.Job.Index, r.Job.Target, r.Err)
+		} else {
+			l.LogSuccess(r.Job.Index, r.Job.Target, r.Result)
+		}
+		collector.Observe(r)
+		if t, ok := tracker.Observe(r); ok {
+			collector.ObserveTransition(t)
+			log.Println(t)
+			if err := l.LogEvent(r.Job.Index, t); err != nil {
+				log.Printf("状態の遷移の記録に失敗しました: %v\n", err)
 			}
+			alerts.Send(t)
+			hooks.Run(t)
 		}
 	}
 
-	l, err := logger.NewLogger(logPaths, opts)
-	if err != nil {
-		log.Fatalf("ロガーの初期化に失敗しました: %v", err)
+	// 以降はシグナルの既定の動作に戻し、最終アップロードなどが止まった場合に再度のCtrl-Cで終了できるようにする
+	stop()
+	fmt.Println("監視を停止しています...")
+	if metricsServer != nil {
+		metricsServer.Close()
 	}
-	defer l.Close()
+	shutdown(l, alerts, hooks, opts.Upload)
+}
 
-	if *upload {
-		log.Printf("S3アップロードが有効です（設定ファイル: %s）\n", *configPath)
+// flagProvided はフラグがコマンドラインまたは環境変数で指定されたかを返します
+func flagProvided(name string) bool {
+	provided := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			provided = true
+		}
+	})
+	return provided
+}
+
+// shutdown は送信待ちの通知を送信し、実行中のフックの終了を待ち、停止マーカーを書き込み、
+// アップロードが有効な場合は最終アップロードを行ってからロガーを閉じます
+func shutdown(l *logger.Logger, alerts *alert.Dispatcher, hooks *hook.Runner, uploadEnabled bool) {
+	l.StopSchedule()
+
+	ctx, cancel := context.WithTimeout(context.Background(), alertFlushTimeout)
+	defer cancel()
+	if err := alerts.Close(ctx); err != nil {
+		log.Printf("%v\n", err)
 	}
 
-	// メインループ
-	ticker := time.NewTicker(time.Duration(*interval) * time.Second)
-	defer ticker.Stop()
+	hookCtx, hookCancel := context.WithTimeout(context.Background(), hookWaitTimeout)
+	defer hookCancel()
+	if err := hooks.Close(hookCtx); err != nil {
+		log.Printf("%v\n", err)
+	}
 
-	fmt.Printf("Starting ping to %s (interval: %d seconds)\n", strings.Join(targets, ", "), *interval)
-	fmt.Printf("Logging to: %s\n", strings.Join(logPaths, ", "))
+	if err := l.LogStopped(); err != nil {
+		log.Printf("停止マーカーの書き込みに失敗しました: %v\n", err)
+	}
 
-	for range ticker.C {
-		for i, t := range targets {
-			result, err := ping.Ping(t)
-			if err != nil {
-				l.LogError(i, t, err)
-				continue
-			}
-			l.LogSuccess(i, t, result)
+	if uploadEnabled {
+		fmt.Println("最終アップロードを実行しています...")
+		if err := l.UploadNow(); err != nil {
+			log.Printf("最終アップロードに失敗しました: %v\n", err)
+		}
+		if n := l.Pending(); n > 0 {
+			log.Printf("%d件のログファイルがアップロード待ちです（次回の起動時に再送します）\n", n)
 		}
 	}
+
+	if err := l.Close(); err != nil {
+		log.Printf("ログファイルのクローズに失敗しました: %v\n", err)
+	}
 }
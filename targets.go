@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pingood/hook"
+	"pingood/logger"
+	"pingood/path"
+	"pingood/ping"
+)
+
+// targetSpec は検査するターゲットとログファイルの設定です
+type targetSpec struct {
+	Target   string      // ログに記録するターゲット
+	Address  string      // プローバーに渡すアドレス
+	Prober   ping.Prober // 検査に使用するプローバー
+	Interval time.Duration
+	LogPath  string
+	File     logger.FileOptions
+	State    logger.StateConfig // 状態を判定する連続回数
+	Hooks    hook.Config        // 状態の遷移で実行するコマンド
+}
+
+// configTargets は設定ファイルの[[targets]]からターゲットを作成します
+// intervalを省略したターゲットはdefaultIntervalで検査し、down_afterとup_afterを省略したターゲットはstateの回数で判定します
+// on_downとon_upを省略したターゲットはhooksのコマンドを実行します
+func configTargets(targets []logger.TargetConfig, state logger.StateConfig, hooks hook.Config, probeOpts ping.Options, defaultInterval time.Duration) ([]targetSpec, error) {
+	specs := make([]targetSpec, len(targets))
+	for i, t := range targets {
+		target, err := t.ProbeTarget()
+		if err != nil {
+			return nil, err
+		}
+		opts := probeOpts
+		opts.Timeout = t.TimeoutDuration()
+		if t.DNSServer != "" {
+			opts.DNSServer = t.DNSServer
+		}
+		if t.RecordType != "" {
+			opts.RecordType = t.RecordType
+		}
+		if len(t.Expect) > 0 {
+			opts.ExpectAnswers = t.Expect
+		}
+		p, addr, err := ping.NewProber(target, opts)
+		if err != nil {
+			return nil, err
+		}
+		specs[i] = targetSpec{
+			Target:   t.DisplayName(),
+			Address:  addr,
+			Prober:   p,
+			Interval: t.IntervalOr(defaultInterval),
+			LogPath:  t.LogPath(),
+			File: logger.FileOptions{
+				ErrorLogMode: t.ErrorLogMode,
+				Labels:       t.Labels,
+			},
+			State: t.StateOr(state),
+			Hooks: t.HooksOr(hooks),
+		}
+	}
+	return specs, nil
+}
+
+// flagTargets は-targetと-logのフラグ、または対話的な入力からターゲットを作成します
+// interactiveがfalseの場合は入力を求めず、ターゲットがなければエラーを返し、ログファイル名は自動生成します
+// 状態を判定する回数と状態の遷移で実行するコマンドは、設定ファイルが決まった後にapplyGlobalConfigで設定します
+func flagTargets(target, logPath *string, interval *int, probeOpts ping.Options, interactive bool) ([]targetSpec, error) {
+	if *target == "" && !interactive {
+		return nil, fmt.Errorf("ターゲットが指定されていません（-target、PINGOOD_TARGETまたは設定ファイルの[[targets]]で指定してください）")
+	}
+
+	// 引数がない場合は対話的に入力を受け付ける
+	if *target == "" {
+		*target = readInput("対象のURLまたはIPアドレスを入力してください（カンマ区切りで複数指定可能）: ")
+		if *target == "" {
+			fmt.Println("Error: target is required")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	// カンマ区切りの文字列をスライスに分割し、空白を除去
+	targets := path.SanitizePaths(strings.Split(*target, ","))
+
+	// intervalが未指定の場合
+	if interactive && !flagProvided("interval") && len(os.Args) == 1 {
+		intervalStr := readInput("Ping実行間隔を秒単位で入力してください（デフォルト: 5）: ")
+		if intervalStr != "" {
+			fmt.Sscanf(intervalStr, "%d", interval)
+		}
+		if *interval <= 0 {
+			return nil, fmt.Errorf("Ping実行間隔には1以上の秒数を指定してください: %s", intervalStr)
+		}
+	}
+
+	// logPathが未指定の場合
+	var logPaths []string
+	if *logPath == "" {
+		if !interactive {
+			logPaths = path.GenerateLogPaths(targets)
+		} else {
+			autoGenerate := readInput("ログファイル名を自動生成しますか？（y/n、デフォルト: y）: ")
+			if autoGenerate == "" || strings.ToLower(autoGenerate) == "y" {
+				// ターゲットごとにログファイル名を自動生成
+				logPaths = path.GenerateLogPaths(targets)
+			} else {
+				*logPath = readInput("ログファイルのパスを入力してください（カンマ区切りで複数指定可能）: ")
+				if *logPath == "" {
+					fmt.Println("Error: log path is required")
+					flag.Usage()
+					os.Exit(1)
+				}
+				logPaths = path.SanitizePaths(strings.Split(*logPath, ","))
+			}
+		}
+	} else {
+		logPaths = path.SanitizePaths(strings.Split(*logPath, ","))
+	}
+
+	// targetsとlogPathsの数が一致することを確認
+	if len(targets) != len(logPaths) {
+		return nil, fmt.Errorf("number of targets (%d) must match number of log files (%d)", len(targets), len(logPaths))
+	}
+
+	// ターゲットごとにスキームからプローバーを選択
+	specs := make([]targetSpec, len(targets))
+	for i, t := range targets {
+		p, addr, err := ping.NewProber(t, probeOpts)
+		if err != nil {
+			return nil, err
+		}
+		specs[i] = targetSpec{
+			Target:   t,
+			Address:  addr,
+			Prober:   p,
+			Interval: time.Duration(*interval) * time.Second,
+			LogPath:  logPaths[i],
+		}
+	}
+	return specs, nil
+}
+
+// applyGlobalConfig は-targetで指定したターゲットに設定ファイルの[state]と[hooks]を設定します
+// 状態はすべてのターゲットで同じ回数で判定し、状態の遷移では同じコマンドを実行します
+func applyGlobalConfig(specs []targetSpec, config *logger.Config) {
+	for i := range specs {
+		specs[i].State = config.State
+		specs[i].Hooks = config.Hooks
+	}
+}
+
+// selectConfig はアップロードに使用する設定ファイルを対話的に選択し、既存のログファイルをアップロードするかを確認します
+// -configや-upload-existingが指定されている場合は、その値を使用して確認を行いません
+func selectConfig(configPath *string, logPaths []string, opts *logger.LoggerOptions, uploadExisting bool) {
+	opts.Upload = true
+	opts.UploadExisting = uploadExisting
+	if !flagProvided("config") {
+		chooseConfig(configPath)
+	}
+	opts.ConfigPath = *configPath
+	if flagProvided("upload-existing") {
+		return
+	}
+
+	// 既存のログファイルをチェック
+	for _, logPath := range logPaths {
+		if info, err := os.Stat(logPath); err == nil && info.Size() > 0 {
+			fmt.Printf("既存のログファイル '%s' が見つかりました（サイズ: %d bytes）\n", logPath, info.Size())
+			if askYesNo("このログファイルをアップロードしますか？", false) {
+				opts.UploadExisting = true
+				break
+			}
+		}
+	}
+}
+
+// chooseConfig はカレントディレクトリの設定ファイルの一覧から、使用する設定ファイルを対話的に選択します
+func chooseConfig(configPath *string) {
+	// 設定ファイルのリストを取得
+	var tomlFiles []string
+	entries, err := os.ReadDir(".")
+	if err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".toml") {
+				tomlFiles = append(tomlFiles, entry.Name())
+			}
+		}
+	}
+
+	// 設定ファイルの選択
+	var selectedConfig string
+	if len(tomlFiles) > 0 {
+		fmt.Println("\n利用可能な設定ファイル:")
+		for i, file := range tomlFiles {
+			fmt.Printf("%d: %s\n", i+1, file)
+		}
+		fmt.Print("使用する設定ファイルの番号を選択してください: ")
+		scanner := bufio.NewScanner(os.Stdin)
+		if scanner.Scan() {
+			if num, err := strconv.Atoi(scanner.Text()); err == nil && num > 0 && num <= len(tomlFiles) {
+				selectedConfig = tomlFiles[num-1]
+				*configPath = selectedConfig
+			}
+		}
+	}
+
+	if selectedConfig == "" {
+		*configPath = "config.toml"
+		fmt.Printf("デフォルトの設定ファイル '%s' を使用します\n", *configPath)
+	}
+}